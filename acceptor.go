@@ -12,24 +12,48 @@ import (
 
 func NewAcceptor() (a *Acceptor) {
 	a = new(Acceptor)
+	a.done = make(chan struct{})
+	a.idle = make(chan struct{})
 	a.initEvents()
 	a.initRooms()
 	a.initClients()
 	a.onConnection = a.onConn
-	a.SetProtocol(nil) // set default protocol
+	a.SetProtocol(protocol.GetTextProtocol(conf.Acceptor.Transport.TextProtocol)) // set the text protocol selected, the default is used if not found
+	a.SetBackpressure(Backpressure{
+		Policy:       conf.Acceptor.Backpressure.Policy,
+		Capacity:     conf.Acceptor.Backpressure.Capacity,
+		BlockTimeout: time.Duration(conf.Acceptor.Backpressure.BlockTimeout) * time.Millisecond,
+	})
+
+	a.SetResume(Resume{
+		Grace:      time.Duration(conf.Acceptor.Resume.Grace) * time.Second,
+		BufferSize: conf.Acceptor.Resume.BufferSize,
+	})
 
 	a.On(EventPing, a.ping)
 	a.On(EventPong, a.pong)
+	a.On(EventResume, a.resumeSession)
 	return
 }
 
 type Acceptor struct {
 	events
 	protocol.Protocol
-	rooms   *rooms
-	clients *sync.Map // map[string]ClientFace
-	join    chan ClientFace
-	leave   chan ClientFace
+	rooms        *rooms
+	clients      *sync.Map // map[string]ClientFace
+	leave        chan ClientFace
+	rename       chan clientRename
+	adapter      Adapter      // fans the operations out to the other nodes of the cluster
+	backpressure Backpressure // what to do when the message send channel of a client is full
+	resume       Resume       // keep the session of the disconnected clients to be resumed
+
+	closing        int32         // whether the acceptor is shutting down
+	activeMu       sync.Mutex    // makes the closing check and the change of active atomic
+	active         int64         // the number of clients which have not left yet
+	idle           chan struct{} // closed when all the clients left after shutting down
+	done           chan struct{} // stop the goroutines of the acceptor after shutdown
+	goingAwayEvent string        // the event broadcast to all the clients when shutting down
+	goingAwayArgs  interface{}   // the args of the going away event
 }
 
 // the client initiate a ping and the server reply a pong
@@ -57,55 +81,133 @@ func (a *Acceptor) pong(c ClientFace, arg int64) {
 }
 
 // When the socket connection was established,
-// the server send the socket id to the client immediately
+// the server send the socket id to the client immediately, and the resume token if enabled
 func (a *Acceptor) onConn(f interface{}) {
 	c := f.(ClientFace)
 	c.Emit(EventSocketId, c.Id(), "")
+	a.issueToken(c)
+}
+
+// CallEvent deliver the reply to the waiter of EmitWithAck if the message id matched,
+// otherwise call the event processing function
+func (a *Acceptor) CallEvent(c interface{}, msg *protocol.Message) {
+	if client, ok := c.(AckEmitter); ok && client.ResolveAck(msg) {
+		return
+	}
+	a.events.CallEvent(c, msg)
 }
 
 func (a *Acceptor) initClients() {
 	a.clients = new(sync.Map)
-	a.join = make(chan ClientFace)
 	a.leave = make(chan ClientFace)
+	a.rename = make(chan clientRename)
 	go a.manageClients()
 }
 
 func (a *Acceptor) manageClients() {
 	for {
 		select {
-		case c := <-a.join:
-			a.clients.Store(c.Id(), c)
+		case <-a.done:
+			return
 		case c := <-a.leave:
 			if _, ok := a.clients.Load(c.Id()); ok {
 				a.clients.Delete(c.Id())
 			}
+		case r := <-a.rename:
+			a.clients.Delete(r.from)
+			a.clients.Store(r.client.Id(), r.client)
 		}
 	}
 }
 
 func (a *Acceptor) initRooms() {
-	a.rooms = newRooms()
+	a.rooms = newRooms(a.done)
 	go a.rooms.Run()
 }
 
+// Join add the client to the acceptor even if it is shutting down, see TryJoin
 func (a *Acceptor) Join(c ClientFace) {
-	a.join <- c
+	a.activeMu.Lock()
+	defer a.activeMu.Unlock()
+	a.active++
+	a.clients.Store(c.Id(), c)
+}
+
+// TryJoin add the client to the acceptor unless it is shutting down, return false if the client was rejected.
+// The client is added together with the closing check, so the client joined is always drained and waited by Shutdown
+func (a *Acceptor) TryJoin(c ClientFace) bool {
+	a.activeMu.Lock()
+	defer a.activeMu.Unlock()
+	if a.Closing() {
+		return false
+	}
+	a.active++
+	a.clients.Store(c.Id(), c)
+	return true
+}
+
+// Leave remove the client from the acceptor and all the rooms,
+// then trigger the event: OnDisconnection.
+// If the session resumption is enabled, the session is kept for the grace window instead,
+// OnDisconnection is triggered after the grace window if the session was not resumed
+func (a *Acceptor) Leave(c ClientFace) {
+	if a.suspend(c) {
+		return
+	}
+	a.disconnect(c)
+}
+
+func (a *Acceptor) disconnect(c ClientFace) {
+	c.LeaveAll()
+	a.CallGivenEvent(c, OnDisconnection)
+	a.release()
+}
+
+// release the client which left, wake up Shutdown if it is the last one
+func (a *Acceptor) release() {
+	a.activeMu.Lock()
+	defer a.activeMu.Unlock()
+	a.active--
+	a.wakeIdle()
 }
 
 func (a *Acceptor) BroadcastTo(room, event string, args interface{}, id string) {
 	a.rooms.BroadcastTo(room, event, args, id)
+	a.publish(AdapterBroadcastTo, room, "", event, args, id)
 }
 
 func (a *Acceptor) BroadcastToAll(event string, args interface{}, id string) {
 	for _, client := range a.Clients() {
 		client.Emit(event, args, id)
 	}
+	a.publish(AdapterBroadcastToAll, "", "", event, args, id)
 }
 
+// Emit send message to the client, the client may be connected to the other nodes of the cluster
 func (a *Acceptor) Emit(clientId, event string, args interface{}, id string) {
 	if v, ok := a.clients.Load(clientId); ok {
 		v.(ClientFace).Emit(event, args, id)
+		return
+	}
+	a.publish(AdapterEmit, "", clientId, event, args, id)
+}
+
+// JoinRoom let the client join the room, the client may be connected to the other nodes of the cluster
+func (a *Acceptor) JoinRoom(clientId, room string) {
+	if c, ok := a.Client(clientId); ok {
+		c.Join(room)
+		return
+	}
+	a.publish(AdapterJoin, room, clientId, "", nil, "")
+}
+
+// LeaveRoom let the client leave the room, the client may be connected to the other nodes of the cluster
+func (a *Acceptor) LeaveRoom(clientId, room string) {
+	if c, ok := a.Client(clientId); ok {
+		c.Leave(room)
+		return
 	}
+	a.publish(AdapterLeave, room, clientId, "", nil, "")
 }
 
 func (a *Acceptor) Client(clientId string) (c ClientFace, ok bool) {
@@ -125,11 +227,12 @@ func (a *Acceptor) Clients() map[string]ClientFace {
 	return clients
 }
 
+// ClientsByRoom get the clients of the room which connected to the local acceptor
 func (a *Acceptor) ClientsByRoom(room string) (clientFaces []ClientFace) {
 	if v, ok := a.rooms.clients.Load(room); ok {
 		v.(*sync.Map).Range(func(k, _ interface{}) bool {
 			// What we need is the clientFace that injected by the user
-			if clientFace, ok := a.Client(k.(*Client).id); ok {
+			if clientFace, ok := a.Client(k.(*Client).Id()); ok {
 				clientFaces = append(clientFaces, clientFace)
 			}
 			return true
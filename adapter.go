@@ -0,0 +1,86 @@
+package gosocket
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// the operations fanned out to the other nodes of the cluster
+const (
+	AdapterBroadcastTo    = "broadcastTo"    // broadcast message to a room
+	AdapterBroadcastToAll = "broadcastToAll" // broadcast message to all the clients
+	AdapterEmit           = "emit"           // send message to a client
+	AdapterJoin           = "join"           // a client join a room
+	AdapterLeave          = "leave"          // a client leave a room
+)
+
+// Adapter fans the broadcasts, joins and leaves out to the acceptors of the other processes,
+// so that the rooms and broadcasts span the whole cluster.
+// An adapter only publishes the operations of the local acceptor,
+// and the operations received from the other nodes must be applied to the local acceptor by Acceptor.Apply
+type Adapter interface {
+	Init(*Acceptor)          // bind the local acceptor
+	Publish(*AdapterMessage) // publish an operation to the other nodes
+}
+
+// AdapterMessage is an operation exchanged between the nodes of the cluster
+type AdapterMessage struct {
+	Type     string          `json:"type"`
+	Room     string          `json:"room,omitempty"`
+	ClientId string          `json:"clientId,omitempty"`
+	Event    string          `json:"event,omitempty"`
+	Args     json.RawMessage `json:"args,omitempty"`
+	Id       string          `json:"id,omitempty"`
+}
+
+// SetAdapter set the cluster adapter of the acceptor
+func (a *Acceptor) SetAdapter(adapter Adapter) {
+	adapter.Init(a)
+	a.adapter = adapter
+}
+
+// publish the operation to the other nodes if the adapter was set
+func (a *Acceptor) publish(typ, room, clientId, event string, args interface{}, id string) {
+	if a.adapter == nil {
+		return
+	}
+	m := &AdapterMessage{Type: typ, Room: room, ClientId: clientId, Event: event, Id: id}
+	if args != nil {
+		var err error
+		if m.Args, err = json.Marshal(args); err != nil {
+			log.Println("[adapter][publish] args encode error:", err, typ, room, clientId, event, args, id)
+			return
+		}
+	}
+	a.adapter.Publish(m)
+}
+
+// Apply the operation received from the other nodes to the clients of the local acceptor
+func (a *Acceptor) Apply(m *AdapterMessage) {
+	var args interface{}
+	if len(m.Args) > 0 {
+		args = m.Args
+	}
+	switch m.Type {
+	case AdapterBroadcastTo:
+		a.rooms.BroadcastTo(m.Room, m.Event, args, m.Id)
+	case AdapterBroadcastToAll:
+		for _, client := range a.Clients() {
+			client.Emit(m.Event, args, m.Id)
+		}
+	case AdapterEmit:
+		if c, ok := a.Client(m.ClientId); ok {
+			c.Emit(m.Event, args, m.Id)
+		}
+	case AdapterJoin:
+		if c, ok := a.Client(m.ClientId); ok {
+			c.Join(m.Room)
+		}
+	case AdapterLeave:
+		if c, ok := a.Client(m.ClientId); ok {
+			c.Leave(m.Room)
+		}
+	default:
+		log.Println("[adapter][apply] unknown operation:", m.Type)
+	}
+}
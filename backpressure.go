@@ -0,0 +1,149 @@
+package gosocket
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/plhwin/gosocket/conf"
+)
+
+// Backpressure decides what to do when the message send channel of a client is full
+type Backpressure struct {
+	Policy       string        // conf.BackpressureDropNewest, DropOldest, Block, Disconnect or Coalesce
+	Capacity     int           // the capacity of the message send channel of each client, besides the messages taken by the writer in batch
+	BlockTimeout time.Duration // only for the Block policy, the message is dropped if it can not be sent in time, it must be positive, the default is 1s
+}
+
+// SetBackpressure set the backpressure policy of the acceptor, it takes effect on the clients connected afterwards.
+// The broadcasts of the rooms are never blocked by the Block policy, the message is dropped instead,
+// otherwise one client which stops reading would stall the joins, leaves and broadcasts of the whole acceptor
+func (a *Acceptor) SetBackpressure(b Backpressure) {
+	if b.Capacity <= 0 {
+		b.Capacity = 500
+	}
+	// the sender must never be blocked forever by a slow client
+	if b.BlockTimeout <= 0 {
+		b.BlockTimeout = time.Second
+	}
+	a.backpressure = b
+}
+
+func (a *Acceptor) Backpressure() Backpressure {
+	return a.backpressure
+}
+
+func (c *Client) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Coalesced signal the writer that there are coalesced messages waiting to be sent
+func (c *Client) Coalesced() chan struct{} {
+	return c.coalescedSignal
+}
+
+// TakeCoalesced take the messages queued in the send channel first, and then the coalesced messages,
+// so that the latest message of each event is always sent last
+func (c *Client) TakeCoalesced() (msgs [][]byte) {
+	for n := len(c.out); n > 0; n-- {
+		msg, ok := <-c.out
+		if !ok {
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	for _, event := range c.coalescedEvents {
+		msgs = append(msgs, c.coalesced[event])
+		delete(c.coalesced, event)
+	}
+	c.coalescedEvents = c.coalescedEvents[:0]
+	return
+}
+
+// overflow handle the message which can not be put into the full send channel by the backpressure policy,
+// the sender is not blocked by the Block policy unless canBlock, e.g. the broadcasts of the rooms
+func (c *Client) overflow(event string, msg []byte, canBlock bool) error {
+	switch c.acceptor.backpressure.Policy {
+	case conf.BackpressureDropOldest:
+		// drop the oldest message to make room for the latest one
+		select {
+		case <-c.out:
+			c.drop()
+		default:
+		}
+		select {
+		case c.out <- msg:
+			return nil
+		default:
+		}
+	case conf.BackpressureBlock:
+		if canBlock {
+			return c.block(msg)
+		}
+	case conf.BackpressureDisconnect:
+		c.drop()
+		log.Println("[backpressure] disconnect the slow client:", c.Id(), c.RemoteAddr(), c.Dropped())
+		c.CloseConnCtx()
+		return ErrorEmitDropped
+	case conf.BackpressureCoalesce:
+		// the replayed messages of a resumed session have no event, they can not be coalesced
+		if event != "" {
+			c.coalesce(event, msg)
+			return nil
+		}
+	}
+	// the capacity of channel was full, data dropped，
+	// it must be sent without blocking here,
+	// in the broadcast scenario, blocking sending will cause the normal network clients to be unable to receive data
+	c.drop()
+	log.Println("message not sent:", c.Id(), c.RemoteAddr(), c.Dropped(), string(msg))
+	return ErrorEmitDropped
+}
+
+// block the sender until the message is sent, the client was closed or timeout
+func (c *Client) block(msg []byte) error {
+	timer := time.NewTimer(c.acceptor.backpressure.BlockTimeout)
+	defer timer.Stop()
+	select {
+	case <-c.Context().Done():
+		return ErrorEmitClosed
+	case <-c.stopOut:
+		return ErrorEmitClosed
+	case c.out <- msg:
+		return nil
+	case <-timer.C:
+		c.drop()
+		log.Println("message not sent, block timeout:", c.Id(), c.RemoteAddr(), c.Dropped(), string(msg))
+		return ErrorEmitDropped
+	}
+}
+
+// coalesce keep only the latest message of the event, replace the older one which is not sent yet
+func (c *Client) coalesce(event string, msg []byte) {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	if _, ok := c.coalesced[event]; ok {
+		c.drop()
+	} else {
+		c.coalescedEvents = append(c.coalescedEvents, event)
+	}
+	c.coalesced[event] = msg
+	select {
+	case c.coalescedSignal <- struct{}{}:
+	default:
+	}
+}
+
+// isCoalesced whether an older message of the event is waiting to be sent
+func (c *Client) isCoalesced(event string) bool {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	_, ok := c.coalesced[event]
+	return ok
+}
+
+func (c *Client) drop() {
+	atomic.AddUint64(&c.dropped, 1)
+}
@@ -3,6 +3,8 @@ package gosocket
 import (
 	"errors"
 	"reflect"
+
+	"google.golang.org/protobuf/proto"
 )
 
 type caller struct {
@@ -12,12 +14,15 @@ type caller struct {
 	Id          reflect.Type  // the id of message, client maintenance
 	IdPresent   bool          // whether the event processing function has the third input parameter(used to receive $id from client requests ["$event",$args,"$id"])
 	Out         bool          // does the event processing function return a value
+	Proto       bool          // whether the args is a proto.Message, which is unmarshalled from the binary data directly
 }
 
 var (
 	ErrorCallerFunc   = errors.New("f is not function")
 	ErrorCallerArgs   = errors.New("f should have 1 or 2 or 3 args")
 	ErrorCallerReturn = errors.New("f should return not more than one value")
+
+	protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
 )
 
 // parses function passed by using reflection, and stores its representation
@@ -62,6 +67,8 @@ func newCaller(f interface{}) (*caller, error) {
 		return nil, ErrorCallerArgs
 	}
 
+	curCaller.Proto = curCaller.ArgsPresent && curCaller.Args.Kind() == reflect.Ptr && curCaller.Args.Implements(protoMessageType)
+
 	return curCaller, nil
 }
 
@@ -70,6 +77,13 @@ func (c *caller) getArgs() interface{} {
 	return reflect.New(c.Args).Interface()
 }
 
+// returns function parameter unmarshalled from the binary data, only if the parameter is a proto.Message
+func (c *caller) getProtoArgs(data []byte) (interface{}, error) {
+	args := reflect.New(c.Args)
+	args.Elem().Set(reflect.New(c.Args.Elem()))
+	return args.Interface(), proto.Unmarshal(data, args.Elem().Interface().(proto.Message))
+}
+
 // calls function with given arguments from its representation using reflection
 func (c *caller) callFunc(client interface{}, args interface{}, id string) []reflect.Value {
 
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -13,8 +16,28 @@ import (
 	"time"
 
 	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
 )
 
+var (
+	ErrorEmitDropped     = errors.New("message not sent, the send channel of the client was full")
+	ErrorEmitClosed      = errors.New("message not sent, the client was closed")
+	ErrorAckTimeout      = errors.New("ack timeout, no reply from the client")
+	ErrorAckDisconnected = errors.New("ack failed, the client was disconnected")
+)
+
+// Identity is the authenticated identity of the client, attached during the handshake
+type Identity struct {
+	UserId string                 // the authenticated user id
+	Claims map[string]interface{} // any other claims of the user
+}
+
+// Ack is the result of EmitWithAck
+type Ack struct {
+	Result interface{} // the args replied by the client
+	Err    error       // not nil if the message was not sent, timeout or the client was disconnected
+}
+
 type ClientFace interface {
 	Init(context.Context, *Acceptor)                         // init the client
 	Context() context.Context                                // 获取连接上下文
@@ -40,18 +63,66 @@ type ClientFace interface {
 	SetRemoteAddr(net.Addr)                                  // set remoteAddr
 }
 
+// AckEmitter is the optional interface of the clients which support EmitWithAck, e.g. the ones embedding Client,
+// usage: c.(gosocket.AckEmitter).EmitWithAck(event, args, timeout)
+type AckEmitter interface {
+	EmitWithAck(string, interface{}, time.Duration) <-chan Ack // send message to socket client and wait for the reply with the same id
+	ResolveAck(*protocol.Message) bool                         // deliver the reply to the waiter of EmitWithAck
+}
+
+// Identified is the optional interface of the clients which keep the identity verified during the handshake, e.g. the ones embedding Client
+type Identified interface {
+	Identity() *Identity                // get the identity authenticated during the handshake, nil if no authenticator
+	PeerCertificate() *x509.Certificate // the client certificate verified by the mutual TLS, nil if not verified
+	PeerSubject() pkix.Name             // the subject of the verified client certificate, empty if not verified
+}
+
+// the clients embedding Client support the features beyond ClientFace, e.g. the acks, the drain and the session resumption,
+// the other implementations of ClientFace work without them
+type embedsClient interface {
+	base() *Client
+}
+
+// baseOf get the embedded Client of the client, return false if the client does not embed Client
+func baseOf(c ClientFace) (*Client, bool) {
+	if e, ok := c.(embedsClient); ok {
+		return e.base(), true
+	}
+	return nil, false
+}
+
 type Client struct {
-	connCtx    context.Context    // 连接专用上下文
-	connCancel context.CancelFunc // 连接上下文取消函数
-	id         string             // client id
-	remoteAddr net.Addr           // client remoteAddr
-	acceptor   *Acceptor          // event processing function register
-	rooms      *sync.Map          // map[string]bool all rooms joined by the client, used to quickly join and leave the rooms
-	out        chan []byte        // message send channel
-	stopOut    chan bool          // stop send message signal channel
-	ping       map[int64]bool     // ping
-	mu         sync.RWMutex       // mutex
-	delay      int64              // delay
+	connCtx      context.Context    // 连接专用上下文
+	connCancel   context.CancelFunc // 连接上下文取消函数
+	id           string             // client id
+	remoteAddr   net.Addr           // client remoteAddr
+	identity     *Identity          // the identity authenticated during the handshake
+	peerCert     *x509.Certificate  // the client certificate verified by the mutual TLS
+	sendCodec    protocol.Codec     // the codec of the messages sent to the client
+	receiveCodec protocol.Codec     // the codec of the messages received from the client
+	streams      streams            // the compression streams of the connection if the codec is streamed
+	acceptor     *Acceptor          // event processing function register
+	rooms        *sync.Map          // map[string]bool all rooms joined by the client, used to quickly join and leave the rooms
+	out          chan []byte        // message send channel
+	stopOut      chan bool          // stop send message signal channel
+	ping         map[int64]bool     // ping
+	acks         *pendings          // messages sent by EmitWithAck which are waiting for the reply
+	mu           sync.RWMutex       // mutex
+	delay        int64              // delay
+	dropped      uint64             // the number of messages dropped by the backpressure policy
+
+	coalesced       map[string][]byte // the latest message of each event waiting to be sent, only for the Coalesce policy
+	coalescedEvents []string          // the events of the coalesced messages in order
+	coalescedSignal chan struct{}     // coalesced messages are waiting to be sent signal channel
+	outMu           sync.Mutex        // mutex of the coalesced messages
+
+	draining  chan struct{} // drain the client signal channel
+	drainOnce sync.Once
+
+	token     string         // the resume token of the session
+	suspended int32          // whether the client was disconnected and the session is waiting to be resumed
+	buffered  []bufferedEmit // the messages emitted while suspended
+	expire    *time.Timer    // end the session after the grace window
 }
 
 func (c *Client) Init(baseCtx context.Context, a *Acceptor) {
@@ -60,13 +131,20 @@ func (c *Client) Init(baseCtx context.Context, a *Acceptor) {
 
 	c.id = c.genId()
 	c.acceptor = a
+	// the codec defaults to the conf, until negotiated by the transport
+	c.sendCodec = protocol.Codec{Serialize: conf.Acceptor.Transport.Send.Serialize, Compress: conf.Acceptor.Transport.Send.Compress, Threshold: conf.Acceptor.Transport.Send.CompressThreshold, Stream: conf.Acceptor.Transport.Send.CompressStream}
+	c.receiveCodec = protocol.Codec{Serialize: conf.Acceptor.Transport.Receive.Serialize, Compress: conf.Acceptor.Transport.Receive.Compress, Threshold: conf.Acceptor.Transport.Receive.CompressThreshold, Stream: conf.Acceptor.Transport.Receive.CompressStream}
 	// set a capacity N for the data transmission pipeline as a buffer.
 	// if the client has not received it,
-	// the pipeline will always keep the latest N
-	c.out = make(chan []byte, 500)
+	// what to do with the message is decided by the backpressure policy of the acceptor
+	c.out = make(chan []byte, a.backpressure.Capacity)
 	c.stopOut = make(chan bool)
+	c.coalesced = make(map[string][]byte)
+	c.coalescedSignal = make(chan struct{}, 1)
+	c.draining = make(chan struct{})
 	c.rooms = new(sync.Map)
 	c.ping = make(map[int64]bool)
+	c.acks = newPendings()
 }
 
 func (c *Client) Context() context.Context {
@@ -89,9 +167,21 @@ func (c *Client) CloseConnCtx() {
 }
 
 func (c *Client) Id() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.id
 }
 
+func (c *Client) SetId(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id = id
+}
+
+func (c *Client) base() *Client {
+	return c
+}
+
 func (c *Client) RemoteAddr() net.Addr {
 	return c.remoteAddr
 }
@@ -100,6 +190,27 @@ func (c *Client) Acceptor() *Acceptor {
 	return c.acceptor
 }
 
+func (c *Client) Identity() *Identity {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.identity
+}
+
+func (c *Client) PeerCertificate() *x509.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.peerCert
+}
+
+// PeerSubject the subject of the verified client certificate, which is used to authorize the backend services,
+// e.g. c.PeerSubject().CommonName
+func (c *Client) PeerSubject() pkix.Name {
+	if cert := c.PeerCertificate(); cert != nil {
+		return cert.Subject
+	}
+	return pkix.Name{}
+}
+
 func (c *Client) Rooms() map[string]bool {
 	r := make(map[string]bool)
 	c.rooms.Range(func(k, v interface{}) bool {
@@ -151,37 +262,129 @@ func (c *Client) SetRemoteAddr(v net.Addr) {
 	c.remoteAddr = v
 }
 
+func (c *Client) SetIdentity(v *Identity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.identity = v
+}
+
+func (c *Client) SetPeerCertificate(v *x509.Certificate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peerCert = v
+}
+
+// SetCodec set the codec negotiated at connect time, it is used to both send and receive messages,
+// it must be set before the client is served
+func (c *Client) SetCodec(codec protocol.Codec) {
+	c.sendCodec, c.receiveCodec = codec, codec
+}
+
+func (c *Client) SendCodec() protocol.Codec {
+	return c.sendCodec
+}
+
+func (c *Client) ReceiveCodec() protocol.Codec {
+	return c.receiveCodec
+}
+
 func (c *Client) Emit(event string, args interface{}, id string) {
+	c.emit(event, args, id)
+}
+
+// EmitWithAck send message to the client with a random id,
+// the returned channel receives the args of the reply carrying the same id,
+// or an error if the message was not sent, the client was disconnected, or no reply within the timeout.
+// a timeout <= 0 means waiting until the reply or the client disconnected
+func (c *Client) EmitWithAck(event string, args interface{}, timeout time.Duration) <-chan Ack {
+	ack := make(chan Ack, 1)
+	id := newMessageId()
+	reply, _ := c.acks.add(id)
+	if err := c.emit(event, args, id); err != nil {
+		c.acks.remove(id)
+		ack <- Ack{Err: err}
+		return ack
+	}
+	go func() {
+		defer c.acks.remove(id)
+		var expired <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case msg := <-reply:
+			result, err := decodeReply(msg)
+			ack <- Ack{Result: result, Err: err}
+		case <-expired:
+			ack <- Ack{Err: ErrorAckTimeout}
+		case <-c.Context().Done():
+			ack <- Ack{Err: ErrorAckDisconnected}
+		}
+	}()
+	return ack
+}
+
+// ResolveAck deliver the reply to the waiter of EmitWithAck, return false if the message is not a reply
+func (c *Client) ResolveAck(msg *protocol.Message) bool {
+	return c.acks.resolve(msg)
+}
+
+func (c *Client) emit(event string, args interface{}, id string) (err error) {
+	msg, err := c.Acceptor().EncodeCodec(event, args, id, c.sendCodec)
+	if err != nil {
+		log.Println("[GoSocket][Emit] encode error:", err, event, args, id, c.Id(), c.RemoteAddr())
+		return
+	}
+	return c.send(event, msg, true)
+}
+
+// broadcast send message to the client by the rooms, which is never blocked by the Block policy, see SetBackpressure
+func (c *Client) broadcast(event string, args interface{}, id string) {
+	msg, err := c.Acceptor().EncodeCodec(event, args, id, c.sendCodec)
+	if err != nil {
+		log.Println("[GoSocket][broadcast] encode error:", err, event, args, id, c.Id(), c.RemoteAddr())
+		return
+	}
+	c.send(event, msg, false)
+}
+
+// send the encoded message to the send channel, the sender may be blocked by the Block policy if canBlock
+func (c *Client) send(event string, msg []byte, canBlock bool) (err error) {
 	// This is a Insurance measures to avoid "send on closed channel" panic
 	// This is a temporary measure
 	// Usually due to non-compliance with the channel closing principle
 	defer func() {
 		if r := recover(); r != nil {
 			log.Println("gosocket client emit panic: ", r, c.Id(), c.RemoteAddr())
+			err = ErrorEmitClosed
 		}
 	}()
-	msg, err := c.Acceptor().Encode(event, args, id, conf.Acceptor.Transport.Send.Serialize, conf.Acceptor.Transport.Send.Compress)
-	if err != nil {
-		log.Println("[GoSocket][Emit] encode error:", err, event, args, id, c.Id(), c.RemoteAddr())
+	// the client was disconnected, keep the message for the session until resumed
+	if c.buffer(event, msg) {
+		return
+	}
+	// an older message of the event is waiting to be sent, replace it to keep the order
+	if c.acceptor.backpressure.Policy == conf.BackpressureCoalesce && c.isCoalesced(event) {
+		c.coalesce(event, msg)
 		return
 	}
 	select {
 	// 使用连接上下文检查取消状态
 	case <-c.Context().Done():
-		return // 连接已关闭，不再发送
+		return ErrorEmitClosed // 连接已关闭，不再发送
 	case <-c.stopOut:
 		// close(c.out)
 		// The channel of c.out will close itself when there is no goroutine reference
 		// so, no need to close(c.out) here
 		log.Println("receive the stop signal, the socket was closed", c.Id(), c.RemoteAddr())
-		return
+		return ErrorEmitClosed
 	case c.out <- msg:
+		return
 	default:
-		// the capacity of channel was full, data dropped，
-		// it must be sent without blocking here,
-		// in the broadcast scenario, blocking sending will cause the normal network clients to be unable to receive data
-		log.Println("message not sent:", c.id, c.remoteAddr, msg)
 	}
+	return c.overflow(event, msg, canBlock)
 }
 
 func (c *Client) EmitByInitiator(i *Initiator, event string, args interface{}, id string) {
@@ -195,22 +398,34 @@ func (c *Client) EmitByInitiator(i *Initiator, event string, args interface{}, i
 }
 
 func (c *Client) Join(room string) {
-	c.acceptor.rooms.join <- roomClient{room, c}
+	select {
+	case c.acceptor.rooms.join <- roomClient{room, c}:
+	case <-c.acceptor.done:
+	}
 	if conf.Acceptor.Logs.Room.Join {
 		log.Println("[room][join]:", room, c.Id(), c.RemoteAddr())
 	}
 }
 
 func (c *Client) Leave(room string) {
-	c.acceptor.rooms.leave <- roomClient{room, c}
+	select {
+	case c.acceptor.rooms.leave <- roomClient{room, c}:
+	case <-c.acceptor.done:
+	}
 	if conf.Acceptor.Logs.Room.Leave {
 		log.Println("[room][leave]:", room, c.Id(), c.RemoteAddr())
 	}
 }
 
 func (c *Client) LeaveAll() {
-	c.acceptor.rooms.leaveAll <- c
-	c.acceptor.leave <- c
+	select {
+	case c.acceptor.rooms.leaveAll <- c:
+	case <-c.acceptor.done:
+	}
+	select {
+	case c.acceptor.leave <- c:
+	case <-c.acceptor.done:
+	}
 	if conf.Acceptor.Logs.LeaveAll {
 		log.Println("[leaveAll]:", c.Id(), c.RemoteAddr())
 	}
@@ -218,7 +433,7 @@ func (c *Client) LeaveAll() {
 
 func (c *Client) genId() string {
 	custom := c.remoteAddr.String()
-	hash := fmt.Sprintf("%s %s %n %n", custom, time.Now(), rand.Uint32(), rand.Uint32())
+	hash := fmt.Sprintf("%s %s %d %d", custom, time.Now(), rand.Uint32(), rand.Uint32())
 	buf := bytes.NewBuffer(nil)
 	sum := md5.Sum([]byte(hash))
 	encoder := base64.NewEncoder(base64.URLEncoding, buf)
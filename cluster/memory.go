@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"sync"
+
+	"github.com/plhwin/gosocket"
+)
+
+// MemoryHub connects the acceptors of the same process as the nodes of a cluster,
+// it is the reference implementation of gosocket.Adapter and is mainly used for testing
+type MemoryHub struct {
+	mu    sync.RWMutex
+	nodes []*MemoryAdapter
+}
+
+func NewMemoryHub() *MemoryHub {
+	return new(MemoryHub)
+}
+
+// NewAdapter create an adapter as a node of the hub
+func (h *MemoryHub) NewAdapter() *MemoryAdapter {
+	return &MemoryAdapter{hub: h}
+}
+
+func (h *MemoryHub) register(m *MemoryAdapter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nodes = append(h.nodes, m)
+}
+
+func (h *MemoryHub) publish(from *MemoryAdapter, msg *gosocket.AdapterMessage) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, node := range h.nodes {
+		if node != from {
+			node.acceptor.Apply(msg)
+		}
+	}
+}
+
+// MemoryAdapter implements gosocket.Adapter in memory
+type MemoryAdapter struct {
+	hub      *MemoryHub
+	acceptor *gosocket.Acceptor
+}
+
+func (m *MemoryAdapter) Init(a *gosocket.Acceptor) {
+	m.acceptor = a
+	m.hub.register(m)
+}
+
+func (m *MemoryAdapter) Publish(msg *gosocket.AdapterMessage) {
+	m.hub.publish(m, msg)
+}
@@ -0,0 +1,212 @@
+package cluster
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/tcpsocket"
+)
+
+// EventAdapter is the event used to exchange the operations between the nodes
+const EventAdapter = "adapter:message"
+
+const (
+	// the default number of the operations queued for each peer
+	defaultQueueSize = 1024
+	// the timeout of the auth frame sent by the other nodes
+	nodeAuthTimeout = 10 * time.Second
+)
+
+var (
+	ErrorNodeUnauthenticated = errors.New("the links between the nodes must be authenticated by WithSecret or the mutual TLS of WithTLS")
+	ErrorNodeSecret          = errors.New("the secret of the node mismatched")
+)
+
+type tcpOptions struct {
+	secret    string
+	serverTLS *tls.Config
+	clientTLS *tls.Config
+	queueSize int
+}
+
+// TCPOption configures the TCPAdapter
+type TCPOption func(*tcpOptions)
+
+// WithSecret authenticate the links between the nodes by the secret shared by all the nodes,
+// which is sent by the auth frame of each link, see tcpsocket.WithAuthPayload
+func WithSecret(secret string) TCPOption {
+	return func(o *tcpOptions) {
+		o.secret = secret
+	}
+}
+
+// WithTLS authenticate the links between the nodes by the mutual TLS,
+// the server config accepts the links from the other nodes, its ClientAuth must be tls.RequireAndVerifyClientCert,
+// the client config dials the peers with the certificate of the node
+func WithTLS(server, client *tls.Config) TCPOption {
+	return func(o *tcpOptions) {
+		o.serverTLS = server
+		o.clientTLS = client
+	}
+}
+
+// WithQueueSize set the number of the operations queued for each peer, the default is 1024,
+// the operations are dropped if the queue of the peer is full, so that a slow peer never stalls the local acceptor
+func WithQueueSize(n int) TCPOption {
+	return func(o *tcpOptions) {
+		o.queueSize = n
+	}
+}
+
+// TCPAdapter implements gosocket.Adapter over tcp socket without any external broker,
+// every node accepts the operations from the other nodes by a tcpsocket acceptor,
+// and publishes its own operations to each peer by a tcpsocket initiator (full mesh).
+// The links between the nodes follow the transport settings of conf.Acceptor and conf.Initiator,
+// so the send settings of the initiator must match the receive settings of the acceptor
+type TCPAdapter struct {
+	listener   net.Listener                   // accept the connections from the other nodes
+	peers      []string                       // the addresses of the other nodes
+	o          *tcpOptions                    // the authentication of the links and the queue size
+	acceptor   *gosocket.Acceptor             // the local acceptor which the operations are applied to
+	node       *gosocket.Acceptor             // receive the operations from the other nodes
+	initiators map[string]*gosocket.Initiator // publish the operations to the other nodes
+	queues     map[string]chan *gosocket.AdapterMessage
+	dropped    uint64 // the number of the operations dropped by the full queues
+}
+
+// NewTCPAdapter create an adapter that listens on the listener and publishes to the peers,
+// the links between the nodes must be authenticated by WithSecret or WithTLS, otherwise ErrorNodeUnauthenticated is returned
+func NewTCPAdapter(listener net.Listener, peers []string, opts ...TCPOption) (t *TCPAdapter, err error) {
+	o := &tcpOptions{queueSize: defaultQueueSize}
+	for _, opt := range opts {
+		opt(o)
+	}
+	mutualTLS := o.serverTLS != nil && o.clientTLS != nil && o.serverTLS.ClientAuth == tls.RequireAndVerifyClientCert
+	if o.secret == "" && !mutualTLS {
+		return nil, ErrorNodeUnauthenticated
+	}
+	if o.queueSize <= 0 {
+		o.queueSize = defaultQueueSize
+	}
+
+	t = new(TCPAdapter)
+	t.listener = listener
+	t.peers = peers
+	t.o = o
+	t.node = gosocket.NewAcceptor()
+	t.node.On(EventAdapter, t.apply)
+	t.initiators = make(map[string]*gosocket.Initiator)
+	t.queues = make(map[string]chan *gosocket.AdapterMessage)
+	for _, peer := range peers {
+		t.initiators[peer] = gosocket.NewInitiator()
+		t.queues[peer] = make(chan *gosocket.AdapterMessage, o.queueSize)
+	}
+	return
+}
+
+func (t *TCPAdapter) Init(a *gosocket.Acceptor) {
+	t.acceptor = a
+}
+
+// Publish queue the operation for each peer without blocking, it is dropped if the queue of the peer is full
+func (t *TCPAdapter) Publish(msg *gosocket.AdapterMessage) {
+	for peer, queue := range t.queues {
+		select {
+		case queue <- msg:
+		default:
+			atomic.AddUint64(&t.dropped, 1)
+			log.Println("[cluster][tcp] operation dropped, the queue of the peer was full:", peer, msg.Type)
+		}
+	}
+}
+
+// Dropped the number of the operations dropped by the full queues of the peers
+func (t *TCPAdapter) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Run accept the connections from the other nodes and keep connected to the peers,
+// it blocks until the ctx is done
+func (t *TCPAdapter) Run(ctx context.Context) {
+	for peer, i := range t.initiators {
+		go i.Reconnect(ctx, tcpsocket.Dialer("tcp", peer, func() tcpsocket.ConnFace {
+			return new(tcpsocket.Conn)
+		}, t.dialOptions()...), gosocket.DefaultBackoff)
+		go t.send(ctx, i, t.queues[peer])
+	}
+	go func() {
+		<-ctx.Done()
+		t.listener.Close()
+	}()
+	opts := t.serveOptions()
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("[cluster][tcp] accept error:", err)
+			}
+			return
+		}
+		tcpsocket.Serve(ctx, conn, t.node, new(tcpsocket.Client), opts...)
+	}
+}
+
+// send the operations queued for the peer, a slow peer only blocks its own queue
+func (t *TCPAdapter) send(ctx context.Context, i *gosocket.Initiator, queue chan *gosocket.AdapterMessage) {
+	for {
+		select {
+		case msg := <-queue:
+			// the operations are dropped while the peer is not connected
+			i.Emit(EventAdapter, msg, "")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// the options of the links accepted from the other nodes
+func (t *TCPAdapter) serveOptions() (opts []tcpsocket.Option) {
+	if t.o.serverTLS != nil {
+		opts = append(opts, tcpsocket.WithTLS(t.o.serverTLS))
+	}
+	if t.o.secret != "" {
+		opts = append(opts, tcpsocket.WithAuthenticator(t.authenticate, nodeAuthTimeout))
+	}
+	return
+}
+
+// the options of the links dialed to the peers
+func (t *TCPAdapter) dialOptions() (opts []tcpsocket.Option) {
+	if t.o.clientTLS != nil {
+		opts = append(opts, tcpsocket.WithTLS(t.o.clientTLS))
+	}
+	if t.o.secret != "" {
+		opts = append(opts, tcpsocket.WithAuthPayload(t.o.secret))
+	}
+	return
+}
+
+// authenticate the auth frame of the other nodes by the shared secret
+func (t *TCPAdapter) authenticate(msg *protocol.Message) (*gosocket.Identity, error) {
+	var secret string
+	if err := json.Unmarshal([]byte(msg.Args), &secret); err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(t.o.secret)) != 1 {
+		return nil, ErrorNodeSecret
+	}
+	return &gosocket.Identity{}, nil
+}
+
+func (t *TCPAdapter) apply(c gosocket.ClientFace, msg gosocket.AdapterMessage) {
+	t.acceptor.Apply(&msg)
+}
@@ -3,6 +3,7 @@ package conf
 import (
 	"fmt"
 	"log"
+	"sync"
 
 	"github.com/spf13/viper"
 )
@@ -15,39 +16,134 @@ const (
 	// Serialize
 	TransportSerializeText     = "Text"
 	TransportSerializeProtobuf = "Protobuf"
+	TransportSerializeMsgPack  = "MsgPack"
+	TransportSerializeCBOR     = "CBOR"
 
 	// Compress
 	TransportCompressNone   = "None"
 	TransportCompressSnappy = "Snappy"
 	TransportCompressFLate  = "FLate"
 	TransportCompressGzip   = "Gzip"
+	TransportCompressLZ4    = "LZ4"
+	TransportCompressZstd   = "Zstd"
+
+	// Text protocol, how the messages are formatted by the Text serialize
+	TextProtocolJSONArray  = "JSONArray"  // ["event",args,"id"]
+	TextProtocolJSONObject = "JSONObject" // {"e":"event","a":args,"i":"id"}
+	TextProtocolSocketIO   = "SocketIO"   // the Socket.IO v4 packet, e.g. 2["event",args]
+	TextProtocolSTOMP      = "STOMP"      // the STOMP like frame, the event is the destination header
+
+	// Backpressure policy, what to do when the message send channel of the client is full
+	BackpressureDropNewest = "DropNewest" // drop the message being sent
+	BackpressureDropOldest = "DropOldest" // drop the oldest message in the channel, keep the latest N
+	BackpressureBlock      = "Block"      // block the sender until the message is sent or timeout
+	BackpressureDisconnect = "Disconnect" // disconnect the slow consumer
+	BackpressureCoalesce   = "Coalesce"   // keep only the latest message of each event until the channel is available
 )
 
 var (
 	Acceptor  acceptor
 	Initiator initiator
+
+	// guards the names can be selected, which may be registered while the connections are served
+	namesMu sync.RWMutex
+	// the serialize types can be selected, see RegisterSerialize
+	serializations = []string{TransportSerializeText, TransportSerializeProtobuf, TransportSerializeMsgPack, TransportSerializeCBOR}
+	// the compress types can be selected, see RegisterCompress
+	compresses = []string{TransportCompressNone, TransportCompressSnappy, TransportCompressFLate, TransportCompressGzip, TransportCompressLZ4, TransportCompressZstd}
+	// the text protocols can be selected, see RegisterTextProtocol
+	textProtocols = []string{TextProtocolJSONArray, TextProtocolJSONObject, TextProtocolSocketIO, TextProtocolSTOMP}
 )
 
+// RegisterSerialize allow the serialize type to be selected, see protocol.RegisterSerializer
+func RegisterSerialize(name string) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	for _, v := range serializations {
+		if v == name {
+			return
+		}
+	}
+	serializations = append(serializations, name)
+}
+
+// RegisterCompress allow the compress type to be selected, see protocol.RegisterCompressor
+func RegisterCompress(name string) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	for _, v := range compresses {
+		if v == name {
+			return
+		}
+	}
+	compresses = append(compresses, name)
+}
+
+// RegisterTextProtocol allow the text protocol to be selected, see protocol.RegisterTextProtocol
+func RegisterTextProtocol(name string) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	for _, v := range textProtocols {
+		if v == name {
+			return
+		}
+	}
+	textProtocols = append(textProtocols, name)
+}
+
+// SelectSerialize the serialize type selected by the config value, Text if it can not be selected
+func SelectSerialize(s string) string {
+	namesMu.RLock()
+	defer namesMu.RUnlock()
+	return getVal(s, serializations, TransportSerializeText)
+}
+
+// SelectCompress the compress type selected by the config value, None if it can not be selected
+func SelectCompress(s string) string {
+	namesMu.RLock()
+	defer namesMu.RUnlock()
+	return getVal(s, compresses, TransportCompressNone)
+}
+
+// SelectTextProtocol the text protocol selected by the config value, JSONArray if it can not be selected
+func SelectTextProtocol(s string) string {
+	namesMu.RLock()
+	defer namesMu.RUnlock()
+	return getVal(s, textProtocols, TextProtocolJSONArray)
+}
+
 type acceptor struct {
-	Transport transport
-	Websocket websocket
-	Heartbeat heartbeat
-	Logs      logs
+	Transport    transport
+	Websocket    websocket
+	Heartbeat    heartbeat
+	Backpressure backpressure
+	Resume       resume
+	Logs         logs
 }
 
 type transport struct {
-	Send    transportConfig
-	Receive transportConfig
+	Send           transportConfig
+	Receive        transportConfig
+	MaxMessageSize int
+	TextProtocol   string
 }
 
 type transportConfig struct {
-	Serialize string
-	Compress  string
+	Serialize         string
+	Compress          string
+	CompressThreshold int
+	CompressStream    bool
 }
 
 type websocket struct {
 	MessageType          string
 	RemoteAddrHeaderName string
+	AllowedOrigins       []string
+	Subprotocols         []string
+	ReadBufferSize       int
+	WriteBufferSize      int
+	EnableCompression    bool
+	HandshakeTimeout     int
 }
 
 type heartbeat struct {
@@ -55,6 +151,17 @@ type heartbeat struct {
 	PingMaxTimes int
 }
 
+type backpressure struct {
+	Policy       string
+	Capacity     int
+	BlockTimeout int64
+}
+
+type resume struct {
+	Grace      int
+	BufferSize int
+}
+
 type logs struct {
 	Heartbeat heartbeatLogs
 	Room      room
@@ -76,9 +183,14 @@ type room struct {
 type initiator struct {
 	Transport transport
 	Websocket websocket
+	EmitSync  emitSync
 	Logs      logs
 }
 
+type emitSync struct {
+	Timeout int
+}
+
 func Init(configFile string) {
 	viper.SetConfigFile(configFile)
 	if err := viper.ReadInConfig(); err != nil {
@@ -89,28 +201,48 @@ func Init(configFile string) {
 
 func initConf() {
 	websocketMessageTypes := []string{WebsocketMessageTypeText, WebsocketMessageTypeBinary}
-	serializations := []string{TransportSerializeText, TransportSerializeProtobuf}
-	compresses := []string{TransportCompressNone, TransportCompressSnappy, TransportCompressFLate, TransportCompressGzip}
+	backpressurePolicies := []string{BackpressureDropNewest, BackpressureDropOldest, BackpressureBlock, BackpressureDisconnect, BackpressureCoalesce}
 
 	Acceptor = acceptor{
 		Transport: transport{
 			Send: transportConfig{
-				Serialize: getVal(viper.GetString("acceptor.transport.send.serialize"), serializations, TransportSerializeText),
-				Compress:  getVal(viper.GetString("acceptor.transport.send.compress"), compresses, TransportCompressNone),
+				Serialize:         SelectSerialize(viper.GetString("acceptor.transport.send.serialize")),
+				Compress:          SelectCompress(viper.GetString("acceptor.transport.send.compress")),
+				CompressThreshold: viper.GetInt("acceptor.transport.send.compressThreshold"),
+				CompressStream:    viper.GetBool("acceptor.transport.send.compressStream"),
 			},
 			Receive: transportConfig{
-				Serialize: getVal(viper.GetString("acceptor.transport.receive.serialize"), serializations, TransportSerializeText),
-				Compress:  getVal(viper.GetString("acceptor.transport.receive.compress"), compresses, TransportCompressNone),
+				Serialize:         SelectSerialize(viper.GetString("acceptor.transport.receive.serialize")),
+				Compress:          SelectCompress(viper.GetString("acceptor.transport.receive.compress")),
+				CompressThreshold: viper.GetInt("acceptor.transport.receive.compressThreshold"),
+				CompressStream:    viper.GetBool("acceptor.transport.receive.compressStream"),
 			},
+			MaxMessageSize: viper.GetInt("acceptor.transport.maxMessageSize"),
+			TextProtocol:   SelectTextProtocol(viper.GetString("acceptor.transport.textProtocol")),
 		},
 		Websocket: websocket{
 			MessageType:          getVal(viper.GetString("acceptor.websocket.messageType"), websocketMessageTypes, WebsocketMessageTypeText),
 			RemoteAddrHeaderName: viper.GetString("acceptor.websocket.remoteAddrHeaderName"),
+			AllowedOrigins:       viper.GetStringSlice("acceptor.websocket.allowedOrigins"),
+			Subprotocols:         viper.GetStringSlice("acceptor.websocket.subprotocols"),
+			ReadBufferSize:       viper.GetInt("acceptor.websocket.readBufferSize"),
+			WriteBufferSize:      viper.GetInt("acceptor.websocket.writeBufferSize"),
+			EnableCompression:    viper.GetBool("acceptor.websocket.enableCompression"),
+			HandshakeTimeout:     viper.GetInt("acceptor.websocket.handshakeTimeout"),
 		},
 		Heartbeat: heartbeat{
 			PingInterval: viper.GetInt("acceptor.heartbeat.pingInterval"),
 			PingMaxTimes: viper.GetInt("acceptor.heartbeat.pingMaxTimes"),
 		},
+		Backpressure: backpressure{
+			Policy:       getVal(viper.GetString("acceptor.backpressure.policy"), backpressurePolicies, BackpressureDropNewest),
+			Capacity:     viper.GetInt("acceptor.backpressure.capacity"),
+			BlockTimeout: viper.GetInt64("acceptor.backpressure.blockTimeout"),
+		},
+		Resume: resume{
+			Grace:      viper.GetInt("acceptor.resume.grace"),
+			BufferSize: viper.GetInt("acceptor.resume.bufferSize"),
+		},
 		Logs: logs{
 			Heartbeat: heartbeatLogs{
 				PingSend:           viper.GetBool("acceptor.logs.heartbeat.pingSend"),
@@ -128,17 +260,26 @@ func initConf() {
 	Initiator = initiator{
 		Transport: transport{
 			Send: transportConfig{
-				Serialize: getVal(viper.GetString("initiator.transport.send.serialize"), serializations, TransportSerializeText),
-				Compress:  getVal(viper.GetString("initiator.transport.send.compress"), compresses, TransportCompressNone),
+				Serialize:         SelectSerialize(viper.GetString("initiator.transport.send.serialize")),
+				Compress:          SelectCompress(viper.GetString("initiator.transport.send.compress")),
+				CompressThreshold: viper.GetInt("initiator.transport.send.compressThreshold"),
+				CompressStream:    viper.GetBool("initiator.transport.send.compressStream"),
 			},
 			Receive: transportConfig{
-				Serialize: getVal(viper.GetString("initiator.transport.receive.serialize"), serializations, TransportSerializeText),
-				Compress:  getVal(viper.GetString("initiator.transport.receive.compress"), compresses, TransportCompressNone),
+				Serialize:         SelectSerialize(viper.GetString("initiator.transport.receive.serialize")),
+				Compress:          SelectCompress(viper.GetString("initiator.transport.receive.compress")),
+				CompressThreshold: viper.GetInt("initiator.transport.receive.compressThreshold"),
+				CompressStream:    viper.GetBool("initiator.transport.receive.compressStream"),
 			},
+			MaxMessageSize: viper.GetInt("initiator.transport.maxMessageSize"),
+			TextProtocol:   SelectTextProtocol(viper.GetString("initiator.transport.textProtocol")),
 		},
 		Websocket: websocket{
 			MessageType: getVal(viper.GetString("initiator.websocket.messageType"), websocketMessageTypes, WebsocketMessageTypeText),
 		},
+		EmitSync: emitSync{
+			Timeout: viper.GetInt("initiator.emitSync.timeout"),
+		},
 		Logs: logs{
 			Heartbeat: heartbeatLogs{
 				PingReceive: viper.GetBool("initiator.logs.heartbeat.pingReceive"),
@@ -147,6 +288,14 @@ func initConf() {
 		},
 	}
 
+	// set default value for the max message size, see protocol.DefaultMaxFrameSize
+	if Acceptor.Transport.MaxMessageSize <= 0 {
+		Acceptor.Transport.MaxMessageSize = 4 * 1024 * 1024
+	}
+	if Initiator.Transport.MaxMessageSize <= 0 {
+		Initiator.Transport.MaxMessageSize = 4 * 1024 * 1024
+	}
+
 	// set default value for acceptor heartbeat
 	if Acceptor.Heartbeat.PingInterval <= 0 {
 		Acceptor.Heartbeat.PingInterval = 5
@@ -155,6 +304,24 @@ func initConf() {
 		Acceptor.Heartbeat.PingMaxTimes = 2
 	}
 
+	// set default value for acceptor backpressure
+	if Acceptor.Backpressure.Capacity <= 0 {
+		Acceptor.Backpressure.Capacity = 500
+	}
+	if Acceptor.Backpressure.BlockTimeout <= 0 {
+		Acceptor.Backpressure.BlockTimeout = 1000
+	}
+
+	// set default value for acceptor session resumption
+	if Acceptor.Resume.BufferSize <= 0 {
+		Acceptor.Resume.BufferSize = 100
+	}
+
+	// set default value for initiator emit sync
+	if Initiator.EmitSync.Timeout <= 0 {
+		Initiator.EmitSync.Timeout = 10
+	}
+
 	log.Printf("[gosocket][config]:\nAcceptor: %+v \nInitiator: %+v \n\n", Acceptor, Initiator)
 }
 
@@ -1,10 +1,23 @@
 package gosocket
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"log"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+)
+
+var (
+	ErrorEmitSyncTimeout      = errors.New("emit sync timeout, no reply from the peer")
+	ErrorEmitSyncDisconnected = errors.New("emit sync failed, the connection was closed")
+	ErrorEmitSyncDuplicateId  = errors.New("emit sync failed, another message of the same id is waiting for the reply")
+	ErrorEmitClosedConn       = errors.New("message not sent, the connection was closed")
 )
 
 type ConnFace interface {
@@ -14,6 +27,8 @@ type ConnFace interface {
 	EmitByAcceptor(*Acceptor, string, ArgsResponse, string)    // send message to socket client by acceptor instance
 	Id() string                                                // get the Conn id
 	RemoteAddr() net.Addr                                      // the ip:port of Conn
+	PeerCertificate() *x509.Certificate                        // the server certificate verified by the TLS handshake, nil if not verified
+	PeerSubject() pkix.Name                                    // the subject of the verified server certificate, empty if not verified
 	Initiator() *Initiator                                     // get *Initiator
 	Ping() map[int64]bool                                      // get ping
 	Delay() int64                                              // obtain a time delay that reflects the quality of the connection between the two ends
@@ -22,15 +37,28 @@ type ConnFace interface {
 	SetPing(map[int64]bool)                                    // set ping
 	SetDelay(int64)                                            // set delay
 	SetRemoteAddr(net.Addr)                                    // set remoteAddr
+	SetPeerCertificate(*x509.Certificate)                      // set the server certificate verified by the TLS handshake
+	SetCodec(protocol.Codec)                                   // set the codec to negotiate with the server, before receiving
+	SendCodec() protocol.Codec                                 // the codec to encode the messages sent to the server
+	ReceiveCodec() protocol.Codec                              // the codec to decode the messages received from the server
+	Negotiated() bool                                          // whether the codec was set to negotiate with the server
+	StreamZip([]byte) ([]byte, error)                          // compress the message by the compression stream before writing
+	StreamUnzip([]byte) ([]byte, error)                        // decompress the message by the compression stream after reading
 }
 
 type Conn struct {
-	id         string         // Conn id
-	remoteAddr net.Addr       // Conn remoteAddr
-	initiator  *Initiator     // event processing function register
-	out        chan []byte    // message send channel
-	ping       map[int64]bool // ping
-	delay      int64          // delay
+	id           string            // Conn id
+	remoteAddr   net.Addr          // Conn remoteAddr
+	peerCert     *x509.Certificate // the server certificate verified by the TLS handshake
+	initiator    *Initiator        // event processing function register
+	out          chan []byte       // message send channel
+	ping         map[int64]bool    // ping
+	delay        int64             // delay
+	mu           sync.RWMutex      // mutex
+	sendCodec    protocol.Codec    // the codec of the messages sent to the server
+	receiveCodec protocol.Codec    // the codec of the messages received from the server
+	negotiated   bool              // whether the codec was set to negotiate with the server
+	streams      streams           // the compression streams of the connection if the codec is streamed
 }
 
 func (c *Conn) Init(i *Initiator) {
@@ -38,9 +66,16 @@ func (c *Conn) Init(i *Initiator) {
 	// set a capacity N for the data transmission pipeline as a buffer. if the Conn has not received it, the pipeline will always keep the latest N
 	c.out = make(chan []byte, 500)
 	c.ping = make(map[int64]bool)
+	// the codec defaults to the conf if not negotiated
+	if !c.negotiated {
+		c.sendCodec = protocol.Codec{Serialize: conf.Initiator.Transport.Send.Serialize, Compress: conf.Initiator.Transport.Send.Compress, Threshold: conf.Initiator.Transport.Send.CompressThreshold, Stream: conf.Initiator.Transport.Send.CompressStream}
+		c.receiveCodec = protocol.Codec{Serialize: conf.Initiator.Transport.Receive.Serialize, Compress: conf.Initiator.Transport.Receive.Compress, Threshold: conf.Initiator.Transport.Receive.CompressThreshold, Stream: conf.Initiator.Transport.Receive.CompressStream}
+	}
 }
 
 func (c *Conn) Id() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.id
 }
 
@@ -48,15 +83,33 @@ func (c *Conn) RemoteAddr() net.Addr {
 	return c.remoteAddr
 }
 
+func (c *Conn) PeerCertificate() *x509.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.peerCert
+}
+
+// PeerSubject the subject of the verified server certificate, e.g. c.PeerSubject().CommonName
+func (c *Conn) PeerSubject() pkix.Name {
+	if cert := c.PeerCertificate(); cert != nil {
+		return cert.Subject
+	}
+	return pkix.Name{}
+}
+
 func (c *Conn) Initiator() *Initiator {
 	return c.initiator
 }
 
 func (c *Conn) Ping() map[int64]bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.ping
 }
 
 func (c *Conn) Delay() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.delay
 }
 
@@ -65,14 +118,20 @@ func (c *Conn) Out() chan []byte {
 }
 
 func (c *Conn) SetId(v string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.id = v
 }
 
 func (c *Conn) SetPing(v map[int64]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.ping = v
 }
 
 func (c *Conn) SetDelay(v int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.delay = v
 }
 
@@ -80,26 +139,100 @@ func (c *Conn) SetRemoteAddr(v net.Addr) {
 	c.remoteAddr = v
 }
 
+func (c *Conn) SetPeerCertificate(v *x509.Certificate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peerCert = v
+}
+
+// SetCodec set the codec to negotiate with the server, it is used to both send and receive messages,
+// it must be set before receiving on the connection, e.g. in the factory of the Dialer
+func (c *Conn) SetCodec(codec protocol.Codec) {
+	c.sendCodec, c.receiveCodec = codec, codec
+	c.negotiated = true
+}
+
+func (c *Conn) SendCodec() protocol.Codec {
+	return c.sendCodec
+}
+
+func (c *Conn) ReceiveCodec() protocol.Codec {
+	return c.receiveCodec
+}
+
+func (c *Conn) Negotiated() bool {
+	return c.negotiated
+}
+
 // Asynchronous Emit
 func (c *Conn) Emit(event string, args interface{}, id string) {
+	c.emit(event, args, id, nil)
+}
+
+// emit encode the message and send it to the send channel, return the error if the message was not sent,
+// it gives up waiting for the send channel when the timeout fires, a nil timeout waits until sent
+func (c *Conn) emit(event string, args interface{}, id string, timeout <-chan time.Time) (err error) {
 	// This is a Insurance measures to avoid "send on closed channel" panic
 	// This is a temporary measure
 	// Usually due to non-compliance with the channel closing principle
 	defer func() {
 		if r := recover(); r != nil {
 			log.Println("gosocket conn emit panic: ", r, c.Id(), c.RemoteAddr())
+			err = ErrorEmitClosedConn
 		}
 	}()
-	msg, err := c.Initiator().Encode(event, args, id, conf.Initiator.Transport.Send.Serialize, conf.Initiator.Transport.Send.Compress)
+	msg, err := c.Initiator().EncodeCodec(event, args, id, c.sendCodec)
 	if err != nil {
 		log.Println("Emit encode error:", err, event, args, id, c.Id(), c.RemoteAddr())
 		return
 	}
-	c.out <- msg
+	select {
+	case c.out <- msg:
+	case <-timeout:
+		err = ErrorEmitSyncTimeout
+	}
+	return
 }
 
 // Synchronize Emit
+// send the message with the id (a random id is generated if it is empty),
+// then wait for the reply which carrying the same id from the peer,
+// the args of the reply is decoded into result
 func (c *Conn) EmitSync(event string, args interface{}, id string) (result interface{}, err error) {
+	i := c.Initiator()
+	if !i.Alive() {
+		err = ErrorEmitSyncDisconnected
+		return
+	}
+	if id == "" {
+		id = newMessageId()
+	}
+	reply, ok := i.replies.add(id)
+	if !ok {
+		err = ErrorEmitSyncDuplicateId
+		return
+	}
+	defer i.replies.remove(id)
+
+	// the timeout covers both sending the message and waiting for the reply
+	timer := time.NewTimer(time.Duration(conf.Initiator.EmitSync.Timeout) * time.Second)
+	defer timer.Stop()
+
+	// the message was not sent, no reply will arrive
+	if err = c.emit(event, args, id, timer.C); err != nil {
+		return
+	}
+
+	select {
+	case msg, ok := <-reply:
+		if !ok {
+			err = ErrorEmitSyncDisconnected
+			return
+		}
+		result, err = decodeReply(msg)
+	case <-timer.C:
+		err = ErrorEmitSyncTimeout
+	}
 	return
 }
 
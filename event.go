@@ -5,6 +5,7 @@ import (
 	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/plhwin/gosocket/protocol"
 )
@@ -13,6 +14,7 @@ const (
 	OnConnection    = "connection"
 	OnDisconnection = "disconnection"
 	EventSocketId   = "socket:id"
+	EventAuth       = "auth" // the first frame sent by the tcp socket initiator if the acceptor requires authentication
 	EventPing       = "ping"
 	EventPong       = "pong"
 )
@@ -25,6 +27,9 @@ type events struct {
 	messageHandlersLock sync.RWMutex
 	onConnection        systemHandler
 	onDisconnection     systemHandler
+	middlewares         []Middleware // wrap the handler of every incoming message
+	handler             HandlerFunc  // the handler wrapped by the middlewares
+	oversized           uint64       // the number of connections closed by the oversized or malformed messages
 }
 
 func (e *events) initEvents() {
@@ -43,6 +48,16 @@ func (e *events) On(event string, f interface{}) {
 	e.messageHandlers[event] = c
 }
 
+// AddOversized count the connection closed by the oversized or malformed message, called by the transports
+func (e *events) AddOversized() {
+	atomic.AddUint64(&e.oversized, 1)
+}
+
+// Oversized the number of connections closed by the oversized or malformed messages
+func (e *events) Oversized() uint64 {
+	return atomic.LoadUint64(&e.oversized)
+}
+
 // findEvent find the event handler function from the map of event handler functions registered to the system
 func (e *events) findEvent(event string) (*caller, bool) {
 	e.messageHandlersLock.RLock()
@@ -66,8 +81,18 @@ func (e *events) CallGivenEvent(c interface{}, event string) {
 	f.callFunc(c, &struct{}{}, "")
 }
 
-// CallEvent call event processing function by incoming message
+// CallEvent call event processing function by incoming message,
+// the message goes through the middlewares before that
 func (e *events) CallEvent(client interface{}, msg *protocol.Message) {
+	// 如果服务端处理某个具体客户端的某个具体事件需要耗费大量时间，
+	// 如果这里不并发处理，该客户端在事件处理完成前，会无法接受和响应客户端的其他事件（如：心跳，test等），
+	// 没有及时处理客户端的心跳，则会导致该客户端重连
+	// @todo 并发安全性大规模测试
+	go e.chain()(client, msg)
+}
+
+// dispatch decode the args of the message and call the event processing function
+func (e *events) dispatch(client interface{}, msg *protocol.Message) {
 	f, ok := e.findEvent(msg.Event)
 	if !ok {
 		// the system does not register a event process function,
@@ -78,7 +103,15 @@ func (e *events) CallEvent(client interface{}, msg *protocol.Message) {
 	var args interface{}
 	var id string
 
-	if f.ArgsPresent {
+	if f.Proto && (len(msg.Data) > 0 || msg.Args == "") {
+		// the second input parameter is a proto.Message, and the args was sent as the binary data,
+		// the empty proto.Message is sent without any data
+		var err error
+		if args, err = f.getProtoArgs(msg.Data); err != nil {
+			log.Println("protobuf decode error:", msg.Event, err)
+			// if decode error, not return here, the same as the json decode error
+		}
+	} else if f.ArgsPresent {
 		// the second input parameter with registered event handler function
 		// the data type of the second parameter passed by the event handler function
 		args = f.getArgs()
@@ -100,9 +133,5 @@ func (e *events) CallEvent(client interface{}, msg *protocol.Message) {
 		id = msg.Id
 	}
 
-	// 如果服务端处理某个具体客户端的某个具体事件需要耗费大量时间，
-	// 如果这里不并发处理，该客户端在事件处理完成前，会无法接受和响应客户端的其他事件（如：心跳，test等），
-	// 没有及时处理客户端的心跳，则会导致该客户端重连
-	// @todo 并发安全性大规模测试
-	go f.callFunc(client, args, id)
+	f.callFunc(client, args, id)
 }
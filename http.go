@@ -0,0 +1,46 @@
+package gosocket
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/plhwin/gosocket/conf"
+)
+
+// RemoteAddr the remote address of the http request, consider proxy:
+// use custom header name and controlled by the developers to avoid fake IP, see conf.Acceptor.Websocket.RemoteAddrHeaderName,
+// only set the name when the proxy is turned on, the header value should be contained two parts, the format is ip:port,
+// it is shared by the transports served over http, e.g. websocket, polling, sse and socketio
+func RemoteAddr(r *http.Request) net.Addr {
+	if conf.Acceptor.Websocket.RemoteAddrHeaderName != "" {
+		if addr, ok := parseAddr(r.Header.Get(conf.Acceptor.Websocket.RemoteAddrHeaderName)); ok {
+			return addr
+		}
+	}
+	addr, _ := parseAddr(r.RemoteAddr)
+	return addr
+}
+
+// parseAddr parse the address formatted as ip:port, the empty address is returned if malformed
+func parseAddr(s string) (*net.TCPAddr, bool) {
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return &net.TCPAddr{}, false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return &net.TCPAddr{}, false
+	}
+	return &net.TCPAddr{IP: net.ParseIP(host), Port: port}, true
+}
+
+// NewSessionId generate a random session id, which is unguessable and safe in the url,
+// it is shared by the transports of the sessions over http, e.g. polling, sse and socketio
+func NewSessionId() string {
+	b := make([]byte, 15)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -13,10 +13,13 @@ import (
 func NewInitiator() (i *Initiator) {
 	i = new(Initiator)
 	i.initEvents()
+	i.replies = newPendings()
+	i.subscriptions = make(map[string]subscription)
 	i.onDisconnection = i.onDisConn
-	i.SetProtocol(nil) // set default protocol
+	i.SetProtocol(protocol.GetTextProtocol(conf.Initiator.Transport.TextProtocol)) // set the text protocol selected, the default is used if not found
 
 	i.On(EventSocketId, i.socketId)
+	i.On(EventResumeToken, i.resumeToken)
 	i.On(EventPing, i.ping)
 	i.On(EventPong, i.pong)
 	return
@@ -25,18 +28,63 @@ func NewInitiator() (i *Initiator) {
 type Initiator struct {
 	events
 	protocol.Protocol
-	conn  ConnFace
-	alive bool
-	mu    sync.RWMutex // mutex
+	conn    ConnFace
+	alive   bool
+	replies *pendings    // messages sent by EmitSync which are waiting for the reply
+	mu      sync.RWMutex // mutex
+
+	disconnected      chan struct{}           // closed after the current connection was closed
+	closed            ConnFace                // the connection closed before it was set by SetConn
+	subscriptions     map[string]subscription // replayed after each reconnection
+	subscriptionKeys  []string                // the keys of subscriptions in order
+	offlineBuffer     []offlineMessage        // the messages emitted while disconnected
+	offlineBufferSize int                     // the max number of messages buffered while disconnected
+	session           *ResumeToken            // the resume token of the current session
+	previous          *ResumeToken            // the resume token of the session before disconnected
+}
+
+type offlineMessage struct {
+	event string
+	args  interface{}
+	id    string
 }
 
 func (i *Initiator) SetConn(c ConnFace) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	i.conn = c
-	i.setAlive(true)
+	i.disconnected = make(chan struct{})
+	// the connection was closed before it was set, e.g. the server closed it immediately after accepted
+	if i.closed != nil && i.closed == c {
+		i.closed = nil
+		i.alive = false
+		close(i.disconnected)
+		return
+	}
+	i.alive = true
 }
 
-func (i *Initiator) onDisConn(interface{}) {
-	i.setAlive(false)
+func (i *Initiator) onDisConn(f interface{}) {
+	c, _ := f.(ConnFace)
+	i.mu.Lock()
+	if c != nil && c != i.conn {
+		// the receiving goroutines started before SetConn, let SetConn know it was closed
+		i.closed = c
+		i.mu.Unlock()
+		return
+	}
+	i.alive = false
+	if i.disconnected != nil {
+		close(i.disconnected)
+		i.disconnected = nil
+	}
+	// try to resume the session by the next connection
+	if i.session != nil {
+		i.previous, i.session = i.session, nil
+	}
+	i.mu.Unlock()
+	// the replies will never arrive, wake up all the waiters of EmitSync
+	i.replies.clear()
 }
 
 func (i *Initiator) Alive() bool {
@@ -45,21 +93,46 @@ func (i *Initiator) Alive() bool {
 	return i.alive
 }
 
-func (i *Initiator) setAlive(b bool) {
-	i.mu.Lock()
-	defer i.mu.Unlock()
-	i.alive = b
-}
-
+// Emit send message to the server,
+// the message is buffered while disconnected if the offline buffer is set, otherwise it is dropped
 func (i *Initiator) Emit(event string, args interface{}, id string) {
 	if i.Alive() {
-		i.conn.Emit(event, args, id)
+		i.Conn().Emit(event, args, id)
+		return
+	}
+	i.buffer(event, args, id)
+}
+
+// Conn get the current connection
+func (i *Initiator) Conn() ConnFace {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.conn
+}
+
+// EmitSync send message to the server and wait for the reply, see Conn.EmitSync
+func (i *Initiator) EmitSync(event string, args interface{}, id string) (interface{}, error) {
+	if !i.Alive() {
+		return nil, ErrorEmitSyncDisconnected
+	}
+	return i.Conn().EmitSync(event, args, id)
+}
+
+// CallEvent deliver the reply to the waiter of EmitSync if the message id matched,
+// otherwise call the event processing function
+func (i *Initiator) CallEvent(c interface{}, msg *protocol.Message) {
+	if i.replies.resolve(msg) {
+		return
 	}
+	i.events.CallEvent(c, msg)
 }
 
-// After receive the SocketId event, call OnConnection
+// After receive the SocketId event, resume the previous session if possible,
+// replay the subscriptions and send the buffered messages, then call OnConnection.
+// The subscriptions are not replayed if the session was resumed, since the server restored the rooms
 func (i *Initiator) socketId(c ConnFace, id string) {
 	c.SetId(id)
+	i.replay(c, !i.resumeSession(c))
 	c.Initiator().CallGivenEvent(c, OnConnection)
 }
 
@@ -0,0 +1,68 @@
+package gosocket
+
+import (
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/plhwin/gosocket/protocol"
+)
+
+// HandlerFunc process the incoming message,
+// c is the ClientFace for the acceptor, and the ConnFace for the initiator
+type HandlerFunc func(c interface{}, msg *protocol.Message)
+
+// Middleware wraps the handler of every incoming message,
+// it can do something before and after calling next, or short-circuit the call by not calling next,
+// e.g. reply a failure by NewResponse(c.(ClientFace), msg.Event, "", msg.Id).Fail("unauthorized")
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Use append the middlewares, the first one is the outermost
+func (e *events) Use(middlewares ...Middleware) {
+	e.messageHandlersLock.Lock()
+	defer e.messageHandlersLock.Unlock()
+	e.middlewares = append(e.middlewares, middlewares...)
+	// build the chain from the innermost
+	handler := HandlerFunc(e.dispatch)
+	for n := len(e.middlewares) - 1; n >= 0; n-- {
+		handler = e.middlewares[n](handler)
+	}
+	e.handler = handler
+}
+
+// chain get the handler wrapped by the middlewares
+func (e *events) chain() HandlerFunc {
+	e.messageHandlersLock.RLock()
+	defer e.messageHandlersLock.RUnlock()
+	if e.handler == nil {
+		return e.dispatch
+	}
+	return e.handler
+}
+
+// Recover recover from the panic of the event processing function, log it with the stack
+func Recover() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c interface{}, msg *protocol.Message) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Println("[middleware][recover] event panic:", r, msg.Event, msg.Args, msg.Id, string(debug.Stack()))
+				}
+			}()
+			next(c, msg)
+		}
+	}
+}
+
+// Timing log the event whose processing time is not less than the threshold
+func Timing(threshold time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c interface{}, msg *protocol.Message) {
+			start := time.Now()
+			next(c, msg)
+			if elapsed := time.Since(start); elapsed >= threshold {
+				log.Println("[middleware][timing] event:", msg.Event, msg.Id, elapsed)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package gosocket
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+
+	"github.com/plhwin/gosocket/protocol"
+)
+
+// pendings keeps the messages that are waiting for a reply,
+// a reply from the peer is matched by carrying the same message id
+type pendings struct {
+	mu      sync.Mutex
+	waiters map[string]chan *protocol.Message // map[message id]reply channel
+}
+
+func newPendings() *pendings {
+	return &pendings{waiters: make(map[string]chan *protocol.Message)}
+}
+
+// add register a waiter for the message id, the reply will be delivered to the returned channel,
+// the channel is closed without any value if the waiter is cleared.
+// return false if another waiter of the same id is still waiting, the waiting one is kept
+func (p *pendings) add(id string) (chan *protocol.Message, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.waiters[id]; ok {
+		return nil, false
+	}
+	reply := make(chan *protocol.Message, 1)
+	p.waiters[id] = reply
+	return reply, true
+}
+
+// remove the waiter of the message id, usually called when the waiter gives up
+func (p *pendings) remove(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.waiters, id)
+}
+
+// resolve deliver the message to its waiter, return false if no one is waiting for it
+func (p *pendings) resolve(msg *protocol.Message) bool {
+	if msg.Id == "" {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	reply, ok := p.waiters[msg.Id]
+	if !ok {
+		return false
+	}
+	delete(p.waiters, msg.Id)
+	reply <- msg
+	return true
+}
+
+// clear wake up all the waiters with a closed channel, usually called when the connection was closed
+func (p *pendings) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, reply := range p.waiters {
+		close(reply)
+		delete(p.waiters, id)
+	}
+}
+
+// newMessageId generate a random message id used to match the reply
+func newMessageId() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeReply decode the args of the reply message,
+// the binary data is returned as []byte if the args was sent as a proto.Message
+func decodeReply(msg *protocol.Message) (result interface{}, err error) {
+	if len(msg.Data) > 0 {
+		return msg.Data, nil
+	}
+	if msg.Args != "" {
+		err = json.Unmarshal([]byte(msg.Args), &result)
+	}
+	return
+}
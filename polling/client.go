@@ -0,0 +1,380 @@
+package polling
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+)
+
+const (
+	// SessionParam is the query param of the session id, e.g. "http://example.com/poll?sid=xxx"
+	SessionParam = "sid"
+	// SessionHeader is the response header of the handshake, which carries the session id
+	SessionHeader = "X-Gosocket-Session"
+	// CodecParam is the query param of the handshake to negotiate the codec, e.g. "http://example.com/poll?codec=Protobuf.Snappy"
+	CodecParam = "codec"
+
+	// the size of the read buffer, the frames not larger than it are read without copy
+	readBufferSize = 4096
+	// the max number of the queued messages written in one response
+	maxBatchSize = 64
+)
+
+type ClientFace interface {
+	gosocket.ClientFace
+	init(context.Context, *gosocket.Acceptor, *http.Request, *options) // init the client
+	Close()                                                            // close the session
+	SetIdentity(*gosocket.Identity)                                    // set the authenticated identity
+	SetPeerCertificate(*x509.Certificate)                              // set the client certificate verified by the TLS handshake
+	SetCodec(protocol.Codec)                                           // set the codec negotiated by the handshake request
+	sid() string
+	poll(http.ResponseWriter, *http.Request)
+	receive(ClientFace, http.ResponseWriter, *http.Request)
+	run(ClientFace, *Handler)
+}
+
+// Client the client of the HTTP long-polling transport,
+// the messages are sent by the responses of the poll requests (GET), and received by the POST requests
+type Client struct {
+	gosocket.Client
+	id        string      // the session id
+	o         *options    // the options of the handler
+	control   chan []byte // the ping messages, which are sent by the next poll
+	polling   int32       // a poll request is waiting for the messages
+	seen      int64       // the time of the last request in nanoseconds
+	receiveMu sync.Mutex  // the messages of the POST requests are received in order
+}
+
+func (c *Client) init(baseCtx context.Context, a *gosocket.Acceptor, r *http.Request, o *options) {
+	c.id = gosocket.NewSessionId()
+	c.o = o
+	c.control = make(chan []byte, conf.Acceptor.Heartbeat.PingMaxTimes)
+	c.touch()
+
+	// 设置远程连接地址
+	c.SetRemoteAddr(gosocket.RemoteAddr(r))
+
+	// 初始化客户端
+	c.Init(baseCtx, a)
+}
+
+func (c *Client) sid() string {
+	return c.id
+}
+
+// Sid the session id, which is sent by the peer in every request
+func (c *Client) Sid() string {
+	return c.id
+}
+
+// Close close the session, the waiting poll request is responded with 404 Not Found
+func (c *Client) Close() {
+	c.CloseConnCtx()
+}
+
+// touch record the time of the request, the session is closed if the peer is idle for too long
+func (c *Client) touch() {
+	atomic.StoreInt64(&c.seen, time.Now().UnixNano())
+}
+
+// Handler serves the HTTP long-polling clients of the acceptor:
+// GET without the session id is the handshake, which returns the session id by the SessionHeader,
+// GET with the session id waits for the messages to be sent, which are framed in the response body,
+// POST with the session id sends the messages framed in the request body,
+// DELETE with the session id closes the session
+type Handler struct {
+	baseCtx  context.Context
+	a        *gosocket.Acceptor
+	factory  func() ClientFace
+	o        *options
+	sessions sync.Map // map[session id]ClientFace
+}
+
+// NewHandler create the handler of the acceptor, the factory creates the client of each session, *Client if nil
+func NewHandler(baseCtx context.Context, a *gosocket.Acceptor, factory func() ClientFace, opts ...Option) *Handler {
+	if factory == nil {
+		factory = func() ClientFace { return new(Client) }
+	}
+	return &Handler{baseCtx: baseCtx, a: a, factory: factory, o: newOptions(opts)}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	sid := r.URL.Query().Get(SessionParam)
+	if sid == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		h.handshake(w, r)
+		return
+	}
+	v, ok := h.sessions.Load(sid)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	c := v.(ClientFace)
+	switch r.Method {
+	case http.MethodGet:
+		c.poll(w, r)
+	case http.MethodPost:
+		c.receive(c, w, r)
+	case http.MethodDelete:
+		c.Close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// handshake authenticate the request, negotiate the codec and create the session
+func (h *Handler) handshake(w http.ResponseWriter, r *http.Request) {
+	// the acceptor is shutting down
+	if h.a.Closing() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	// authenticate before the session is created, the rejected peer will never be registered
+	var identity *gosocket.Identity
+	if h.o.authenticator != nil {
+		var err error
+		if identity, err = h.o.authenticator(r); err != nil {
+			log.Println("[Polling][client][handshake] authenticate error:", err, r.RemoteAddr)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// negotiate the codec of the client, the conf is used if not requested
+	var codec *protocol.Codec
+	if param := r.URL.Query().Get(CodecParam); param != "" {
+		v, err := protocol.ParseCodec(param)
+		if err != nil {
+			log.Println("[Polling][client][handshake] negotiate error:", err, r.RemoteAddr)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		codec = &v
+	}
+
+	c := h.factory()
+	c.init(h.baseCtx, h.a, r, h.o)
+	c.SetIdentity(identity)
+	// the client certificate verified by the http.Server of the mutual TLS
+	c.SetPeerCertificate(gosocket.VerifiedPeerCertificate(r.TLS))
+	if codec != nil {
+		c.SetCodec(*codec)
+	}
+
+	// add the ClientFace to acceptor, the acceptor may start shutting down after the check above
+	if !h.a.TryJoin(c) {
+		c.Close()
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	h.sessions.Store(c.sid(), c)
+
+	// trigger the event: OnConnection
+	h.a.CallGivenEvent(c, gosocket.OnConnection)
+
+	// the heartbeat of the session
+	go c.run(c, h)
+
+	w.Header().Set(SessionHeader, c.sid())
+	w.WriteHeader(http.StatusOK)
+}
+
+// run the heartbeat of the session until it is closed, the pings are sent by the poll requests
+func (c *Client) run(face ClientFace, h *Handler) {
+	ticker := time.NewTicker(time.Duration(conf.Acceptor.Heartbeat.PingInterval) * time.Second)
+	defer func() {
+		ticker.Stop()
+		c.Close()
+		h.sessions.Delete(c.id)
+		// Give a signal to the sender(Emit)
+		// Here is the consumer program of the channel c.Out()
+		// Can not close c.Out() here
+		close(c.StopOut())
+		c.Acceptor().Leave(face)
+	}()
+
+	// Tolerate one heartbeat cycle
+	wait := time.Duration((conf.Acceptor.Heartbeat.PingMaxTimes+2)*conf.Acceptor.Heartbeat.PingInterval) * time.Second
+	for {
+		select {
+		case <-c.Context().Done():
+			// e.g. closed by the peer, or disconnect the slow client by the backpressure policy
+			return
+		case <-ticker.C:
+			// the peer stopped polling
+			if wait > 0 && atomic.LoadInt32(&c.polling) == 0 && time.Since(time.Unix(0, atomic.LoadInt64(&c.seen))) > wait {
+				log.Println("[Polling][client][run] go away:", c.Id(), c.RemoteAddr())
+				return
+			}
+			// when the server sends `ping` messages for x consecutive times
+			// but does not receive any` pong` messages back,
+			// the server will actively close the session
+			pings := c.Ping()
+			if len(pings) >= conf.Acceptor.Heartbeat.PingMaxTimes {
+				log.Println("[Polling][client][run] miss pong reply:", c.Id(), c.RemoteAddr(), len(pings))
+				return
+			}
+			timeNow := time.Now()
+			millisecond := timeNow.UnixNano() / int64(time.Millisecond)
+			if msg, err := c.Acceptor().EncodeCodec(gosocket.EventPing, millisecond, "", c.SendCodec()); err == nil {
+				select {
+				case c.control <- msg:
+					c.SetPing(millisecond, true)
+				default:
+				}
+			}
+			if conf.Acceptor.Logs.Heartbeat.PingSend && c.Delay() >= conf.Acceptor.Logs.Heartbeat.PingSendPrintDelay {
+				log.Println("[heartbeat][Polling][ping]:", c.Id(), c.RemoteAddr(), millisecond, timeNow.Format("2006-01-02 15:04:05.999"), len(pings), c.Delay())
+			}
+		}
+	}
+}
+
+// poll wait for the messages until the poll timeout, the messages are written in batch,
+// only one poll request of the session is allowed at the same time
+func (c *Client) poll(w http.ResponseWriter, r *http.Request) {
+	if !atomic.CompareAndSwapInt32(&c.polling, 0, 1) {
+		http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		return
+	}
+	defer func() {
+		c.touch()
+		atomic.StoreInt32(&c.polling, 0)
+	}()
+
+	timer := time.NewTimer(c.o.pollTimeout)
+	defer timer.Stop()
+
+	var msgs [][]byte
+	draining := false
+	select {
+	case msg, ok := <-c.Out():
+		if !ok {
+			log.Println("[Polling][client][poll] msg send channel has been closed:", c.Id(), c.RemoteAddr())
+			c.Close()
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		msgs = append(msgs, msg)
+	case msg := <-c.control:
+		msgs = append(msgs, msg)
+	case <-c.Coalesced():
+		msgs = c.TakeCoalesced()
+	case <-c.Draining():
+		// the acceptor is shutting down, flush the messages waiting to be sent, then close the session
+		msgs, draining = c.TakeCoalesced(), true
+	case <-c.Context().Done():
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	case <-r.Context().Done():
+		// the peer gave up the request
+		return
+	case <-timer.C:
+	}
+	msgs = batch(c.Out(), c.control, msgs)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	if err := c.writeFrames(w, msgs); err != nil {
+		log.Println("[Polling][client][poll] write error:", err, len(msgs), c.Id(), c.RemoteAddr())
+		c.Close()
+		return
+	}
+	if draining {
+		c.Close()
+	}
+}
+
+// writeFrames write the messages in batch, which are compressed by the compression stream first if the codec is streamed
+func (c *Client) writeFrames(w io.Writer, msgs [][]byte) (err error) {
+	for n, msg := range msgs {
+		if msgs[n], err = c.StreamZip(msg); err != nil {
+			return
+		}
+	}
+	fw := protocol.NewFrameWriter(w)
+	fw.SetFramer(c.o.framer)
+	err = fw.WriteFrames(msgs...)
+	// do not keep the messages sent
+	clear(msgs)
+	return
+}
+
+// receive the messages framed in the body of the POST request
+func (c *Client) receive(face ClientFace, w http.ResponseWriter, r *http.Request) {
+	c.receiveMu.Lock()
+	defer c.receiveMu.Unlock()
+	defer c.touch()
+
+	fr := protocol.NewFrameReader(r.Body, readBufferSize)
+	fr.SetFramer(c.o.framer)
+	fr.SetMaxSize(conf.Acceptor.Transport.MaxMessageSize)
+	for {
+		row, err := fr.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var sizeErr *protocol.FrameSizeError
+			if errors.As(err, &sizeErr) {
+				// the frames afterwards can not be located, close the session
+				c.Acceptor().AddOversized()
+				c.Close()
+			}
+			log.Println("[Polling][client][receive] read error:", err, c.Id(), c.RemoteAddr())
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if row, err = c.StreamUnzip(row); err != nil {
+			// the compression stream is broken, the messages afterwards can not be decompressed
+			log.Println("[Polling][client][receive] stream unzip error:", err, c.Id(), c.RemoteAddr())
+			c.Close()
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		message, decodeErr := c.Acceptor().DecodeCodec(row, c.ReceiveCodec())
+		if decodeErr != nil {
+			log.Println("[Polling][client][receive] protocol Decode error:", decodeErr, row, string(row), c.Id(), c.RemoteAddr())
+			continue
+		}
+		// bind function handler
+		c.Acceptor().CallEvent(face, message)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// batch take the ping and the messages queued without blocking, up to maxBatchSize
+func batch(out chan []byte, control chan []byte, msgs [][]byte) [][]byte {
+	for len(msgs) < maxBatchSize {
+		select {
+		case msg := <-control:
+			msgs = append(msgs, msg)
+		case msg, ok := <-out:
+			if !ok {
+				// the closed channel is handled by the next poll
+				return msgs
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,62 @@
+package polling
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+)
+
+// Authenticator authenticate the handshake request, such as the header, query token or cookie,
+// the request is rejected with 401 Unauthorized if an error is returned,
+// and the identity returned is attached to the client
+type Authenticator func(r *http.Request) (*gosocket.Identity, error)
+
+type options struct {
+	authenticator Authenticator
+	framer        protocol.Framer
+	pollTimeout   time.Duration
+}
+
+// Option configures the Handler
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		framer:      protocol.DefaultFramer,
+		pollTimeout: time.Duration(conf.Acceptor.Heartbeat.PingInterval) * time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAuthenticator require the peer to be authenticated by the handshake request
+func WithAuthenticator(f Authenticator) Option {
+	return func(o *options) {
+		o.authenticator = f
+	}
+}
+
+// WithFramer set the framer of the messages in the request and response bodies, protocol.DefaultFramer by default,
+// e.g. protocol.NewlineFramer{} for the text messages read by the browsers
+func WithFramer(f protocol.Framer) Option {
+	return func(o *options) {
+		if f == nil {
+			f = protocol.DefaultFramer
+		}
+		o.framer = f
+	}
+}
+
+// WithPollTimeout set how long the poll request is held if there is no message, the ping interval by default
+func WithPollTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		if timeout > 0 {
+			o.pollTimeout = timeout
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package protocol
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/plhwin/gosocket/conf"
+)
+
+// CodecPrefix is the prefix of the websocket subprotocol and the tcp socket hello frame which negotiate the codec,
+// e.g. "gosocket.Protobuf.Snappy"
+const CodecPrefix = "gosocket."
+
+// the suffix of the codec compressed by the stream of the connection
+const streamSuffix = "stream"
+
+// the flag byte prefixed to each message if the compress threshold of the codec is set
+const (
+	FlagRaw        byte = 0 // the message is not compressed
+	FlagCompressed byte = 1 // the message is compressed by the compress type of the codec
+)
+
+var (
+	ErrorUnsupportedCodec = errors.New("unsupported codec")
+	ErrorWrongFlag        = errors.New("wrong compression flag of the message")
+)
+
+// Codec is the serialize and compress types of a connection,
+// negotiated by each connection at connect time, otherwise taken from the conf
+type Codec struct {
+	Serialize string // conf.TransportSerializeText or see GetSerializer
+	Compress  string // see GetCompressor
+	// Unit:bytes, if > 0, the flag byte is prefixed to each message telling whether it was compressed,
+	// and the messages smaller than the threshold are sent without compression,
+	// 0 means every message is compressed without the flag byte
+	Threshold int
+	// whether the messages are compressed by the long-lived stream of the connection, see StreamCompressor,
+	// the threshold is ignored if streamed
+	Stream bool
+}
+
+// String format the codec as "$serialize.$compress", "$serialize.$compress.$threshold" or "$serialize.$compress.stream",
+// e.g. "Protobuf.Snappy", "Text.Gzip.1024", "Text.Zstd.stream"
+func (c Codec) String() string {
+	if c.Stream {
+		return c.Serialize + "." + c.Compress + "." + streamSuffix
+	}
+	if c.Threshold > 0 {
+		return c.Serialize + "." + c.Compress + "." + strconv.Itoa(c.Threshold)
+	}
+	return c.Serialize + "." + c.Compress
+}
+
+// Binary whether the encoded message is binary, it is text only if Text serialized without compression and flag
+func (c Codec) Binary() bool {
+	return c.Serialize != conf.TransportSerializeText || c.Compress != conf.TransportCompressNone || c.Threshold > 0 || c.Stream
+}
+
+// ParseCodec parse the codec formatted as "$serialize.$compress.$threshold", "$serialize.$compress.stream",
+// "$serialize.$compress" or "$serialize", case-insensitive, the compress defaults to None,
+// e.g. "protobuf.snappy", "Text", "Text.Gzip.1024", "Text.Zstd.stream"
+func ParseCodec(s string) (codec Codec, err error) {
+	serialize, compress, _ := strings.Cut(s, ".")
+	compress, threshold, _ := strings.Cut(compress, ".")
+	if compress == "" {
+		compress = conf.TransportCompressNone
+	}
+	if strings.EqualFold(threshold, streamSuffix) {
+		codec.Stream = true
+	} else if threshold != "" {
+		if codec.Threshold, err = strconv.Atoi(threshold); err != nil || codec.Threshold < 0 {
+			return Codec{}, ErrorUnsupportedCodec
+		}
+	}
+	if strings.EqualFold(conf.TransportSerializeText, serialize) {
+		codec.Serialize = conf.TransportSerializeText
+	}
+	if k, ok := serializers.find(serialize); ok {
+		codec.Serialize = k
+	}
+	if k, ok := compressors.find(compress); ok {
+		codec.Compress = k
+	}
+	if codec.Serialize == "" || codec.Compress == "" {
+		return Codec{}, ErrorUnsupportedCodec
+	}
+	if _, ok := GetCompressor(codec.Compress).(StreamCompressor); codec.Stream && !ok {
+		return Codec{}, ErrorUnsupportedCodec
+	}
+	return
+}
+
+// EncodeCodec encode the message by the codec, see Encode,
+// if the threshold is set, only the message not smaller than the threshold is compressed, and the flag byte is prefixed,
+// if streamed, the message is serialized only, which is compressed by the ZipStream of the connection when writing
+func (p *Protocol) EncodeCodec(event string, args interface{}, id string, codec Codec) (msg []byte, err error) {
+	if codec.Stream {
+		return p.serialize(event, args, id, codec.Serialize)
+	}
+	if codec.Threshold <= 0 {
+		return p.Encode(event, args, id, codec.Serialize, codec.Compress)
+	}
+	if msg, err = p.serialize(event, args, id, codec.Serialize); err != nil {
+		return
+	}
+	if len(msg) < codec.Threshold || codec.Compress == conf.TransportCompressNone {
+		return append([]byte{FlagRaw}, msg...), nil
+	}
+	c, err := compressor(codec.Compress)
+	if err != nil {
+		return
+	}
+	if msg, err = c.Zip(msg); err != nil {
+		return
+	}
+	return append([]byte{FlagCompressed}, msg...), nil
+}
+
+// DecodeCodec decode the message by the codec, see Decode,
+// if the threshold is set, the message is unzipped only if the flag byte tells it was compressed,
+// if streamed, the message must be decompressed by the UnzipStream of the connection when reading
+func (p *Protocol) DecodeCodec(text []byte, codec Codec) (msg *Message, err error) {
+	if codec.Stream {
+		return p.deserialize(text, codec.Serialize)
+	}
+	if codec.Threshold <= 0 {
+		return p.Decode(text, codec.Serialize, codec.Compress)
+	}
+	if len(text) == 0 {
+		return nil, ErrorWrongFlag
+	}
+	switch text[0] {
+	case FlagRaw:
+		text = text[1:]
+	case FlagCompressed:
+		var c Compressor
+		if c, err = compressor(codec.Compress); err != nil {
+			return
+		}
+		if text, err = c.Unzip(text[1:]); err != nil {
+			return
+		}
+	default:
+		return nil, ErrorWrongFlag
+	}
+	return p.deserialize(text, codec.Serialize)
+}
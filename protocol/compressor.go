@@ -1,6 +1,11 @@
 package protocol
 
 import (
+	"errors"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/plhwin/gosocket/conf"
 	"github.com/plhwin/gosocket/util"
 )
 
@@ -10,6 +15,36 @@ type Compressor interface {
 	Unzip([]byte) ([]byte, error)
 }
 
+// RegisterCompressor register the compressor by name, so that it can be selected in the config,
+// it is safe for concurrent use, but only the compressor registered before conf.Init can be selected in the config
+func RegisterCompressor(name string, c Compressor) {
+	conf.RegisterCompress(name)
+	compressors.register(name, c)
+}
+
+// GetCompressor get the compressor by name, the registered one first, nil if not found
+func GetCompressor(name string) Compressor {
+	c, _ := compressors.get(name)
+	return c
+}
+
+// compressor get the compressor by name, return ErrorUnsupportedCodec if not found
+func compressor(name string) (Compressor, error) {
+	if c := GetCompressor(name); c != nil {
+		return c, nil
+	}
+	return nil, ErrorUnsupportedCodec
+}
+
+// maxMessageSize the max size of the message decompressed, the compressors are shared by the acceptor and the initiator
+func maxMessageSize() int {
+	if n := max(conf.Acceptor.Transport.MaxMessageSize, conf.Initiator.Transport.MaxMessageSize); n > 0 {
+		return n
+	}
+	// conf.Init was not called
+	return 4 * 1024 * 1024
+}
+
 // RawDataCompressor implements gzip compressor for None compress
 type RawDataCompressor struct {
 }
@@ -57,3 +92,69 @@ func (c *SnappyCompressor) Zip(data []byte) ([]byte, error) {
 func (c *SnappyCompressor) Unzip(data []byte) ([]byte, error) {
 	return util.UnzipSnappy(data)
 }
+
+// LZ4Compressor implements LZ4 compressor
+type LZ4Compressor struct {
+}
+
+func (c LZ4Compressor) Zip(data []byte) ([]byte, error) {
+	return util.ZipLZ4(data)
+}
+
+func (c LZ4Compressor) Unzip(data []byte) ([]byte, error) {
+	return util.UnzipLZ4(data, maxMessageSize())
+}
+
+// ZstdCompressor implements Zstandard compressor, it is safe for concurrent use
+type ZstdCompressor struct {
+	encoder     *zstd.Encoder
+	dopts       []zstd.DOption
+	decoderOnce sync.Once
+	decoder     *zstd.Decoder
+	decoderErr  error
+	dict        []byte // the dictionary is used by the streams as well
+}
+
+// NewZstdCompressor create a Zstandard compressor with the optional dictionary,
+// the dictionary is trained by `zstd --train` or dict.BuildZstdDict of github.com/klauspost/compress,
+// which greatly shrinks the small and repetitive messages, the peer must use the same dictionary, e.g.
+// protocol.RegisterCompressor("ZstdQuote", protocol.NewZstdCompressor(dict))
+func NewZstdCompressor(dict []byte) (*ZstdCompressor, error) {
+	var eopts []zstd.EOption
+	var dopts []zstd.DOption
+	if len(dict) > 0 {
+		eopts = append(eopts, zstd.WithEncoderDict(dict))
+		dopts = append(dopts, zstd.WithDecoderDicts(dict))
+	}
+	encoder, err := zstd.NewWriter(nil, eopts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ZstdCompressor{encoder: encoder, dopts: dopts, dict: dict}, nil
+}
+
+// getDecoder create the decoder on the first use, since the max message size is loaded by conf.Init afterwards
+func (c *ZstdCompressor) getDecoder() (*zstd.Decoder, error) {
+	c.decoderOnce.Do(func() {
+		opts := append([]zstd.DOption{zstd.WithDecoderMaxMemory(uint64(maxMessageSize()))}, c.dopts...)
+		c.decoder, c.decoderErr = zstd.NewReader(nil, opts...)
+	})
+	return c.decoder, c.decoderErr
+}
+
+func (c *ZstdCompressor) Zip(data []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+// Unzip return util.ErrorSizeExceeded if the decompressed data or the window of the frame is larger than the max message size
+func (c *ZstdCompressor) Unzip(data []byte) ([]byte, error) {
+	decoder, err := c.getDecoder()
+	if err != nil {
+		return nil, err
+	}
+	out, err := decoder.DecodeAll(data, nil)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return nil, util.ErrorSizeExceeded
+	}
+	return out, err
+}
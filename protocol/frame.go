@@ -0,0 +1,207 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+const (
+	// the larger buffers are not kept by the pool
+	maxPooledFrameSize = 1024 * 1024
+	// DefaultMaxFrameSize the max size of the frame body if not set, it is the default value of the conf transport.maxMessageSize
+	DefaultMaxFrameSize = 4 * 1024 * 1024
+)
+
+// FrameSizeError the length of the frame is negative or larger than the max size,
+// the connection must be closed, because the frames afterwards can not be located
+type FrameSizeError struct {
+	Length int // the length of the frame body read from the header
+	Max    int // the max size of the frame body
+}
+
+func (e *FrameSizeError) Error() string {
+	if e.Length < 0 {
+		return "negative frame length: " + strconv.Itoa(e.Length)
+	}
+	return "frame length " + strconv.Itoa(e.Length) + " exceeds the max size " + strconv.Itoa(e.Max)
+}
+
+// checkFrameSize return the FrameSizeError if the length of the frame body is negative or larger than the max size
+func checkFrameSize(length, max int) error {
+	if length < 0 || length > max {
+		return &FrameSizeError{Length: length, Max: max}
+	}
+	return nil
+}
+
+// the buffers of the frames larger than the read buffer, which are reused by all the connections
+var framePool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 64*1024)
+		return &b
+	},
+}
+
+// AppendPack append the frame packed by the message to dst, the same as EnPack but without allocation if dst is large enough
+func AppendPack(dst []byte, buf []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(buf)))
+	return append(dst, buf...)
+}
+
+// FrameReader read the frames from the reader, packed by EnPack or the Framer set, it is not safe for concurrent use
+type FrameReader struct {
+	r       io.Reader
+	framer  Framer
+	maxSize int     // the max size of the frame body
+	buf     []byte  // the read buffer, buf[start:end] is read but not unpacked
+	small   []byte  // the read buffer of the size, which is used unless a larger frame is being read
+	large   *[]byte // the pooled buffer of the frame larger than the read buffer
+	start   int
+	end     int
+}
+
+// NewFrameReader create the frame reader with the read buffer of the size,
+// the frames not larger than the read buffer are read without copy,
+// the max size of the frame body is DefaultMaxFrameSize, see SetMaxSize
+func NewFrameReader(r io.Reader, size int) *FrameReader {
+	small := make([]byte, size)
+	return &FrameReader{r: r, framer: DefaultFramer, maxSize: DefaultMaxFrameSize, buf: small, small: small}
+}
+
+// SetFramer set the framer of the frames, it must be set before reading
+func (fr *FrameReader) SetFramer(f Framer) {
+	if f == nil {
+		f = DefaultFramer
+	}
+	fr.framer = f
+}
+
+// SetMaxSize set the max size of the frame body, the larger frame is rejected by the FrameSizeError
+func (fr *FrameReader) SetMaxSize(maxSize int) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	fr.maxSize = maxSize
+}
+
+// ReadFrame read the body of the next frame, which is only valid until the next call,
+// the message decoded from it must not refer to it
+func (fr *FrameReader) ReadFrame() (frame []byte, err error) {
+	fr.release()
+	for {
+		var n int
+		if frame, n, err = fr.framer.Unpack(fr.buf[fr.start:fr.end], fr.maxSize); err != nil || n > 0 {
+			fr.start += n
+			return
+		}
+		// the frame is incomplete, read more
+		if fr.end == len(fr.buf) {
+			fr.grow()
+		}
+		if n, err = fr.r.Read(fr.buf[fr.end:]); n == 0 && err != nil {
+			if err == io.EOF && fr.end > fr.start {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+		fr.end += n
+	}
+}
+
+// grow make room for the incomplete frame, the frame is moved to the beginning of the buffer,
+// and the buffer is replaced by the larger pooled one if it is full
+func (fr *FrameReader) grow() {
+	rest := fr.end - fr.start
+	if rest < len(fr.buf) {
+		copy(fr.buf, fr.buf[fr.start:fr.end])
+		fr.start, fr.end = 0, rest
+		return
+	}
+	large := framePool.Get().(*[]byte)
+	if cap(*large) < 2*len(fr.buf) {
+		*large = make([]byte, 2*len(fr.buf))
+	}
+	buf := (*large)[:cap(*large)]
+	copy(buf, fr.buf[fr.start:fr.end])
+	if fr.large != nil {
+		fr.putLarge()
+	}
+	fr.large = large
+	fr.buf, fr.start, fr.end = buf, 0, rest
+}
+
+// release the pooled buffer after the large frame was read, if the rest fits in the read buffer
+func (fr *FrameReader) release() {
+	if fr.large == nil || fr.end-fr.start > len(fr.small) {
+		return
+	}
+	rest := copy(fr.small, fr.buf[fr.start:fr.end])
+	fr.putLarge()
+	fr.buf, fr.start, fr.end = fr.small, 0, rest
+}
+
+func (fr *FrameReader) putLarge() {
+	if cap(*fr.large) <= maxPooledFrameSize {
+		framePool.Put(fr.large)
+	}
+	fr.large = nil
+}
+
+// FrameWriter write the frames packed by EnPack or the Framer set in batch,
+// which are written by one writev system call if possible,
+// the headers are reused without allocation, it is not safe for concurrent use
+type FrameWriter struct {
+	w       io.Writer
+	framer  Framer
+	headers []byte
+	offsets []int       // the end offset of each header
+	bufs    net.Buffers // the backing array of the batch is reused
+	pending net.Buffers // the batch consumed by the writing
+}
+
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w: w, framer: DefaultFramer}
+}
+
+// SetFramer set the framer of the frames, it must be set before writing
+func (fw *FrameWriter) SetFramer(f Framer) {
+	if f == nil {
+		f = DefaultFramer
+	}
+	fw.framer = f
+}
+
+// WriteFrames pack and write the messages in order, nothing is written if any message can not be framed
+func (fw *FrameWriter) WriteFrames(msgs ...[]byte) (err error) {
+	if len(msgs) == 0 {
+		return
+	}
+	fw.headers, fw.offsets = fw.headers[:0], fw.offsets[:0]
+	for _, msg := range msgs {
+		if fw.headers, err = fw.framer.AppendHeader(fw.headers, msg); err != nil {
+			return
+		}
+		fw.offsets = append(fw.offsets, len(fw.headers))
+	}
+	trailer := fw.framer.Trailer()
+	fw.bufs = fw.bufs[:0]
+	start := 0
+	for n, msg := range msgs {
+		if header := fw.headers[start:fw.offsets[n]]; len(header) > 0 {
+			fw.bufs = append(fw.bufs, header)
+		}
+		fw.bufs = append(fw.bufs, msg)
+		if len(trailer) > 0 {
+			fw.bufs = append(fw.bufs, trailer)
+		}
+		start = fw.offsets[n]
+	}
+	fw.pending = fw.bufs
+	_, err = fw.pending.WriteTo(fw.w)
+	// do not keep the messages
+	clear(fw.bufs)
+	return
+}
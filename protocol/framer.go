@@ -0,0 +1,146 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var ErrorDelimiter = errors.New("the message contains the delimiter of the frame")
+
+// Framer defines how the messages are framed on the tcp socket stream
+type Framer interface {
+	// AppendHeader append the header of the frame of the message to dst, e.g. the length of the message
+	AppendHeader(dst []byte, msg []byte) ([]byte, error)
+	// Trailer the bytes following the message in the frame, e.g. the delimiter, nil if none
+	Trailer() []byte
+	// Unpack locate the first frame in buf, return the message and the size of the whole frame,
+	// n is 0 if buf does not contain a complete frame yet,
+	// the FrameSizeError is returned if the message is larger than the max size
+	Unpack(buf []byte, maxSize int) (msg []byte, n int, err error)
+}
+
+var (
+	// DefaultFramer the big endian int32 length header, see EnPack
+	DefaultFramer Framer = Int32Framer{}
+
+	_ Framer = Uint16Framer{}
+	_ Framer = UvarintFramer{}
+	_ Framer = NewlineFramer{}
+)
+
+// Int32Framer prefix the message with the big endian int32 length, see EnPack and DePack
+type Int32Framer struct {
+}
+
+func (f Int32Framer) AppendHeader(dst []byte, msg []byte) ([]byte, error) {
+	if len(msg) > math.MaxInt32 {
+		return dst, &FrameSizeError{Length: len(msg), Max: math.MaxInt32}
+	}
+	return binary.BigEndian.AppendUint32(dst, uint32(len(msg))), nil
+}
+
+func (f Int32Framer) Trailer() []byte {
+	return nil
+}
+
+func (f Int32Framer) Unpack(buf []byte, maxSize int) (msg []byte, n int, err error) {
+	if len(buf) < 4 {
+		return
+	}
+	return unpackLength(buf, 4, int(int32(binary.BigEndian.Uint32(buf))), maxSize)
+}
+
+// Uint16Framer prefix the message with the big endian uint16 length, the message is not larger than 65535 bytes
+type Uint16Framer struct {
+}
+
+func (f Uint16Framer) AppendHeader(dst []byte, msg []byte) ([]byte, error) {
+	if len(msg) > math.MaxUint16 {
+		return dst, &FrameSizeError{Length: len(msg), Max: math.MaxUint16}
+	}
+	return binary.BigEndian.AppendUint16(dst, uint16(len(msg))), nil
+}
+
+func (f Uint16Framer) Trailer() []byte {
+	return nil
+}
+
+func (f Uint16Framer) Unpack(buf []byte, maxSize int) (msg []byte, n int, err error) {
+	if len(buf) < 2 {
+		return
+	}
+	return unpackLength(buf, 2, int(binary.BigEndian.Uint16(buf)), maxSize)
+}
+
+// UvarintFramer prefix the message with the uvarint length, as the length delimited messages of the protobuf
+type UvarintFramer struct {
+}
+
+func (f UvarintFramer) AppendHeader(dst []byte, msg []byte) ([]byte, error) {
+	return binary.AppendUvarint(dst, uint64(len(msg))), nil
+}
+
+func (f UvarintFramer) Trailer() []byte {
+	return nil
+}
+
+func (f UvarintFramer) Unpack(buf []byte, maxSize int) (msg []byte, n int, err error) {
+	length, size := binary.Uvarint(buf)
+	if size == 0 {
+		// the header is incomplete
+		return
+	}
+	if size < 0 || length > math.MaxInt32 {
+		// overflow
+		return nil, 0, &FrameSizeError{Length: math.MaxInt32, Max: maxSize}
+	}
+	return unpackLength(buf, size, int(length), maxSize)
+}
+
+// NewlineFramer terminate the message with '\n', the message must not contain '\n',
+// which is usually used by the text messages, the json of the Text serialize never contains it
+type NewlineFramer struct {
+}
+
+var newline = []byte{'\n'}
+
+func (f NewlineFramer) AppendHeader(dst []byte, msg []byte) ([]byte, error) {
+	if bytes.IndexByte(msg, '\n') >= 0 {
+		return dst, ErrorDelimiter
+	}
+	return dst, nil
+}
+
+func (f NewlineFramer) Trailer() []byte {
+	return newline
+}
+
+func (f NewlineFramer) Unpack(buf []byte, maxSize int) (msg []byte, n int, err error) {
+	end := bytes.IndexByte(buf, '\n')
+	if end < 0 {
+		// the delimiter is not found within the max size, the "\r" may be followed by it
+		if len(buf) > maxSize+1 {
+			err = &FrameSizeError{Length: len(buf), Max: maxSize}
+		}
+		return
+	}
+	// tolerate the lines terminated by "\r\n"
+	msg = bytes.TrimSuffix(buf[:end], []byte{'\r'})
+	if err = checkFrameSize(len(msg), maxSize); err != nil {
+		return nil, 0, err
+	}
+	return msg, end + 1, nil
+}
+
+// unpackLength unpack the frame of the length header
+func unpackLength(buf []byte, headerSize, length, maxSize int) (msg []byte, n int, err error) {
+	if err = checkFrameSize(length, maxSize); err != nil {
+		return
+	}
+	if len(buf) < headerSize+length {
+		return
+	}
+	return buf[headerSize : headerSize+length], headerSize + length, nil
+}
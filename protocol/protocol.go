@@ -1,25 +1,38 @@
 package protocol
 
+// the Message of protocol.pb.go is generated from idl/protocol.proto, regenerate it after the .proto was changed
+//go:generate protoc --proto_path=idl --go_out=. protocol.proto
+
 import (
 	"bytes"
-	"encoding/binary"
-	"encoding/json"
 	"errors"
 
 	"github.com/plhwin/gosocket/conf"
-	"google.golang.org/protobuf/proto"
 )
 
 var (
-	// Compressors supported
+	// Compressors the built-in compressors, it is read only, the others are registered by RegisterCompressor
 	Compressors = map[string]Compressor{
 		conf.TransportCompressNone:   new(RawDataCompressor),
 		conf.TransportCompressSnappy: new(SnappyCompressor),
 		conf.TransportCompressFLate:  new(FLateCompressor),
 		conf.TransportCompressGzip:   new(GzipCompressor),
+		conf.TransportCompressLZ4:    new(LZ4Compressor),
+		conf.TransportCompressZstd:   zstdCompressor(),
 	}
+	// compressors supported, see GetCompressor
+	compressors = newRegistry(Compressors)
 )
 
+// the Zstandard compressor without dictionary
+func zstdCompressor() *ZstdCompressor {
+	c, err := NewZstdCompressor(nil)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
 type Protocol struct {
 	textProtocol TextProtocol
 }
@@ -31,84 +44,69 @@ func (p *Protocol) SetProtocol(textProtocol TextProtocol) {
 	p.textProtocol = textProtocol
 }
 
-// Encode message before send to socket server
+// Encode message before send to socket server,
+// it is serialized by the serializer registered, or the TextProtocol for the Text serialize
 func (p *Protocol) Encode(event string, args interface{}, id, serializeType, compressType string) (msg []byte, err error) {
-	if event == "" {
-		err = errors.New("event can not be empty")
+	if msg, err = p.serialize(event, args, id, serializeType); err != nil {
 		return
 	}
-
-	data := "" // interface to json string
-	if args != nil {
-		var b []byte
-		if b, err = json.Marshal(&args); err != nil {
-			return
-		}
-		data = string(b)
-	}
-
-	if serializeType == conf.TransportSerializeProtobuf {
-		// transport serialize - Protobuf
-		message := new(Message)
-		message.Event = event
-		message.Args = data
-		message.Id = id
-		if msg, err = proto.Marshal(message); err != nil {
-			return
-		}
-	} else {
-		// transport serialize - Text
-		if msg, err = p.textProtocol.Encode(event, data, id); err != nil {
-			return
-		}
-	}
-
 	// compress - zip: after Encode
-	return Compressors[compressType].Zip(msg)
+	c, err := compressor(compressType)
+	if err != nil {
+		return
+	}
+	return c.Zip(msg)
 }
 
 // Decode message after received from socket server
 func (p *Protocol) Decode(text []byte, serializeType, compressType string) (msg *Message, err error) {
-	msg = new(Message)
-
 	// compress - Unzip: before Decode
-	if text, err = Compressors[compressType].Unzip(text); err != nil {
+	c, err := compressor(compressType)
+	if err != nil {
 		return
 	}
-
-	if serializeType == conf.TransportSerializeProtobuf {
-		// transport serialize - Protobuf
-		if err = proto.Unmarshal(text, msg); err != nil {
-			return
-		}
-	} else {
-		// transport serialize - Text
-		if err = p.textProtocol.Decode(text, msg); err != nil {
-			return
-		}
+	if text, err = c.Unzip(text); err != nil {
+		return
 	}
-	return
+	return p.deserialize(text, serializeType)
 }
 
-// EnPack 数据封包
-// 前4个字节是消息长度，后面是消息内容
-func EnPack(buf []byte) (pkg *bytes.Buffer, err error) {
-	pkg = new(bytes.Buffer)
-
-	// buffer length
-	var length = int32(len(buf))
+func (p *Protocol) serialize(event string, args interface{}, id, serializeType string) (msg []byte, err error) {
+	if event == "" {
+		err = errors.New("event can not be empty")
+		return
+	}
 
-	// write length into pkg header
-	// BigEndian:大端网络字节序
-	err = binary.Write(pkg, binary.BigEndian, length)
-	if err != nil {
+	if s := GetSerializer(serializeType); s != nil {
+		// transport serialize - Protobuf, MsgPack, CBOR or registered by the user
+		return s.Marshal(event, args, id)
+	}
+	// transport serialize - Text
+	var data string // interface to json string
+	if data, err = marshalArgs(args); err != nil {
 		return
 	}
-	// write message body into pkg body
-	err = binary.Write(pkg, binary.BigEndian, buf)
-	if err != nil {
+	return p.textProtocol.Encode(event, data, id)
+}
+
+func (p *Protocol) deserialize(text []byte, serializeType string) (msg *Message, err error) {
+	msg = new(Message)
+	if s := GetSerializer(serializeType); s != nil {
+		// transport serialize - Protobuf, MsgPack, CBOR or registered by the user
+		err = s.Unmarshal(text, msg)
 		return
 	}
+	// transport serialize - Text
+	err = p.textProtocol.Decode(text, msg)
+	return
+}
+
+// EnPack 数据封包
+// 前4个字节是消息长度，后面是消息内容
+func EnPack(buf []byte) (pkg *bytes.Buffer, err error) {
+	// write length into pkg header, BigEndian:大端网络字节序
+	// and then write message body into pkg body, see AppendPack
+	pkg = bytes.NewBuffer(AppendPack(make([]byte, 0, 4+len(buf)), buf))
 	return
 }
 
@@ -120,28 +118,24 @@ func EnPack(buf []byte) (pkg *bytes.Buffer, err error) {
 // 这表示当前buf包含至少一条传输协议数据且被正确解析，通常是readBuf的长度比实际协议消息长度更长，
 // 也可能是上面情况一预留在缓冲区(buf)里的数据，加上本次读取数据(readBuf)产生的效果，
 // 两种情况都是TCP拆包的一个正常过程，readBuf每次读取字节流的大小决定了是情况1还是情况2
+// 消息长度为负数或者超过DefaultMaxFrameSize时返回FrameSizeError，此后的字节流无法解包，应关闭连接
 func DePack(buf *[]byte) (data [][]byte, err error) {
-	// 消息前4个字节存储消息长度
-	byteLen := 4
-	for {
-		if len(*buf) < byteLen {
-			// buffer长度不足4，io流读取的字节流数据截断的"很巧"
-			return
-		}
-		// 获取前4个字节存储的消息长度
-		lenBuf := bytes.NewBuffer((*buf)[0:byteLen])
-		var tmpLen int32
-		if err = binary.Read(lenBuf, binary.BigEndian, &tmpLen); err != nil {
-			return
-		}
-		rowLen := int(tmpLen)
-		length := byteLen + rowLen
+	return DePackLimit(buf, DefaultMaxFrameSize)
+}
 
-		if len(*buf) < length {
-			// buffer长度小于传输协议的消息长度，等待下一次读取的字节流
+// DePackLimit 数据解包，同DePack，消息长度超过maxSize时返回FrameSizeError
+func DePackLimit(buf *[]byte, maxSize int) (data [][]byte, err error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	// 消息前4个字节存储消息长度，见Int32Framer
+	for {
+		var row []byte
+		var length int
+		if row, length, err = (Int32Framer{}).Unpack(*buf, maxSize); err != nil || length == 0 {
+			// buffer长度不足4或者小于传输协议的消息长度，等待下一次读取的字节流
 			return
 		}
-		row := (*buf)[byteLen:length]
 		data = append(data, row)
 		// 剩余的未处理的buffer
 		*buf = (*buf)[length:]
@@ -1,7 +1,7 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
 // 	protoc-gen-go v1.36.6
-// 	protoc        v5.29.3
+// 	protoc        (unknown)
 // source: protocol.proto
 
 package protocol
@@ -26,6 +26,7 @@ type Message struct {
 	Event         string                 `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
 	Args          string                 `protobuf:"bytes,2,opt,name=args,proto3" json:"args,omitempty"`
 	Id            string                 `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	Data          []byte                 `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -81,15 +82,23 @@ func (x *Message) GetId() string {
 	return ""
 }
 
+func (x *Message) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
 var File_protocol_proto protoreflect.FileDescriptor
 
 const file_protocol_proto_rawDesc = "" +
 	"\n" +
-	"\x0eprotocol.proto\x12\bprotocol\"C\n" +
+	"\x0eprotocol.proto\x12\bprotocol\"W\n" +
 	"\aMessage\x12\x14\n" +
 	"\x05event\x18\x01 \x01(\tR\x05event\x12\x12\n" +
 	"\x04args\x18\x02 \x01(\tR\x04args\x12\x0e\n" +
-	"\x02id\x18\x03 \x01(\tR\x02idB\rZ\v./;protocolb\x06proto3"
+	"\x02id\x18\x03 \x01(\tR\x02id\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04dataB\rZ\v./;protocolb\x06proto3"
 
 var (
 	file_protocol_proto_rawDescOnce sync.Once
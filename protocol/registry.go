@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"strings"
+	"sync"
+)
+
+// registry keeps the implementations by name, which are registered at any time and read by the connections concurrently,
+// the built-in ones are read only, the registered ones may replace them
+type registry[T any] struct {
+	mu         sync.RWMutex
+	builtin    map[string]T
+	registered map[string]T
+}
+
+func newRegistry[T any](builtin map[string]T) *registry[T] {
+	return &registry[T]{builtin: builtin, registered: make(map[string]T)}
+}
+
+func (r *registry[T]) register(name string, v T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registered[name] = v
+}
+
+// get the implementation by name, the zero value is returned if not found
+func (r *registry[T]) get(name string) (v T, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if v, ok = r.registered[name]; ok {
+		return
+	}
+	v, ok = r.builtin[name]
+	return
+}
+
+// find the name case-insensitively, return false if not found
+func (r *registry[T]) find(name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, m := range []map[string]T{r.registered, r.builtin} {
+		for k := range m {
+			if strings.EqualFold(k, name) {
+				return k, true
+			}
+		}
+	}
+	return "", false
+}
+
+// names of all the implementations
+func (r *registry[T]) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.builtin)+len(r.registered))
+	for k := range r.builtin {
+		names = append(names, k)
+	}
+	for k := range r.registered {
+		if _, ok := r.builtin[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	return names
+}
@@ -0,0 +1,173 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrorWrongMessage = errors.New("wrong message format, should be [event, args, id]")
+
+	// serializers supported besides Text, which is serialized by the TextProtocol of the Protocol
+	serializers = newRegistry(map[string]Serializer{
+		conf.TransportSerializeProtobuf: new(ProtobufSerializer),
+		conf.TransportSerializeMsgPack:  new(MsgPackSerializer),
+		conf.TransportSerializeCBOR:     new(CBORSerializer),
+	})
+)
+
+// Serializer defines a common serialization interface of the message
+type Serializer interface {
+	Marshal(event string, args interface{}, id string) ([]byte, error)
+	Unmarshal([]byte, *Message) error
+}
+
+// RegisterSerializer register the serializer by name, so that it can be selected in the config,
+// it is safe for concurrent use, but only the serializer registered before conf.Init can be selected in the config
+func RegisterSerializer(name string, s Serializer) {
+	conf.RegisterSerialize(name)
+	serializers.register(name, s)
+}
+
+// GetSerializer get the serializer by name, nil if not found, e.g. the Text serialize
+func GetSerializer(name string) Serializer {
+	s, _ := serializers.get(name)
+	return s
+}
+
+// marshalArgs marshal the args into json string
+func marshalArgs(args interface{}) (string, error) {
+	if args == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(&args)
+	return string(b), err
+}
+
+// nativeArgs decode the args marshalled into json already, e.g. the json.RawMessage relayed by the adapter,
+// so that they are encoded natively by the binary serializers rather than as the json bytes
+func nativeArgs(args interface{}) (interface{}, error) {
+	raw, ok := args.(json.RawMessage)
+	if !ok {
+		return args, nil
+	}
+	var v interface{}
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+// ProtobufSerializer implements the Protobuf serializer,
+// the args is marshalled into the binary data if it is a proto.Message, otherwise into the json string
+type ProtobufSerializer struct {
+}
+
+func (s ProtobufSerializer) Marshal(event string, args interface{}, id string) (msg []byte, err error) {
+	message := new(Message)
+	message.Event = event
+	message.Id = id
+	if m, ok := args.(proto.Message); ok {
+		if message.Data, err = proto.Marshal(m); err != nil {
+			return
+		}
+	} else if message.Args, err = marshalArgs(args); err != nil {
+		return
+	}
+	return proto.Marshal(message)
+}
+
+func (s ProtobufSerializer) Unmarshal(data []byte, msg *Message) error {
+	return proto.Unmarshal(data, msg)
+}
+
+// MsgPackSerializer implements the MessagePack serializer, the message is encoded as the array [event, args, id],
+// the structs of the args are encoded by the json tags
+type MsgPackSerializer struct {
+}
+
+func (s MsgPackSerializer) Marshal(event string, args interface{}, id string) ([]byte, error) {
+	args, err := nativeArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	// the numbers decoded from json are float64
+	enc.UseCompactFloats(true)
+	if err = enc.Encode([]interface{}{event, args, id}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s MsgPackSerializer) Unmarshal(data []byte, msg *Message) (err error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	var v []interface{}
+	if err = dec.Decode(&v); err != nil {
+		return
+	}
+	return fromTriple(v, msg)
+}
+
+// CBORSerializer implements the CBOR serializer, the message is encoded as the array [event, args, id],
+// the structs of the args are encoded by the cbor tags, or the json tags if absent
+type CBORSerializer struct {
+}
+
+var cborEncMode, _ = cbor.EncOptions{
+	// the numbers decoded from json are float64
+	ShortestFloat: cbor.ShortestFloat16,
+}.EncMode()
+
+var cborDecMode, _ = cbor.DecOptions{
+	// the maps are converted to json
+	DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+}.DecMode()
+
+func (s CBORSerializer) Marshal(event string, args interface{}, id string) ([]byte, error) {
+	args, err := nativeArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return cborEncMode.Marshal([]interface{}{event, args, id})
+}
+
+func (s CBORSerializer) Unmarshal(data []byte, msg *Message) (err error) {
+	var v []interface{}
+	if err = cborDecMode.Unmarshal(data, &v); err != nil {
+		return
+	}
+	return fromTriple(v, msg)
+}
+
+// fromTriple fill the message by the decoded array [event, args, id],
+// the args is converted to the json string, which is decoded by the event processing function
+func fromTriple(v []interface{}, msg *Message) (err error) {
+	if len(v) == 0 || len(v) > 3 {
+		return ErrorWrongMessage
+	}
+	var ok bool
+	if msg.Event, ok = v[0].(string); !ok || msg.Event == "" {
+		return ErrorWrongMessage
+	}
+	if len(v) > 1 {
+		if msg.Args, err = marshalArgs(v[1]); err != nil {
+			return
+		}
+	}
+	if len(v) > 2 {
+		if msg.Id, ok = v[2].(string); !ok {
+			return ErrorWrongMessage
+		}
+	}
+	return
+}
@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	// SocketIOEventPacket the Socket.IO packet type of the event, e.g. 2["event",args] or 212["event",args] with the ack id 12
+	SocketIOEventPacket = '2'
+	// SocketIOAckPacket the Socket.IO packet type of the ack, e.g. 312[args]
+	SocketIOAckPacket = '3'
+	// SocketIOAckEvent the event of the message decoded from the ack packet, the message of it is encoded as the ack packet as well
+	SocketIOAckEvent = "ack"
+)
+
+var ErrorSocketIOAckId = errors.New("the ack id of the Socket.IO packet must be a non-negative integer")
+
+// SocketIOTextProtocol implements the text protocol of the Socket.IO v4 packets of the main namespace,
+// only the event and the ack packets are supported, which are formatted as the following:
+// the message without id is the event packet 2["$event",$args],
+// the message with id is the ack packet 3$id[$args] which replies the event packet carrying the same ack id,
+// the ack id must be numeric, so the message sent by EmitWithAck can not be encoded.
+// The Engine.IO handshake and the namespaces are handled by the socketio package
+type SocketIOTextProtocol struct {
+}
+
+func (p *SocketIOTextProtocol) Encode(event string, data, id string) (message []byte, err error) {
+	if id == "" {
+		message = make([]byte, 0, len(event)+len(data)+6)
+		message = append(message, SocketIOEventPacket, '[')
+		message = appendTextString(message, event)
+		if data != "" {
+			message = append(message, ',')
+			message = append(message, data...)
+		}
+		return append(message, ']'), nil
+	}
+	if !isSocketIOAckId(id) {
+		return nil, ErrorSocketIOAckId
+	}
+	message = make([]byte, 0, len(id)+len(data)+3)
+	message = append(message, SocketIOAckPacket)
+	message = append(message, id...)
+	message = append(message, '[')
+	message = append(message, data...)
+	return append(message, ']'), nil
+}
+
+// Decode Parse the event packet 2$id["$event",$args...] or the ack packet 3$id[$args...],
+// the event of the ack packet is SocketIOAckEvent, the args is the json array if more than one,
+// the namespace must be the main namespace "/"
+func (p *SocketIOTextProtocol) Decode(text []byte, msg *Message) (err error) {
+	if len(text) == 0 || (text[0] != SocketIOEventPacket && text[0] != SocketIOAckPacket) {
+		return ErrorWrongMessage
+	}
+	s := textScanner{text: text, pos: 1}
+	// the main namespace may be sent explicitly
+	if len(text) > 2 && string(text[1:3]) == "/," {
+		s.pos += 2
+	}
+	start := s.pos
+	for s.pos < len(text) && text[s.pos] >= '0' && text[s.pos] <= '9' {
+		s.pos++
+	}
+	id := string(text[start:s.pos])
+	if id != "" && !isSocketIOAckId(id) {
+		return ErrorSocketIOAckId
+	}
+
+	if !s.consume('[') {
+		return ErrorWrongMessage
+	}
+	event := SocketIOAckEvent
+	if text[0] == SocketIOEventPacket {
+		if event, err = s.string(); err != nil {
+			return
+		}
+		if event == "" {
+			return ErrorWrongMessage
+		}
+	}
+	// the args are kept as the json text
+	var args [][]byte
+	for !s.consume(']') {
+		if (len(args) > 0 || text[0] == SocketIOEventPacket) && !s.consume(',') {
+			return ErrorWrongMessage
+		}
+		var from, to int
+		if from, to, err = s.value(0); err != nil {
+			return
+		}
+		args = append(args, text[from:to])
+	}
+	if s.skipSpace(); s.pos < len(text) {
+		return ErrorWrongMessage
+	}
+	msg.Event, msg.Args, msg.Id = event, joinSocketIOArgs(args), id
+	return
+}
+
+// joinSocketIOArgs the only args is kept as it is, the more args are joined as the json array
+func joinSocketIOArgs(args [][]byte) string {
+	if len(args) == 0 {
+		return ""
+	}
+	if len(args) == 1 {
+		if string(args[0]) == "null" {
+			return ""
+		}
+		return string(args[0])
+	}
+	b := []byte{'['}
+	for n, arg := range args {
+		if n > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, arg...)
+	}
+	return string(append(b, ']'))
+}
+
+// isSocketIOAckId the ack id is in the same range as the javascript clients
+func isSocketIOAckId(id string) bool {
+	_, err := strconv.ParseUint(id, 10, 53)
+	return err == nil
+}
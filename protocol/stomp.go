@@ -0,0 +1,168 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+const (
+	// STOMPCommandSend the command of the frame sent by the STOMP clients
+	STOMPCommandSend = "SEND"
+	// STOMPCommandMessage the command of the frame encoded
+	STOMPCommandMessage = "MESSAGE"
+)
+
+// the escaped characters of the header, see STOMP 1.2
+var stompHeaderEscaper = strings.NewReplacer("\\", `\\`, "\r", `\r`, "\n", `\n`, ":", `\c`)
+
+// STOMPTextProtocol implements the STOMP like text protocol, the frame is formatted as the following:
+//
+//	MESSAGE
+//	destination:$event
+//	id:$id
+//	content-type:application/json
+//	content-length:$length
+//
+//	$args^@
+//
+// the id header is omitted if empty, the body and its headers are omitted if the args is empty,
+// the header values are escaped as STOMP 1.2, the frame is terminated by the NULL octet,
+// the frame of the command SEND is decoded as well
+type STOMPTextProtocol struct {
+}
+
+func (p *STOMPTextProtocol) Encode(event string, data, id string) (message []byte, err error) {
+	var b bytes.Buffer
+	b.Grow(len(event) + len(data) + len(id) + 64)
+	b.WriteString(STOMPCommandMessage + "\ndestination:")
+	stompHeaderEscaper.WriteString(&b, event)
+	if id != "" {
+		b.WriteString("\nid:")
+		stompHeaderEscaper.WriteString(&b, id)
+	}
+	if data != "" {
+		b.WriteString("\ncontent-type:application/json\ncontent-length:")
+		b.WriteString(strconv.Itoa(len(data)))
+	}
+	b.WriteString("\n\n")
+	b.WriteString(data)
+	b.WriteByte(0)
+	return b.Bytes(), nil
+}
+
+// Decode Parse the frame of the command MESSAGE or SEND, the event is the destination header,
+// the body is read up to the content-length if present, otherwise up to the NULL octet,
+// the repeated headers are ignored but the first one, the lines may be terminated by "\r\n"
+func (p *STOMPTextProtocol) Decode(text []byte, msg *Message) (err error) {
+	var line []byte
+	var ok bool
+	if line, text, ok = cutSTOMPLine(text); !ok {
+		return ErrorWrongMessage
+	}
+	if command := string(line); command != STOMPCommandMessage && command != STOMPCommandSend {
+		return ErrorWrongMessage
+	}
+	var event, id string
+	var hasEvent, hasId bool
+	length := -1
+	for {
+		if line, text, ok = cutSTOMPLine(text); !ok {
+			return ErrorWrongMessage
+		}
+		if len(line) == 0 {
+			// the end of the headers
+			break
+		}
+		name, value, found := bytes.Cut(line, []byte{':'})
+		if !found {
+			return ErrorWrongMessage
+		}
+		switch string(name) {
+		case "destination":
+			if !hasEvent {
+				if event, err = unescapeSTOMPHeader(value); err != nil {
+					return
+				}
+				hasEvent = true
+			}
+		case "id":
+			if !hasId {
+				if id, err = unescapeSTOMPHeader(value); err != nil {
+					return
+				}
+				hasId = true
+			}
+		case "content-length":
+			if length < 0 {
+				if length, err = strconv.Atoi(string(value)); err != nil || length < 0 {
+					return ErrorWrongMessage
+				}
+			}
+		}
+	}
+	if event == "" {
+		return ErrorWrongMessage
+	}
+
+	var body []byte
+	if length >= 0 {
+		if len(text) <= length || text[length] != 0 {
+			return ErrorWrongMessage
+		}
+		body, text = text[:length], text[length+1:]
+	} else {
+		var found bool
+		if body, text, found = bytes.Cut(text, []byte{0}); !found {
+			return ErrorWrongMessage
+		}
+	}
+	// only the EOLs are allowed after the NULL octet
+	if len(bytes.Trim(text, "\r\n")) > 0 {
+		return ErrorWrongMessage
+	}
+	if len(body) > 0 && !json.Valid(body) {
+		return ErrorWrongMessage
+	}
+	msg.Event, msg.Args, msg.Id = event, string(body), id
+	return
+}
+
+// cutSTOMPLine cut the line terminated by "\n" or "\r\n"
+func cutSTOMPLine(text []byte) (line, rest []byte, ok bool) {
+	if line, rest, ok = bytes.Cut(text, []byte{'\n'}); ok {
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+	}
+	return
+}
+
+// unescapeSTOMPHeader the undefined escape sequences are treated as the fatal error, see STOMP 1.2
+func unescapeSTOMPHeader(value []byte) (string, error) {
+	if bytes.IndexByte(value, '\\') < 0 {
+		return string(value), nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+		if i++; i == len(value) {
+			return "", ErrorWrongMessage
+		}
+		switch value[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		case 'c':
+			b.WriteByte(':')
+		default:
+			return "", ErrorWrongMessage
+		}
+	}
+	return b.String(), nil
+}
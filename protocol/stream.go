@@ -0,0 +1,189 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/plhwin/gosocket/util"
+)
+
+// the window of the Zstandard stream, which is kept by each connection
+const zstdStreamWindowSize = 128 * 1024
+
+var ErrorWrongStream = errors.New("wrong message of the compression stream")
+
+// StreamCompressor defines the compressor which keeps a long-lived compression context per connection,
+// the context is shared by all the messages of the connection in order,
+// so the redundancy across the messages is compressed, similar to the permessage-deflate context takeover
+type StreamCompressor interface {
+	NewZipStream() (ZipStream, error)
+	NewUnzipStream() (UnzipStream, error)
+}
+
+// ZipStream compress the messages of a connection in order, it is not safe for concurrent use
+type ZipStream interface {
+	Zip([]byte) ([]byte, error)
+}
+
+// UnzipStream decompress the messages of a connection in order, it is not safe for concurrent use
+type UnzipStream interface {
+	Unzip([]byte) ([]byte, error)
+}
+
+// NewZipStream create the compression stream of the codec, return ErrorUnsupportedCodec if the compressor can not stream
+func NewZipStream(codec Codec) (ZipStream, error) {
+	s, ok := GetCompressor(codec.Compress).(StreamCompressor)
+	if !ok {
+		return nil, ErrorUnsupportedCodec
+	}
+	return s.NewZipStream()
+}
+
+// NewUnzipStream create the decompression stream of the codec, return ErrorUnsupportedCodec if the compressor can not stream
+func NewUnzipStream(codec Codec) (UnzipStream, error) {
+	s, ok := GetCompressor(codec.Compress).(StreamCompressor)
+	if !ok {
+		return nil, ErrorUnsupportedCodec
+	}
+	return s.NewUnzipStream()
+}
+
+func (c FLateCompressor) NewZipStream() (ZipStream, error) {
+	s := new(flushZipStream)
+	w, err := flate.NewWriter(&s.buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	s.w = w
+	return s, nil
+}
+
+func (c FLateCompressor) NewUnzipStream() (UnzipStream, error) {
+	s := new(flushUnzipStream)
+	s.r = flate.NewReader(&s.src)
+	return s, nil
+}
+
+func (c *ZstdCompressor) NewZipStream() (ZipStream, error) {
+	s := new(flushZipStream)
+	opts := []zstd.EOption{zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(zstdStreamWindowSize)}
+	if len(c.dict) > 0 {
+		opts = append(opts, zstd.WithEncoderDict(c.dict))
+	}
+	w, err := zstd.NewWriter(&s.buf, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.w = w
+	return s, nil
+}
+
+func (c *ZstdCompressor) NewUnzipStream() (UnzipStream, error) {
+	s := new(flushUnzipStream)
+	// decode synchronously in the reader, no more bytes than the message are required
+	opts := []zstd.DOption{zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true)}
+	if len(c.dict) > 0 {
+		opts = append(opts, zstd.WithDecoderDicts(c.dict))
+	}
+	r, err := zstd.NewReader(&s.src, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.r = r
+	return s, nil
+}
+
+// flushZipStream flush the compressed data of each message,
+// the message is formatted as the uvarint length of the raw data followed by the compressed data
+type flushZipStream struct {
+	w interface {
+		io.Writer
+		Flush() error
+	}
+	buf bytes.Buffer
+	err error // the stream is broken, all the messages afterwards can not be compressed
+}
+
+func (s *flushZipStream) Zip(data []byte) (msg []byte, err error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.buf.Reset()
+	s.buf.Write(binary.AppendUvarint(nil, uint64(len(data))))
+	if _, err = s.w.Write(data); err != nil {
+		s.err = err
+		return
+	}
+	if err = s.w.Flush(); err != nil {
+		s.err = err
+		return
+	}
+	return bytes.Clone(s.buf.Bytes()), nil
+}
+
+// flushUnzipStream read the raw data of each message from the stream fed by the messages in order
+type flushUnzipStream struct {
+	r   io.Reader
+	src chunkReader
+	err error // the stream is broken, all the messages afterwards can not be decompressed
+}
+
+func (s *flushUnzipStream) Unzip(msg []byte) (data []byte, err error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	length, n := binary.Uvarint(msg)
+	if n <= 0 {
+		s.err = ErrorWrongStream
+		return nil, s.err
+	}
+	// the length is sent by the peer, the raw data larger than the max message size is never decompressed
+	if length > uint64(maxMessageSize()) {
+		s.err = util.ErrorSizeExceeded
+		return nil, s.err
+	}
+	s.src.feed(msg[n:])
+	var buf bytes.Buffer
+	copied, err := io.Copy(&buf, io.LimitReader(s.r, int64(length)))
+	if err == nil && copied < int64(length) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		s.err = err
+		return
+	}
+	return buf.Bytes(), nil
+}
+
+// chunkReader read the messages fed in order, the reader of the stream must not read beyond the message fed,
+// or the stream is broken by the error io.ErrUnexpectedEOF
+type chunkReader struct {
+	b []byte
+}
+
+func (r *chunkReader) feed(b []byte) {
+	r.b = append(r.b, b...)
+}
+
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	if len(r.b) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n = copy(p, r.b)
+	r.b = r.b[n:]
+	return
+}
+
+// ReadByte prevent the flate reader from reading ahead by a bufio.Reader
+func (r *chunkReader) ReadByte() (byte, error) {
+	if len(r.b) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := r.b[0]
+	r.b = r.b[1:]
+	return b, nil
+}
@@ -1,8 +1,10 @@
 package protocol
 
 import (
-	"errors"
-	"strings"
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/plhwin/gosocket/conf"
 )
 
 // TextProtocol defines a common text of protocol interface.
@@ -11,115 +13,345 @@ type TextProtocol interface {
 	Decode([]byte, *Message) error
 }
 
+var (
+	// textProtocols supported, which is selected by the config transport.textProtocol
+	textProtocols = newRegistry(map[string]TextProtocol{
+		conf.TextProtocolJSONArray:  new(DefaultTextProtocol),
+		conf.TextProtocolJSONObject: new(JSONObjectTextProtocol),
+		conf.TextProtocolSocketIO:   new(SocketIOTextProtocol),
+		conf.TextProtocolSTOMP:      new(STOMPTextProtocol),
+	})
+)
+
+// RegisterTextProtocol register the text protocol by name, so that it can be selected in the config,
+// it is safe for concurrent use, but only the text protocol registered before conf.Init can be selected in the config
+func RegisterTextProtocol(name string, p TextProtocol) {
+	conf.RegisterTextProtocol(name)
+	textProtocols.register(name, p)
+}
+
+// GetTextProtocol get the text protocol by name, nil if not found
+func GetTextProtocol(name string) TextProtocol {
+	p, _ := textProtocols.get(name)
+	return p
+}
+
+// TextProtocolNames the names of the text protocols supported, including the registered ones
+func TextProtocolNames() []string {
+	return textProtocols.names()
+}
+
+// the max nesting depth of the args, the same as encoding/json
+const maxTextDepth = 10000
+
 // DefaultTextProtocol implements default text of protocol
 type DefaultTextProtocol struct {
 }
 
+// Encode the message as ["$event",$args,"$id"], the event and the id are escaped as the json strings,
+// the args is the json text, it is null if empty but the id is present
 func (p *DefaultTextProtocol) Encode(event string, data, id string) (message []byte, err error) {
-	body := `"` + event + `"`
-	if data != "" {
-		body += `,` + data
+	message = make([]byte, 0, len(event)+len(data)+len(id)+10)
+	message = append(message, '[')
+	message = appendTextString(message, event)
+	if data != "" || id != "" {
+		message = append(message, ',')
+		if data == "" {
+			message = append(message, "null"...)
+		} else {
+			message = append(message, data...)
+		}
 	}
 	if id != "" {
-		body += `,"` + id + `"`
+		message = append(message, ',')
+		message = appendTextString(message, id)
 	}
-	message = []byte(`[` + body + `]`)
+	message = append(message, ']')
 	return
 }
 
-// Decode Parse message as ["$event",$args,"$identity"]
+// Decode Parse message as ["$event",$args,"$id"],
+// the args can be any json value and is kept as the json text, the null args is decoded as empty,
+// the id must be a string or null, the message of two elements never carries the id
 func (p *DefaultTextProtocol) Decode(text []byte, msg *Message) (err error) {
-	var event, args string
-	if event, args, err = cutFromLeft(string(text)); err != nil {
+	s := textScanner{text: text}
+	s.skipSpace()
+	if !s.consume('[') {
+		return ErrorWrongMessage
+	}
+	var event, args, id string
+	if event, err = s.string(); err != nil {
 		return
 	}
 	if event == "" {
-		err = errors.New("wrong message format")
-		return
+		return ErrorWrongMessage
 	}
-	msg.Event, msg.Args = event, args
-	// if end with "(quote), it is possible to carry the client id
-	// it means that the data type of the client id must be a string
-	if strings.HasSuffix(msg.Args, `"`) {
-		if left, right, cutErr := cutFromRight(msg.Args); cutErr == nil {
-			if msg.Args != `"`+right+`"` {
-				msg.Args = left
-				msg.Id = right
+	if s.consume(',') {
+		var start, end int
+		if start, end, err = s.value(0); err != nil {
+			return
+		}
+		if args = string(text[start:end]); args == "null" {
+			args = ""
+		}
+		if s.consume(',') {
+			s.skipSpace()
+			if s.literal("null") {
+				s.skipSpace()
+			} else if id, err = s.string(); err != nil {
+				return
 			}
 		}
 	}
+	if !s.consume(']') {
+		return ErrorWrongMessage
+	}
+	if s.skipSpace(); s.pos < len(text) {
+		return ErrorWrongMessage
+	}
+	msg.Event, msg.Args, msg.Id = event, args, id
 	return
 }
 
-type counter struct {
-	start      int
-	end        int
-	rest       int
-	countQuote int
+// JSONObjectTextProtocol implements the text protocol of the json object {"e":"$event","a":$args,"i":"$id"},
+// the args and the id are omitted if empty
+type JSONObjectTextProtocol struct {
 }
 
-func (c *counter) count(i int, s int32) (done bool, err error) {
-	if s == '"' {
-		switch c.countQuote {
-		case 0:
-			c.start = i + 1
-		case 1:
-			c.end = i
-			c.rest = i + 1
-		default:
-			err = errors.New("wrong message quote")
-			return
-		}
-		c.countQuote++
+type jsonObjectMessage struct {
+	Event string          `json:"e"`
+	Args  json.RawMessage `json:"a,omitempty"`
+	Id    string          `json:"i,omitempty"`
+}
+
+func (p *JSONObjectTextProtocol) Encode(event string, data, id string) ([]byte, error) {
+	return json.Marshal(jsonObjectMessage{Event: event, Args: json.RawMessage(data), Id: id})
+}
+
+// Decode Parse message as {"e":"$event","a":$args,"i":"$id"}, the null args and id are decoded as empty
+func (p *JSONObjectTextProtocol) Decode(text []byte, msg *Message) (err error) {
+	var m struct {
+		Event string          `json:"e"`
+		Args  json.RawMessage `json:"a"`
+		Id    *string         `json:"i"`
 	}
-	if s == ',' {
-		if c.countQuote == 2 {
-			c.rest = i + 1
-			done = true
-		}
+	if err = json.Unmarshal(text, &m); err != nil {
+		return
+	}
+	if m.Event == "" {
+		return ErrorWrongMessage
+	}
+	msg.Event = m.Event
+	if msg.Args = string(m.Args); msg.Args == "null" {
+		msg.Args = ""
+	}
+	if m.Id != nil {
+		msg.Id = *m.Id
 	}
 	return
 }
 
-func cutFromLeft(text string) (left, right string, err error) {
-	var c counter
-	// loop from left to right
-	for i, s := range text {
-		var done bool
-		if done, err = c.count(i, s); err != nil {
-			return
+// appendTextString append the json string of s to dst, the characters required are escaped
+func appendTextString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' {
+			continue
 		}
-		if done {
-			break
+		dst = append(dst, s[start:i]...)
+		switch c {
+		case '"', '\\':
+			dst = append(dst, '\\', c)
+		case '\n':
+			dst = append(dst, '\\', 'n')
+		case '\r':
+			dst = append(dst, '\\', 'r')
+		case '\t':
+			dst = append(dst, '\\', 't')
+		default:
+			const hex = "0123456789abcdef"
+			dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		}
+		start = i + 1
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// textScanner tokenize the json array of the text message
+type textScanner struct {
+	text []byte
+	pos  int
+}
+
+func (s *textScanner) skipSpace() {
+	for s.pos < len(s.text) {
+		switch s.text[s.pos] {
+		case ' ', '\t', '\r', '\n':
+			s.pos++
+		default:
+			return
 		}
 	}
-	if (c.end < c.start) || (c.rest >= len(text)) {
-		err = errors.New("wrong message len")
+}
+
+// consume the byte c after the spaces, report whether it is found
+func (s *textScanner) consume(c byte) bool {
+	s.skipSpace()
+	if s.pos < len(s.text) && s.text[s.pos] == c {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+func (s *textScanner) literal(lit string) bool {
+	if len(s.text)-s.pos >= len(lit) && string(s.text[s.pos:s.pos+len(lit)]) == lit {
+		s.pos += len(lit)
+		return true
+	}
+	return false
+}
+
+// string decode the json string after the spaces
+func (s *textScanner) string() (str string, err error) {
+	s.skipSpace()
+	var start, end int
+	var escaped bool
+	if start, end, escaped, err = s.skipString(); err != nil {
 		return
 	}
-	left = text[c.start:c.end]
-	right = text[c.rest : len(text)-1]
+	if !escaped {
+		return string(s.text[start+1 : end-1]), nil
+	}
+	if err = json.Unmarshal(s.text[start:end], &str); err != nil {
+		err = ErrorWrongMessage
+	}
 	return
 }
 
-func cutFromRight(text string) (left, right string, err error) {
-	var c counter
-	bytes := []rune(text)
-	// loop from right to left
-	for i := len(bytes) - 1; i >= 0; i-- {
-		var done bool
-		if done, err = c.count(i, bytes[i]); err != nil {
+// skipString skip the json string at the position, report whether it contains the escaped characters
+func (s *textScanner) skipString() (start, end int, escaped bool, err error) {
+	start = s.pos
+	if s.pos >= len(s.text) || s.text[s.pos] != '"' {
+		err = ErrorWrongMessage
+		return
+	}
+	for s.pos++; s.pos < len(s.text); s.pos++ {
+		switch c := s.text[s.pos]; {
+		case c == '"':
+			s.pos++
+			return start, s.pos, escaped, nil
+		case c == '\\':
+			escaped = true
+			if !s.escape() {
+				err = ErrorWrongMessage
+				return
+			}
+		case c < 0x20:
+			err = ErrorWrongMessage
 			return
+		case c >= utf8.RuneSelf:
+			// the invalid utf-8 is replaced by encoding/json
+			r, size := utf8.DecodeRune(s.text[s.pos:])
+			if r == utf8.RuneError && size == 1 {
+				escaped = true
+			}
+			s.pos += size - 1
 		}
-		if done {
-			break
+	}
+	err = ErrorWrongMessage
+	return
+}
+
+// escape skip the escape sequence following the backslash at the position, report whether it is valid
+func (s *textScanner) escape() bool {
+	if s.pos++; s.pos >= len(s.text) {
+		return false
+	}
+	switch s.text[s.pos] {
+	case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+		return true
+	case 'u':
+		if len(s.text)-s.pos <= 4 {
+			return false
 		}
+		for _, c := range s.text[s.pos+1 : s.pos+5] {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+		s.pos += 4
+		return true
+	}
+	return false
+}
+
+// value skip the json value after the spaces, return the position of it
+func (s *textScanner) value(depth int) (start, end int, err error) {
+	if depth > maxTextDepth {
+		err = ErrorWrongMessage
+		return
+	}
+	s.skipSpace()
+	start = s.pos
+	if s.pos >= len(s.text) {
+		err = ErrorWrongMessage
+		return
 	}
-	if (c.end+1 > c.start-1) || (c.rest < 1) {
-		err = errors.New("wrong message len")
+	switch c := s.text[s.pos]; {
+	case c == '"':
+		_, end, _, err = s.skipString()
+		return
+	case c == '{' || c == '[':
+		closing := byte(']')
+		if c == '{' {
+			closing = '}'
+		}
+		s.pos++
+		if s.consume(closing) {
+			return start, s.pos, nil
+		}
+		for {
+			if c == '{' {
+				s.skipSpace()
+				if _, _, _, err = s.skipString(); err != nil {
+					return
+				}
+				if !s.consume(':') {
+					err = ErrorWrongMessage
+					return
+				}
+			}
+			if _, _, err = s.value(depth + 1); err != nil {
+				return
+			}
+			if s.consume(closing) {
+				return start, s.pos, nil
+			}
+			if !s.consume(',') {
+				err = ErrorWrongMessage
+				return
+			}
+		}
+	case s.literal("true"), s.literal("false"), s.literal("null"):
+		return start, s.pos, nil
+	case c == '-' || c >= '0' && c <= '9':
+		for s.pos < len(s.text) {
+			if c := s.text[s.pos]; c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E' || c >= '0' && c <= '9' {
+				s.pos++
+				continue
+			}
+			break
+		}
+		end = s.pos
+		if !json.Valid(s.text[start:end]) {
+			err = ErrorWrongMessage
+		}
 		return
 	}
-	left = string(bytes[:c.rest-1])
-	right = string(bytes[c.end+1 : c.start-1])
+	err = ErrorWrongMessage
 	return
 }
@@ -0,0 +1,171 @@
+package gosocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// DialFunc establish a connection to the server and start receiving on it,
+// see tcpsocket.Dialer and websocket.Dialer
+type DialFunc func(ctx context.Context, i *Initiator) (ConnFace, error)
+
+// Backoff is the exponential backoff with jitter between the attempts of reconnection
+type Backoff struct {
+	Min    time.Duration // the delay of the first retry
+	Max    time.Duration // the max delay
+	Factor float64       // the delay is multiplied by the factor after each failed attempt
+	Jitter float64       // randomize the delay by ±Jitter*delay, from 0 to 1
+}
+
+var DefaultBackoff = Backoff{Min: 500 * time.Millisecond, Max: 30 * time.Second, Factor: 2, Jitter: 0.2}
+
+// Duration get the delay before the attempt, which starts from 1
+func (b Backoff) Duration(attempt int) time.Duration {
+	d := float64(b.Min)
+	for n := 1; n < attempt && d < float64(b.Max); n++ {
+		d *= b.Factor
+	}
+	if d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+type subscription struct {
+	event string
+	args  interface{}
+}
+
+// Subscribe emit the event to the server, and emit it again after each reconnection,
+// it is used to declare the room joins and subscriptions which should survive the reconnections,
+// the event is only recorded while disconnected, it will be emitted once connected
+func (i *Initiator) Subscribe(event string, args interface{}) {
+	key := subscriptionKey(event, args)
+	i.mu.Lock()
+	if _, ok := i.subscriptions[key]; !ok {
+		i.subscriptionKeys = append(i.subscriptionKeys, key)
+	}
+	i.subscriptions[key] = subscription{event, args}
+	i.mu.Unlock()
+	if i.Alive() {
+		i.Conn().Emit(event, args, "")
+	}
+}
+
+// Unsubscribe forget the subscription, it will not be emitted after reconnection any more,
+// nothing is sent to the server, emit the leave or unsubscribe event yourself
+func (i *Initiator) Unsubscribe(event string, args interface{}) {
+	key := subscriptionKey(event, args)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, ok := i.subscriptions[key]; !ok {
+		return
+	}
+	delete(i.subscriptions, key)
+	for n, k := range i.subscriptionKeys {
+		if k == key {
+			i.subscriptionKeys = append(i.subscriptionKeys[:n], i.subscriptionKeys[n+1:]...)
+			break
+		}
+	}
+}
+
+func subscriptionKey(event string, args interface{}) string {
+	b, _ := json.Marshal(args)
+	return event + "|" + string(b)
+}
+
+// SetOfflineBuffer buffer at most n messages emitted while disconnected,
+// they are sent after the connection is established, the messages are dropped if n is 0 (the default)
+func (i *Initiator) SetOfflineBuffer(n int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.offlineBufferSize = n
+}
+
+// buffer the message emitted while disconnected, it is dropped if the buffer is full
+func (i *Initiator) buffer(event string, args interface{}, id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.offlineBufferSize <= 0 {
+		return
+	}
+	if len(i.offlineBuffer) >= i.offlineBufferSize {
+		log.Println("[initiator][buffer] message not sent, the offline buffer was full:", event, args, id)
+		return
+	}
+	i.offlineBuffer = append(i.offlineBuffer, offlineMessage{event, args, id})
+}
+
+// replay the subscriptions if required and send the buffered messages to the new connection
+func (i *Initiator) replay(c ConnFace, subscribe bool) {
+	i.mu.Lock()
+	subscriptions := make([]subscription, 0, len(i.subscriptionKeys))
+	for _, key := range i.subscriptionKeys {
+		if subscribe {
+			subscriptions = append(subscriptions, i.subscriptions[key])
+		}
+	}
+	buffered := i.offlineBuffer
+	i.offlineBuffer = nil
+	i.mu.Unlock()
+
+	for _, s := range subscriptions {
+		c.Emit(s.event, s.args, "")
+	}
+	for _, m := range buffered {
+		c.Emit(m.event, m.args, m.id)
+	}
+}
+
+// Disconnected get the signal channel which is closed after the current connection was closed
+func (i *Initiator) Disconnected() chan struct{} {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.disconnected
+}
+
+// Reconnect keep the initiator connected to the server, it blocks until the ctx is done.
+// After the connection was closed, it dials again with the backoff,
+// OnConnection is triggered again once the socket id is received from the new connection,
+// and the subscriptions are replayed before that
+func (i *Initiator) Reconnect(ctx context.Context, dial DialFunc, b Backoff) {
+	attempt := 0
+	for ctx.Err() == nil {
+		if attempt > 0 {
+			select {
+			case <-time.After(b.Duration(attempt)):
+			case <-ctx.Done():
+				return
+			}
+		}
+		c, err := dial(ctx, i)
+		if err != nil {
+			attempt++
+			log.Println("[initiator][reconnect] dial error:", err, attempt)
+			continue
+		}
+		i.SetConn(c)
+		disconnected := i.Disconnected()
+		select {
+		case <-disconnected:
+		case <-ctx.Done():
+			if closer, ok := c.(interface{ Close() }); ok {
+				closer.Close()
+			}
+			<-disconnected
+		}
+		if c.Id() == "" {
+			// closed before the socket id was received, e.g. rejected by the server, back off
+			attempt++
+		} else {
+			attempt = 0
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package gosocket
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/plhwin/gosocket/conf"
+)
+
+const (
+	OnResume         = "resume"        // triggered after a client resumed its previous session, the client id was changed to the previous one
+	EventResumeToken = "socket:token"  // the server send the resume token of the session after the socket id
+	EventResume      = "socket:resume" // the client request to resume the previous session by a new connection
+)
+
+// Resume keeps the session of a disconnected client for a grace window,
+// the rooms of the client are kept and the messages sent to it are buffered,
+// if the client comes back with the previous socket id and resume token in time,
+// the rooms are restored and the buffered messages are replayed to the new connection,
+// otherwise the session is ended and the event OnDisconnection is triggered
+type Resume struct {
+	Grace      time.Duration // how long the session is kept after disconnected, 0 means disabled
+	BufferSize int           // the max number of messages buffered for the session, the oldest is dropped if full
+}
+
+// ResumeToken is the args of the event EventResumeToken and EventResume
+type ResumeToken struct {
+	Id    string `json:"id"`    // the socket id of the session
+	Token string `json:"token"` // the secret to resume the session
+}
+
+// the client id was changed from the id
+type clientRename struct {
+	from   string
+	client ClientFace
+}
+
+type bufferedEmit struct {
+	event string
+	msg   []byte
+}
+
+// SetResume set the session resumption of the acceptor, it takes effect on the clients connected afterwards
+func (a *Acceptor) SetResume(r Resume) {
+	if r.BufferSize <= 0 {
+		r.BufferSize = 100
+	}
+	a.resume = r
+}
+
+func (a *Acceptor) Resume() Resume {
+	return a.resume
+}
+
+// issue a resume token to the new client if the session resumption is enabled
+func (a *Acceptor) issueToken(c ClientFace) {
+	b, ok := baseOf(c)
+	if a.resume.Grace <= 0 || !ok {
+		return
+	}
+	token := ResumeToken{Id: c.Id(), Token: newMessageId()}
+	b.setToken(token.Token)
+	c.Emit(EventResumeToken, token, "")
+}
+
+// suspend keep the session of the disconnected client, return false if the session resumption is disabled
+func (a *Acceptor) suspend(c ClientFace) bool {
+	b, ok := baseOf(c)
+	if a.resume.Grace <= 0 || a.Closing() || !ok {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.token == "" {
+		return false
+	}
+	// the messages not sent yet by the closed connection are replayed first
+	for _, msg := range b.TakeCoalesced() {
+		b.buffered = append(b.buffered, bufferedEmit{msg: msg})
+	}
+	atomic.StoreInt32(&b.suspended, 1)
+	b.expire = time.AfterFunc(a.resume.Grace, func() {
+		if _, ok := b.takeSession(""); ok {
+			a.disconnect(c)
+		}
+	})
+	return true
+}
+
+// endSessions end all the suspended sessions immediately, usually called when shutting down
+func (a *Acceptor) endSessions() {
+	for _, c := range a.Clients() {
+		if b, ok := baseOf(c); ok {
+			if _, ok = b.takeSession(""); ok {
+				a.disconnect(c)
+			}
+		}
+	}
+}
+
+// resumeSession the new client c request to resume the session with the previous socket id and resume token,
+// the reply carries the new resume token, or false if the session can not be resumed.
+// The session is only resumed by the same identity, and the same send codec,
+// since the buffered messages were encoded by the codec of the previous connection
+func (a *Acceptor) resumeSession(c ClientFace, req ResumeToken, id string) {
+	prev, ok := a.Client(req.Id)
+	if !ok || prev == c || req.Token == "" {
+		c.Emit(EventResume, false, id)
+		return
+	}
+	// the session can only be taken over by the client embedding Client as well
+	b, ok := baseOf(c)
+	p, pok := baseOf(prev)
+	if !ok || !pok {
+		c.Emit(EventResume, false, id)
+		return
+	}
+	// checked before taking the session, so that it can still be resumed by its owner
+	if !sameIdentity(p.Identity(), b.Identity()) {
+		log.Println("[acceptor][resume] identity mismatched:", req.Id, c.Id(), c.RemoteAddr())
+		c.Emit(EventResume, false, id)
+		return
+	}
+	if p.SendCodec() != b.SendCodec() {
+		log.Println("[acceptor][resume] codec mismatched:", req.Id, p.SendCodec().String(), b.SendCodec().String(), c.Id(), c.RemoteAddr())
+		c.Emit(EventResume, false, id)
+		return
+	}
+	buffered, ok := p.takeSession(req.Token)
+	if !ok {
+		c.Emit(EventResume, false, id)
+		return
+	}
+	rooms := prev.Rooms()
+	// the previous client leave silently, its session is taken over by the new client
+	prev.LeaveAll()
+	from := c.Id()
+	b.SetId(req.Id)
+	select {
+	case a.rename <- clientRename{from, c}:
+	case <-a.done:
+	}
+	a.release()
+	for room := range rooms {
+		c.Join(room)
+	}
+
+	token := ResumeToken{Id: req.Id, Token: newMessageId()}
+	b.setToken(token.Token)
+	c.Emit(EventResume, token, id)
+	for _, m := range buffered {
+		b.send(m.event, m.msg, true)
+	}
+	a.CallGivenEvent(c, OnResume)
+}
+
+// sameIdentity whether the identities are authenticated as the same user, or both are not authenticated
+func sameIdentity(x, y *Identity) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return x.UserId == y.UserId
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// buffer keep the message for the suspended session, return false if the client is not suspended
+func (c *Client) buffer(event string, msg []byte) bool {
+	if atomic.LoadInt32(&c.suspended) == 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if atomic.LoadInt32(&c.suspended) == 0 {
+		return false
+	}
+	if len(c.buffered) >= c.acceptor.resume.BufferSize {
+		c.buffered = c.buffered[1:]
+		c.drop()
+	}
+	c.buffered = append(c.buffered, bufferedEmit{event, msg})
+	return true
+}
+
+// takeSession end the suspended session and take the buffered messages,
+// the token is verified unless it is empty, return false if the client is not suspended or the token mismatched
+func (c *Client) takeSession(token string) (buffered []bufferedEmit, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if atomic.LoadInt32(&c.suspended) == 0 {
+		return
+	}
+	if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) != 1 {
+		return
+	}
+	atomic.StoreInt32(&c.suspended, 0)
+	c.expire.Stop()
+	buffered, c.buffered = c.buffered, nil
+	return buffered, true
+}
+
+// the server issued the resume token of the current session
+func (i *Initiator) resumeToken(c ConnFace, token ResumeToken) {
+	// ignore the token of the new session if the previous one was resumed
+	if id := c.Id(); id != "" && id != token.Id {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.session = &token
+}
+
+// Session get the resume token of the current session, nil if the server did not issue one
+func (i *Initiator) Session() *ResumeToken {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.session
+}
+
+// resumeSession request the server to resume the previous session, return true if resumed
+func (i *Initiator) resumeSession(c ConnFace) bool {
+	i.mu.Lock()
+	prev := i.previous
+	i.previous = nil
+	i.mu.Unlock()
+	if prev == nil {
+		return false
+	}
+
+	id := newMessageId()
+	reply, _ := i.replies.add(id)
+	defer i.replies.remove(id)
+	c.Emit(EventResume, prev, id)
+	timer := time.NewTimer(time.Duration(conf.Initiator.EmitSync.Timeout) * time.Second)
+	defer timer.Stop()
+
+	var token ResumeToken
+	select {
+	case msg, ok := <-reply:
+		if !ok || msg.Args == "" {
+			return false
+		}
+		if err := json.Unmarshal([]byte(msg.Args), &token); err != nil || token.Id != prev.Id {
+			return false
+		}
+	case <-timer.C:
+		log.Println("[initiator][resume] no reply from the server:", prev.Id)
+		return false
+	}
+	c.SetId(token.Id)
+	i.mu.Lock()
+	i.session = &token
+	i.mu.Unlock()
+	return true
+}
@@ -21,10 +21,12 @@ type rooms struct {
 	join      chan roomClient  // client request to join a room
 	leave     chan roomClient  // client request to leave a room
 	leaveAll  chan *Client     // client request to leave all of the rooms
+	done      chan struct{}    // stop running after the acceptor shutdown
 }
 
-func newRooms() *rooms {
+func newRooms(done chan struct{}) *rooms {
 	return &rooms{
+		done:      done,
 		clients:   new(sync.Map),
 		broadcast: make(chan roomMessage),
 		join:      make(chan roomClient),
@@ -36,6 +38,8 @@ func newRooms() *rooms {
 func (r *rooms) Run() {
 	for {
 		select {
+		case <-r.done:
+			return
 		// client request to join a room
 		case rc := <-r.join:
 			if v, ok := r.clients.Load(rc.room); ok {
@@ -63,7 +67,7 @@ func (r *rooms) Run() {
 		case rm := <-r.broadcast:
 			if v, ok := r.clients.Load(rm.room); ok {
 				v.(*sync.Map).Range(func(k, _ interface{}) bool {
-					k.(*Client).Emit(rm.event, rm.args, rm.id)
+					k.(*Client).broadcast(rm.event, rm.args, rm.id)
 					return true
 				})
 			}
@@ -86,5 +90,8 @@ func (r *rooms) RemoveAll(c *Client) {
 
 // broadcast message to room
 func (r *rooms) BroadcastTo(room, event string, args interface{}, id string) {
-	r.broadcast <- roomMessage{room, event, args, id}
+	select {
+	case r.broadcast <- roomMessage{room, event, args, id}:
+	case <-r.done:
+	}
 }
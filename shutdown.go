@@ -0,0 +1,111 @@
+package gosocket
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+)
+
+// EventGoingAway is the suggested event to notify the clients that the server is shutting down
+const EventGoingAway = "server:goaway"
+
+// SetGoingAway set the event broadcast to all the clients when the acceptor is shutting down,
+// the event is not broadcast if it is empty
+func (a *Acceptor) SetGoingAway(event string, args interface{}) {
+	a.goingAwayEvent = event
+	a.goingAwayArgs = args
+}
+
+// Closing whether the acceptor is shutting down, the new clients should be rejected, see TryJoin
+func (a *Acceptor) Closing() bool {
+	return atomic.LoadInt32(&a.closing) == 1
+}
+
+// Shutdown gracefully shut down the acceptor:
+// stop accepting new clients, broadcast the going away event if set,
+// flush the message send channel of each client and close the connection,
+// then wait for all the clients to leave and their OnDisconnection handlers to return.
+// If the ctx expires first, the remaining clients are closed immediately and the ctx error is returned
+func (a *Acceptor) Shutdown(ctx context.Context) error {
+	if a.close() {
+		clients := a.Clients()
+		if a.goingAwayEvent != "" {
+			// only the local clients, the other nodes of the cluster are still working
+			for _, c := range clients {
+				c.Emit(a.goingAwayEvent, a.goingAwayArgs, "")
+			}
+		}
+		for _, c := range clients {
+			if b, ok := baseOf(c); ok {
+				b.Drain()
+				continue
+			}
+			// the client can not be drained, close the connection
+			c.CloseConnCtx()
+		}
+		// the suspended sessions can not be resumed any more
+		a.endSessions()
+		// stop the goroutines of the acceptor after all the clients left
+		go func() {
+			a.waitClients(context.Background())
+			close(a.done)
+		}()
+	}
+
+	if err := a.waitClients(ctx); err != nil {
+		for _, c := range a.Clients() {
+			log.Println("[acceptor][shutdown] force close:", c.Id(), c.RemoteAddr())
+			c.CloseConnCtx()
+		}
+		return err
+	}
+	return nil
+}
+
+// close mark the acceptor as shutting down, return false if it was already closing.
+// No client can join afterwards by TryJoin, so all the clients to be drained are in the clients map,
+// and the idle channel is closed once the active clients are released
+func (a *Acceptor) close() bool {
+	a.activeMu.Lock()
+	defer a.activeMu.Unlock()
+	if !atomic.CompareAndSwapInt32(&a.closing, 0, 1) {
+		return false
+	}
+	a.wakeIdle()
+	return true
+}
+
+// wakeIdle close the idle channel if all the clients left after shutting down, the caller must hold activeMu.
+// The client joined by Join after shutting down may leave again, so the idle channel is closed only once
+func (a *Acceptor) wakeIdle() {
+	if a.active > 0 || !a.Closing() {
+		return
+	}
+	select {
+	case <-a.idle:
+	default:
+		close(a.idle)
+	}
+}
+
+// waitClients wait until all the clients left or the ctx expires
+func (a *Acceptor) waitClients(ctx context.Context) error {
+	select {
+	case <-a.idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Drain flush the messages waiting to be sent and then close the connection
+func (c *Client) Drain() {
+	c.drainOnce.Do(func() {
+		close(c.draining)
+	})
+}
+
+// Draining the signal channel to drain the client
+func (c *Client) Draining() chan struct{} {
+	return c.draining
+}
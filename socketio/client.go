@@ -0,0 +1,228 @@
+package socketio
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+)
+
+// NewAcceptor create the acceptor of the Socket.IO namespace, the messages are formatted as the Socket.IO packets
+func NewAcceptor() *gosocket.Acceptor {
+	a := gosocket.NewAcceptor()
+	a.SetProtocol(protocol.GetTextProtocol(conf.TextProtocolSocketIO))
+	return a
+}
+
+// Client the Socket.IO client connected to a namespace, the clients of the namespaces share the same connection
+type Client struct {
+	gosocket.Client
+	session      *session
+	nsp          string          // the namespace
+	auth         json.RawMessage // the auth payload of the connect packet
+	ackId        uint64          // the last ack id of EmitWithAck
+	acks         sync.Map        // map[ack id]chan *protocol.Message, waiting for the ack packets
+	disconnected int32           // the client disconnected from the namespace by itself
+}
+
+func (c *Client) init(s *session, nsp string, a *gosocket.Acceptor, auth []byte) {
+	c.session = s
+	c.nsp = nsp
+	c.auth = auth
+
+	// 设置远程连接地址
+	c.SetRemoteAddr(s.remoteAddr)
+
+	// 初始化客户端，连接上下文随会话关闭
+	c.Init(s.ctx, a)
+	c.SetIdentity(s.identity)
+	c.SetPeerCertificate(s.peerCert)
+
+	// the Socket.IO packets are the json text
+	c.SetCodec(protocol.Codec{Serialize: conf.TransportSerializeText, Compress: conf.TransportCompressNone})
+}
+
+// Namespace the namespace connected by the client
+func (c *Client) Namespace() string {
+	return c.nsp
+}
+
+// Sid the Engine.IO session id, which is shared by the clients of the namespaces
+func (c *Client) Sid() string {
+	return c.session.id
+}
+
+// Auth the auth payload of the connect packet, e.g. io(url, {auth: {token: "abc"}}), empty if not sent
+func (c *Client) Auth() json.RawMessage {
+	return c.auth
+}
+
+// Close disconnect the client from the namespace, the connection is closed by the peer or the last namespace
+func (c *Client) Close() {
+	c.CloseConnCtx()
+}
+
+// disconnect the client from the namespace, byPeer means the disconnect packet was sent by the peer
+func (c *Client) disconnect(byPeer bool) {
+	if byPeer {
+		atomic.StoreInt32(&c.disconnected, 1)
+	}
+	c.CloseConnCtx()
+}
+
+// EmitWithAck send the event packet with the ack id, the returned channel receives the args of the ack packet,
+// or an error if the message was not sent, the client was disconnected, or no ack within the timeout,
+// a timeout <= 0 means waiting until the ack or the client disconnected.
+// The message is not buffered or coalesced by the backpressure policy, it is dropped if the send channel is full
+func (c *Client) EmitWithAck(event string, args interface{}, timeout time.Duration) <-chan gosocket.Ack {
+	ack := make(chan gosocket.Ack, 1)
+	msg, err := c.Acceptor().EncodeCodec(event, args, "", c.SendCodec())
+	if err != nil {
+		ack <- gosocket.Ack{Err: err}
+		return ack
+	}
+	// insert the ack id after the packet type, e.g. 2["event",args] => 212["event",args]
+	id := strconv.FormatUint(atomic.AddUint64(&c.ackId, 1), 10)
+	msg = append(append([]byte{msg[0]}, id...), msg[1:]...)
+
+	reply := make(chan *protocol.Message, 1)
+	c.acks.Store(id, reply)
+	select {
+	case <-c.Context().Done():
+		err = gosocket.ErrorEmitClosed
+	case c.Out() <- msg:
+	default:
+		err = gosocket.ErrorEmitDropped
+	}
+	if err != nil {
+		c.acks.Delete(id)
+		ack <- gosocket.Ack{Err: err}
+		return ack
+	}
+
+	go func() {
+		defer c.acks.Delete(id)
+		var expired <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case msg := <-reply:
+			var result interface{}
+			var err error
+			if msg.Args != "" {
+				err = json.Unmarshal([]byte(msg.Args), &result)
+			}
+			ack <- gosocket.Ack{Result: result, Err: err}
+		case <-expired:
+			ack <- gosocket.Ack{Err: gosocket.ErrorAckTimeout}
+		case <-c.Context().Done():
+			ack <- gosocket.Ack{Err: gosocket.ErrorAckDisconnected}
+		}
+	}()
+	return ack
+}
+
+// ResolveAck deliver the ack packet to the waiter of EmitWithAck, return false if the message is not an ack
+func (c *Client) ResolveAck(msg *protocol.Message) bool {
+	if msg.Event != protocol.SocketIOAckEvent {
+		return false
+	}
+	reply, ok := c.acks.LoadAndDelete(msg.Id)
+	if !ok {
+		return false
+	}
+	reply.(chan *protocol.Message) <- msg
+	return true
+}
+
+// process the event or ack packet received
+func (c *Client) process(p packet) {
+	// the packet of the main namespace is decoded by the text protocol of the acceptor
+	switch p.typ {
+	case packetBinaryEvent:
+		p.typ = packetEvent
+	case packetBinaryAck:
+		p.typ = packetAck
+	}
+	p.nsp, p.attachments = MainNamespace, 0
+	message, err := c.Acceptor().DecodeCodec(p.append(nil), c.ReceiveCodec())
+	if err != nil {
+		log.Println("[SocketIO][client][read] msg decode error:", err, string(p.data), c.Id(), c.RemoteAddr())
+		return
+	}
+	c.Acceptor().CallEvent(c, message)
+}
+
+func (c *Client) write() {
+	defer func() {
+		c.session.remove(c)
+		// Give a signal to the sender(Emit)
+		// Can not close c.Out() here
+		close(c.StopOut())
+		c.Acceptor().Leave(c)
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.Out():
+			if !ok {
+				log.Println("[SocketIO][client][write] msg send channel has been closed:", c.Id(), c.RemoteAddr())
+				return
+			}
+			if err := c.writeMessage(msg); err != nil {
+				return
+			}
+		case <-c.Coalesced():
+			for _, msg := range c.TakeCoalesced() {
+				if err := c.writeMessage(msg); err != nil {
+					return
+				}
+			}
+		case <-c.Draining():
+			// the acceptor is shutting down, flush the messages waiting to be sent,
+			// then disconnect the client from the namespace
+			for _, msg := range c.TakeCoalesced() {
+				if err := c.writeMessage(msg); err != nil {
+					return
+				}
+			}
+			c.session.writePacket(packet{typ: packetDisconnect, nsp: c.nsp}, nil)
+			return
+		case <-c.Context().Done():
+			// e.g. disconnect the slow client by the backpressure policy, or the session was closed
+			if c.session.ctx.Err() == nil && atomic.LoadInt32(&c.disconnected) == 0 {
+				c.session.writePacket(packet{typ: packetDisconnect, nsp: c.nsp}, nil)
+			}
+			return
+		}
+	}
+}
+
+// writeMessage write the packet encoded by the text protocol to the namespace, the binary data is sent as the attachments
+func (c *Client) writeMessage(msg []byte) error {
+	p, err := parsePacket(msg)
+	if err != nil {
+		log.Println("[SocketIO][client][write] packet error:", err, string(msg), c.Id(), c.RemoteAddr())
+		return nil
+	}
+	var attachments [][]byte
+	if p.data, attachments, err = takeAttachments(p.data); err != nil {
+		log.Println("[SocketIO][client][write] attachments error:", err, string(msg), c.Id(), c.RemoteAddr())
+		return nil
+	}
+	if len(attachments) > 0 {
+		p.typ += packetBinaryEvent - packetEvent
+		p.attachments = len(attachments)
+	}
+	p.nsp = c.nsp
+	return c.session.writePacket(p, attachments)
+}
@@ -0,0 +1,37 @@
+package socketio
+
+import (
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/websocket"
+)
+
+type options struct {
+	namespaces map[string]*gosocket.Acceptor
+	websocket  []websocket.Option
+}
+
+// Option configures the Serve
+type Option func(*options)
+
+func newOptions(a *gosocket.Acceptor, opts []Option) *options {
+	o := &options{namespaces: map[string]*gosocket.Acceptor{MainNamespace: a}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithNamespace serve the namespace by the acceptor, e.g. "/admin",
+// the acceptor should be created by NewAcceptor, the clients connecting to the other namespaces are rejected
+func WithNamespace(nsp string, a *gosocket.Acceptor) Option {
+	return func(o *options) {
+		o.namespaces[nsp] = a
+	}
+}
+
+// WithWebsocket set the options of the websocket upgrade, such as the authenticator and the allowed origins
+func WithWebsocket(opts ...websocket.Option) Option {
+	return func(o *options) {
+		o.websocket = append(o.websocket, opts...)
+	}
+}
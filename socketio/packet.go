@@ -0,0 +1,230 @@
+package socketio
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// the Engine.IO v4 packet types
+const (
+	engineOpen    = '0'
+	engineClose   = '1'
+	enginePing    = '2'
+	enginePong    = '3'
+	engineMessage = '4'
+	engineUpgrade = '5'
+	engineNoop    = '6'
+)
+
+// the Socket.IO v5 packet types, which is used by the Socket.IO v4 clients
+const (
+	packetConnect      = '0'
+	packetDisconnect   = '1'
+	packetEvent        = '2'
+	packetAck          = '3'
+	packetConnectError = '4'
+	packetBinaryEvent  = '5'
+	packetBinaryAck    = '6'
+)
+
+// MainNamespace the namespace connected by default
+const MainNamespace = "/"
+
+// the max number of the binary attachments of a packet, the same as the default of socket.io-parser
+const maxAttachments = 10
+
+var (
+	ErrorWrongPacket        = errors.New("wrong Socket.IO packet")
+	ErrorTooManyAttachments = errors.New("too many binary attachments of the Socket.IO packet")
+	ErrorPacketTooLarge     = errors.New("the Socket.IO packet with the binary attachments is too large")
+	ErrorUnexpectedBinary   = errors.New("unexpected binary attachment without the Socket.IO packet")
+)
+
+// packet the Socket.IO packet formatted as $type[$attachments-][$namespace,][$id][$data]
+type packet struct {
+	typ         byte
+	attachments int    // the number of the binary attachments following the packet
+	nsp         string // the namespace
+	id          string // the ack id
+	data        []byte // the json payload
+}
+
+func parsePacket(b []byte) (p packet, err error) {
+	if len(b) == 0 || b[0] < packetConnect || b[0] > packetBinaryAck {
+		return p, ErrorWrongPacket
+	}
+	p.typ, b = b[0], b[1:]
+	if p.typ == packetBinaryEvent || p.typ == packetBinaryAck {
+		n := bytes.IndexByte(b, '-')
+		if n <= 0 {
+			return p, ErrorWrongPacket
+		}
+		if p.attachments, err = strconv.Atoi(string(b[:n])); err != nil || p.attachments < 0 {
+			return p, ErrorWrongPacket
+		}
+		if p.attachments > maxAttachments {
+			return p, ErrorTooManyAttachments
+		}
+		b = b[n+1:]
+	}
+	p.nsp = MainNamespace
+	if len(b) > 0 && b[0] == '/' {
+		n := bytes.IndexByte(b, ',')
+		if n < 0 {
+			// the namespace without payload, e.g. 1/admin
+			n = len(b)
+		}
+		p.nsp, b = string(b[:n]), b[min(n+1, len(b)):]
+	}
+	n := 0
+	for n < len(b) && b[n] >= '0' && b[n] <= '9' {
+		n++
+	}
+	p.id, p.data = string(b[:n]), b[n:]
+	return
+}
+
+// assembler assemble the binary packet with the attachments following it,
+// the size of the packet and the attachments is limited by maxSize
+type assembler struct {
+	maxSize     int
+	pending     *packet // the binary packet waiting for the attachments
+	attachments [][]byte
+	size        int
+}
+
+// wait for the attachments of the binary packet, return false if the packet has no attachment
+func (a *assembler) wait(p packet) bool {
+	if p.attachments == 0 {
+		return false
+	}
+	a.pending, a.attachments, a.size = &p, nil, len(p.data)
+	return true
+}
+
+// attach the binary attachment to the pending packet, the packet is returned once all the attachments arrived,
+// the connection should be closed if an error is returned
+func (a *assembler) attach(b []byte) (p packet, ok bool, err error) {
+	if a.pending == nil {
+		return p, false, ErrorUnexpectedBinary
+	}
+	if a.size += len(b); a.maxSize > 0 && a.size > a.maxSize {
+		return p, false, ErrorPacketTooLarge
+	}
+	if a.attachments = append(a.attachments, b); len(a.attachments) < a.pending.attachments {
+		return p, false, nil
+	}
+	p = *a.pending
+	p.data, err = putAttachments(p.data, a.attachments)
+	a.pending, a.attachments, a.size = nil, nil, 0
+	return p, err == nil, err
+}
+
+func (p packet) append(dst []byte) []byte {
+	dst = append(dst, p.typ)
+	if p.typ == packetBinaryEvent || p.typ == packetBinaryAck {
+		dst = strconv.AppendInt(dst, int64(p.attachments), 10)
+		dst = append(dst, '-')
+	}
+	if p.nsp != MainNamespace && p.nsp != "" {
+		dst = append(dst, p.nsp...)
+		dst = append(dst, ',')
+	}
+	dst = append(dst, p.id...)
+	return append(dst, p.data...)
+}
+
+// Binary the binary data sent as the attachment of the Socket.IO packet, e.g. c.Emit("file", socketio.Binary(data), ""),
+// which is received as the ArrayBuffer or Buffer by the clients,
+// the binary attachments received are decoded into the []byte args as well.
+// It is marshalled as the placeholder object, so it must not be sent by the other transports
+type Binary []byte
+
+// the placeholder of the binary data before it is taken out as the attachment
+type binaryPlaceholder struct {
+	Placeholder bool   `json:"_placeholder"`
+	Data        []byte `json:"data"`
+}
+
+func (b Binary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(binaryPlaceholder{Placeholder: true, Data: b})
+}
+
+var placeholderKey = []byte(`"_placeholder":true`)
+
+// takeAttachments take the binary data out of the json payload, and replace them with the numbered placeholders
+func takeAttachments(data []byte) ([]byte, [][]byte, error) {
+	if !bytes.Contains(data, placeholderKey) {
+		return data, nil, nil
+	}
+	var attachments [][]byte
+	replaced, err := replacePlaceholders(data, func(m map[string]interface{}) (interface{}, error) {
+		s, ok := m["data"].(string)
+		if !ok {
+			return m, nil
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, b)
+		return map[string]interface{}{"_placeholder": true, "num": len(attachments) - 1}, nil
+	})
+	return replaced, attachments, err
+}
+
+// putAttachments replace the numbered placeholders of the json payload with the binary data,
+// which is the base64 string decoded into the []byte args
+func putAttachments(data []byte, attachments [][]byte) ([]byte, error) {
+	return replacePlaceholders(data, func(m map[string]interface{}) (interface{}, error) {
+		num, ok := m["num"].(json.Number)
+		if !ok {
+			return nil, ErrorWrongPacket
+		}
+		n, err := strconv.Atoi(num.String())
+		if err != nil || n < 0 || n >= len(attachments) {
+			return nil, ErrorWrongPacket
+		}
+		return attachments[n], nil
+	})
+}
+
+// replacePlaceholders replace the placeholder objects of the json payload
+func replacePlaceholders(data []byte, f func(map[string]interface{}) (interface{}, error)) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	v, err := walkPlaceholders(v, f)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func walkPlaceholders(v interface{}, f func(map[string]interface{}) (interface{}, error)) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case []interface{}:
+		for i := range v {
+			if v[i], err = walkPlaceholders(v[i], f); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		if placeholder, _ := v["_placeholder"].(bool); placeholder {
+			return f(v)
+		}
+		for k := range v {
+			if v[k], err = walkPlaceholders(v[k], f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
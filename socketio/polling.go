@@ -0,0 +1,224 @@
+package socketio
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	gows "github.com/plhwin/gosocket/websocket"
+)
+
+// the separator of the Engine.IO packets in the payload of the polling transport
+const recordSeparator = 0x1e
+
+// servePolling open the session by the handshake request of the polling transport,
+// the open packet is the response, and the session can be upgraded to the websocket
+func servePolling(baseCtx context.Context, o *options, w http.ResponseWriter, r *http.Request) {
+	a := o.namespaces[MainNamespace]
+	if r.Method != http.MethodGet {
+		rejectHandshake(w, handshakeError{Code: 2, Message: "Bad handshake method"})
+		return
+	}
+	// the acceptor is shutting down
+	if a.Closing() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	// the same authenticator as the websocket, the rejected peer will never be registered
+	identity, err := gows.Authenticate(r, o.websocket...)
+	if err != nil {
+		log.Println("[SocketIO][session][polling] authenticate error:", err, r.RemoteAddr)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	s := newSession(baseCtx, o, r, gosocket.RemoteAddr(r), identity)
+	sessions.Store(s.id, s)
+	go s.heartbeat()
+
+	writePayload(w, []frame{{data: s.openPacket([]string{"websocket"})}})
+}
+
+// poll the GET request of the polling transport, which waits for the packets to be sent,
+// only one poll request of the session is allowed at the same time
+func (s *session) poll(w http.ResponseWriter, r *http.Request) {
+	if !atomic.CompareAndSwapInt32(&s.polling, 0, 1) {
+		// the overlapping poll requests, the packets can not be delivered in order
+		rejectHandshake(w, handshakeError{Code: 3, Message: "Bad request"})
+		s.close()
+		return
+	}
+	defer atomic.StoreInt32(&s.polling, 0)
+	if frames, ok := s.take(r.Context()); ok {
+		writePayload(w, frames)
+	}
+}
+
+// take the frames buffered, wait until any frame is buffered, or the session was closed or upgraded,
+// return false if the request was cancelled
+func (s *session) take(ctx context.Context) ([]frame, bool) {
+	for {
+		s.writeMu.Lock()
+		if len(s.buffered) > 0 {
+			frames := s.buffered
+			s.buffered, s.size = nil, 0
+			close(s.drained)
+			s.drained = make(chan struct{})
+			s.writeMu.Unlock()
+			return frames, true
+		}
+		upgraded := s.conn != nil
+		s.writeMu.Unlock()
+		if upgraded {
+			// the packets afterwards are sent by the websocket
+			return []frame{{data: []byte{engineNoop}}}, true
+		}
+		select {
+		case <-s.flushed:
+		case <-s.ctx.Done():
+			return []frame{{data: []byte{engineClose}}}, true
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// receivePayload the POST request of the polling transport, which sends the packets of the payload
+func (s *session) receivePayload(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(conf.Acceptor.Transport.MaxMessageSize)))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			s.o.namespaces[MainNamespace].AddOversized()
+		}
+		log.Println("[SocketIO][session][polling] payload error:", err, s.id, s.remoteAddr)
+		rejectHandshake(w, handshakeError{Code: 3, Message: "Bad request"})
+		s.close()
+		return
+	}
+	for _, data := range bytes.Split(body, []byte{recordSeparator}) {
+		f := frame{data: data}
+		if len(data) > 0 && data[0] == 'b' {
+			if f.data, err = base64.StdEncoding.DecodeString(string(data[1:])); err != nil {
+				log.Println("[SocketIO][session][polling] binary packet error:", err, s.id, s.remoteAddr)
+				rejectHandshake(w, handshakeError{Code: 3, Message: "Bad request"})
+				s.close()
+				return
+			}
+			f.binary = true
+		}
+		if err = s.receive(f); err != nil {
+			log.Println("[SocketIO][session][polling] go away:", err, s.id, s.remoteAddr)
+			s.close()
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte("ok"))
+}
+
+// upgrade the session opened by the polling transport to the websocket:
+// the client sends the ping probe "2probe" and the server replies "3probe" by the websocket,
+// the poll request waiting is released by the noop packet, then the client pauses the polling and sends the upgrade packet,
+// the packets afterwards are sent by the websocket, including the ones buffered for the poll request
+func (s *session) upgrade(w http.ResponseWriter, r *http.Request) {
+	s.writeMu.Lock()
+	upgraded := s.conn != nil
+	s.writeMu.Unlock()
+	if upgraded || !atomic.CompareAndSwapInt32(&s.upgrading, 0, 1) {
+		rejectHandshake(w, handshakeError{Code: 3, Message: "Bad request"})
+		return
+	}
+	defer atomic.StoreInt32(&s.upgrading, 0)
+
+	// the session was authenticated by the handshake request
+	conn, _, _, err := gows.Upgrade(s.o.namespaces[MainNamespace], w, r, append(s.o.websocket, gows.WithAuthenticator(nil))...)
+	if err != nil {
+		return
+	}
+	// the larger message closes the connection by websocket.ErrReadLimit
+	conn.SetReadLimit(int64(conf.Acceptor.Transport.MaxMessageSize))
+	conn.SetReadDeadline(time.Now().Add(time.Duration(conf.Acceptor.Heartbeat.PingInterval*conf.Acceptor.Heartbeat.PingMaxTimes) * time.Second))
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			log.Println("[SocketIO][session][upgrade] probe error:", err, s.id, s.remoteAddr)
+			conn.Close()
+			return
+		}
+		switch {
+		case messageType == websocket.TextMessage && string(data) == string(enginePing)+"probe":
+			if err = conn.WriteMessage(websocket.TextMessage, []byte(string(enginePong)+"probe")); err != nil {
+				conn.Close()
+				return
+			}
+			// release the poll request waiting, so that the client can pause the polling
+			s.write([]byte{engineNoop})
+		case messageType == websocket.TextMessage && string(data) == string(engineUpgrade):
+			if err = s.switchConn(conn); err != nil {
+				log.Println("[SocketIO][session][upgrade] flush error:", err, s.id, s.remoteAddr)
+				s.close()
+				return
+			}
+			go s.read(conn)
+			return
+		default:
+			log.Println("[SocketIO][session][upgrade] unexpected packet:", string(data), s.id, s.remoteAddr)
+			conn.Close()
+			return
+		}
+	}
+}
+
+// switchConn send the frames buffered by the websocket connection, and the frames afterwards as well
+func (s *session) switchConn(conn *websocket.Conn) (err error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn = conn
+	if s.ctx.Err() != nil {
+		return ErrorSessionClosed
+	}
+	for _, f := range s.buffered {
+		if err = conn.WriteMessage(f.messageType(), f.data); err != nil {
+			return
+		}
+	}
+	s.buffered, s.size = nil, 0
+	close(s.drained)
+	s.drained = make(chan struct{})
+	// the poll request waiting is released, and the session can not be found by the poll requests any more
+	select {
+	case s.flushed <- struct{}{}:
+	default:
+	}
+	sessions.CompareAndDelete(s.id, s)
+	return
+}
+
+// writePayload write the frames separated by the record separator, the binary frame is encoded as "b" + base64
+func writePayload(w http.ResponseWriter, frames []frame) {
+	var buf bytes.Buffer
+	for n, f := range frames {
+		if n > 0 {
+			buf.WriteByte(recordSeparator)
+		}
+		if f.binary {
+			buf.WriteByte('b')
+			buf.WriteString(base64.StdEncoding.EncodeToString(f.data))
+			continue
+		}
+		buf.Write(f.data)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,443 @@
+package socketio
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	gows "github.com/plhwin/gosocket/websocket"
+)
+
+// ProtocolVersion the Engine.IO protocol version supported, the EIO query param of the clients
+const ProtocolVersion = "4"
+
+// ErrorSessionClosed the Engine.IO session was closed by the peer or the server
+var ErrorSessionClosed = errors.New("the Engine.IO session was closed")
+
+// the error of the Engine.IO handshake request
+type handshakeError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// the payload of the Engine.IO open packet
+type openPayload struct {
+	Sid          string   `json:"sid"`
+	Upgrades     []string `json:"upgrades"`
+	PingInterval int      `json:"pingInterval"`
+	PingTimeout  int      `json:"pingTimeout"`
+	MaxPayload   int      `json:"maxPayload"`
+}
+
+// session the Engine.IO session, which is shared by the clients of the namespaces,
+// the packets are sent by the websocket connection, or buffered for the poll requests until upgraded to the websocket
+type session struct {
+	id         string
+	conn       *websocket.Conn // nil until upgraded if the session was opened by the polling transport
+	remoteAddr net.Addr
+	identity   *gosocket.Identity
+	peerCert   *x509.Certificate // the client certificate verified by the mutual TLS
+	o          *options
+	ctx        context.Context
+	cancel     context.CancelFunc
+	writeMu    sync.Mutex         // only one writer of the connection, guards the conn and the buffered frames as well
+	clients    map[string]*Client // map[namespace]*Client
+	clientsMu  sync.RWMutex
+	pings      int32 // the number of the pings not replied
+	pingAt     int64 // the time of the last ping in milliseconds
+
+	// the polling transport
+	buffered  []frame       // the frames waiting for the poll request
+	size      int           // the bytes of the buffered frames
+	flushed   chan struct{} // signal the poll request that frames were buffered
+	drained   chan struct{} // closed after the buffered frames were taken by the poll request
+	polling   int32         // whether a poll request is waiting
+	upgrading int32         // whether the websocket upgrade is in progress
+	receiveMu sync.Mutex    // the packets of a session are received in order
+	assembler *assembler    // the binary packet waiting for the attachments
+}
+
+// frame the Engine.IO packet, which is sent as the text or binary websocket message
+type frame struct {
+	binary bool
+	data   []byte
+}
+
+// the sessions opened by the polling transport, which are found by the sid of the poll and upgrade requests
+var sessions sync.Map // map[sid]*session
+
+// Serve handles the Socket.IO clients, e.g. "http://example.com/socket.io/?EIO=4&transport=polling",
+// the main namespace is served by the acceptor, which should be created by NewAcceptor.
+// The clients connect by the polling transport and upgrade to the websocket by default,
+// or connect by the websocket directly, e.g. io(url, {transports: ["websocket"]}),
+// the requests of the same session must be routed to the same server, e.g. by the sticky session of the load balancer
+func Serve(baseCtx context.Context, a *gosocket.Acceptor, w http.ResponseWriter, r *http.Request, opts ...Option) {
+	o := newOptions(a, opts)
+
+	query := r.URL.Query()
+	if query.Get("EIO") != ProtocolVersion {
+		rejectHandshake(w, handshakeError{Code: 5, Message: "Unsupported protocol version"})
+		return
+	}
+	transport, sid := query.Get("transport"), query.Get("sid")
+	if transport != "polling" && transport != "websocket" {
+		rejectHandshake(w, handshakeError{Code: 0, Message: "Transport unknown"})
+		return
+	}
+	if sid == "" {
+		if transport == "polling" {
+			servePolling(baseCtx, o, w, r)
+			return
+		}
+		serveWebsocket(baseCtx, o, w, r)
+		return
+	}
+
+	v, ok := sessions.Load(sid)
+	if !ok || v.(*session).o.namespaces[MainNamespace] != a {
+		rejectHandshake(w, handshakeError{Code: 1, Message: "Session ID unknown"})
+		return
+	}
+	s := v.(*session)
+	if transport == "websocket" {
+		s.upgrade(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.poll(w, r)
+	case http.MethodPost:
+		s.receivePayload(w, r)
+	default:
+		rejectHandshake(w, handshakeError{Code: 2, Message: "Bad handshake method"})
+	}
+}
+
+// serveWebsocket open the session by the websocket connection
+func serveWebsocket(baseCtx context.Context, o *options, w http.ResponseWriter, r *http.Request) {
+	conn, _, identity, err := gows.Upgrade(o.namespaces[MainNamespace], w, r, o.websocket...)
+	if err != nil {
+		return
+	}
+	// the larger message closes the connection by websocket.ErrReadLimit
+	conn.SetReadLimit(int64(conf.Acceptor.Transport.MaxMessageSize))
+
+	s := newSession(baseCtx, o, r, gows.RemoteAddr(conn, r), identity)
+	s.conn = conn
+
+	// the clients connect to the namespaces after the open packet
+	if err = s.write(s.openPacket(nil)); err != nil {
+		log.Println("[SocketIO][session][Serve] open error:", err, s.remoteAddr)
+		s.close()
+		return
+	}
+
+	go s.heartbeat()
+	go s.read(conn)
+}
+
+func newSession(baseCtx context.Context, o *options, r *http.Request, remoteAddr net.Addr, identity *gosocket.Identity) *session {
+	s := &session{
+		id:         gosocket.NewSessionId(),
+		remoteAddr: remoteAddr,
+		identity:   identity,
+		peerCert:   gosocket.VerifiedPeerCertificate(r.TLS),
+		o:          o,
+		clients:    make(map[string]*Client),
+		flushed:    make(chan struct{}, 1),
+		drained:    make(chan struct{}),
+		assembler:  &assembler{maxSize: conf.Acceptor.Transport.MaxMessageSize},
+	}
+	s.ctx, s.cancel = context.WithCancel(baseCtx)
+	return s
+}
+
+// openPacket the Engine.IO open packet with the transports can be upgraded to
+func (s *session) openPacket(upgrades []string) []byte {
+	if upgrades == nil {
+		upgrades = []string{}
+	}
+	open, _ := json.Marshal(openPayload{
+		Sid:          s.id,
+		Upgrades:     upgrades,
+		PingInterval: conf.Acceptor.Heartbeat.PingInterval * 1000,
+		PingTimeout:  conf.Acceptor.Heartbeat.PingInterval * conf.Acceptor.Heartbeat.PingMaxTimes * 1000,
+		MaxPayload:   conf.Acceptor.Transport.MaxMessageSize,
+	})
+	return append([]byte{engineOpen}, open...)
+}
+
+// close the session, the clients of the namespaces leave after their write loops exit
+func (s *session) close() {
+	s.cancel()
+	sessions.CompareAndDelete(s.id, s)
+	s.writeMu.Lock()
+	conn := s.conn
+	s.writeMu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+func rejectHandshake(w http.ResponseWriter, e handshakeError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(e)
+}
+
+// heartbeat the server sends the ping packets, and closes the connection if the client does not reply the pong packets
+func (s *session) heartbeat() {
+	ticker := time.NewTicker(time.Duration(conf.Acceptor.Heartbeat.PingInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if pings := atomic.LoadInt32(&s.pings); int(pings) >= conf.Acceptor.Heartbeat.PingMaxTimes {
+				log.Println("[SocketIO][session][heartbeat] miss pong reply:", s.id, s.remoteAddr, pings)
+				s.close()
+				return
+			}
+			atomic.StoreInt64(&s.pingAt, time.Now().UnixNano()/int64(time.Millisecond))
+			atomic.AddInt32(&s.pings, 1)
+			if err := s.ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// pong update the delay of all the clients of the session
+func (s *session) pong() {
+	atomic.StoreInt32(&s.pings, 0)
+	delay := time.Now().UnixNano()/int64(time.Millisecond) - atomic.LoadInt64(&s.pingAt)
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	for _, c := range s.clients {
+		c.SetDelay(delay)
+	}
+	if conf.Acceptor.Logs.Heartbeat.PongReceive {
+		log.Println("[heartbeat][SocketIO][pong]:", s.id, s.remoteAddr, delay)
+	}
+}
+
+// read the websocket messages until the connection is closed
+func (s *session) read(conn *websocket.Conn) {
+	defer s.close()
+
+	// Tolerate one heartbeat cycle
+	wait := time.Duration((conf.Acceptor.Heartbeat.PingMaxTimes+2)*conf.Acceptor.Heartbeat.PingInterval) * time.Second
+	for {
+		if wait > 0 {
+			conn.SetReadDeadline(time.Now().Add(wait))
+		}
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			if err == websocket.ErrReadLimit {
+				s.o.namespaces[MainNamespace].AddOversized()
+			}
+			log.Println("[SocketIO][session][read] go away:", err, s.id, s.remoteAddr)
+			return
+		}
+		if err = s.receive(frame{binary: messageType == websocket.BinaryMessage, data: data}); err != nil {
+			log.Println("[SocketIO][session][read] go away:", err, s.id, s.remoteAddr)
+			return
+		}
+	}
+}
+
+// receive the Engine.IO packet sent by the websocket or the polling transport, the session should be closed if an error is returned
+func (s *session) receive(f frame) error {
+	s.receiveMu.Lock()
+	defer s.receiveMu.Unlock()
+	if f.binary {
+		p, ok, err := s.assembler.attach(f.data)
+		if err != nil {
+			if err == ErrorPacketTooLarge {
+				s.o.namespaces[MainNamespace].AddOversized()
+			}
+			return err
+		}
+		if ok {
+			s.dispatch(p)
+		}
+		return nil
+	}
+	if len(f.data) == 0 {
+		return nil
+	}
+
+	switch f.data[0] {
+	case engineClose:
+		return ErrorSessionClosed
+	case enginePing:
+		// reply the pong packet with the same payload
+		return s.write(append([]byte{enginePong}, f.data[1:]...))
+	case enginePong:
+		s.pong()
+	case engineMessage:
+		p, err := parsePacket(f.data[1:])
+		if err == ErrorTooManyAttachments {
+			// the attachments following it can not be located
+			s.o.namespaces[MainNamespace].AddOversized()
+			return err
+		}
+		if err != nil {
+			log.Println("[SocketIO][session][read] packet error:", err, string(f.data), s.id, s.remoteAddr)
+			return nil
+		}
+		if !s.assembler.wait(p) {
+			s.dispatch(p)
+		}
+	case engineUpgrade, engineNoop:
+	}
+	return nil
+}
+
+// dispatch the packet to the client of the namespace
+func (s *session) dispatch(p packet) {
+	switch p.typ {
+	case packetConnect:
+		s.connect(p)
+	case packetDisconnect:
+		if c := s.client(p.nsp); c != nil {
+			c.disconnect(true)
+		}
+	case packetEvent, packetAck, packetBinaryEvent, packetBinaryAck:
+		c := s.client(p.nsp)
+		if c == nil {
+			log.Println("[SocketIO][session][read] the namespace is not connected:", p.nsp, s.id, s.remoteAddr)
+			return
+		}
+		c.process(p)
+	}
+}
+
+// connect the client to the namespace, the auth payload is kept by the client
+func (s *session) connect(p packet) {
+	a, ok := s.o.namespaces[p.nsp]
+	if !ok {
+		s.writePacket(packet{typ: packetConnectError, nsp: p.nsp, data: []byte(`{"message":"Invalid namespace"}`)}, nil)
+		return
+	}
+	if s.client(p.nsp) != nil {
+		return
+	}
+	c := new(Client)
+	c.init(s, p.nsp, a, p.data)
+	// add the ClientFace to acceptor, unless it is shutting down
+	if !a.TryJoin(c) {
+		c.CloseConnCtx()
+		s.writePacket(packet{typ: packetConnectError, nsp: p.nsp, data: []byte(`{"message":"Server shutting down"}`)}, nil)
+		return
+	}
+	s.clientsMu.Lock()
+	s.clients[p.nsp] = c
+	s.clientsMu.Unlock()
+
+	// the connect packet is sent before any message of the client
+	sid, _ := json.Marshal(map[string]string{"sid": c.Id()})
+	if err := s.writePacket(packet{typ: packetConnect, nsp: p.nsp, data: sid}, nil); err != nil {
+		c.CloseConnCtx()
+	}
+
+	// trigger the event: OnConnection
+	a.CallGivenEvent(c, gosocket.OnConnection)
+
+	// write message to client
+	go c.write()
+}
+
+func (s *session) client(nsp string) *Client {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	return s.clients[nsp]
+}
+
+func (s *session) remove(c *Client) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	if s.clients[c.nsp] == c {
+		delete(s.clients, c.nsp)
+	}
+}
+
+// write the text packet
+func (s *session) write(data []byte) error {
+	return s.send(true, frame{data: data})
+}
+
+// ping write the ping packet without waiting for the poll request to take the frames buffered,
+// so the heartbeat is never blocked by the full buffer, and closes the session if the client stops polling
+func (s *session) ping() error {
+	return s.send(false, frame{data: []byte{enginePing}})
+}
+
+// writePacket write the Socket.IO packet followed by the binary attachments
+func (s *session) writePacket(p packet, attachments [][]byte) error {
+	frames := make([]frame, 0, 1+len(attachments))
+	frames = append(frames, frame{data: p.append([]byte{engineMessage})})
+	for _, attachment := range attachments {
+		frames = append(frames, frame{binary: true, data: attachment})
+	}
+	return s.send(true, frames...)
+}
+
+// send the frames in order by the websocket connection, or buffer them for the poll request,
+// if wait, it blocks while the frames buffered are more than the max message size, until they are taken by the poll request
+func (s *session) send(wait bool, frames ...frame) (err error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	for wait && s.conn == nil && s.size >= conf.Acceptor.Transport.MaxMessageSize {
+		drained := s.drained
+		s.writeMu.Unlock()
+		select {
+		case <-drained:
+		case <-s.ctx.Done():
+		}
+		s.writeMu.Lock()
+		if s.ctx.Err() != nil {
+			return ErrorSessionClosed
+		}
+	}
+	if s.conn != nil {
+		for _, f := range frames {
+			if err = s.conn.WriteMessage(f.messageType(), f.data); err != nil {
+				return
+			}
+		}
+		return
+	}
+	if s.ctx.Err() != nil {
+		return ErrorSessionClosed
+	}
+	for _, f := range frames {
+		s.buffered = append(s.buffered, f)
+		s.size += len(f.data)
+	}
+	// wake up the poll request waiting
+	select {
+	case s.flushed <- struct{}{}:
+	default:
+	}
+	return
+}
+
+func (f frame) messageType() int {
+	if f.binary {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
@@ -0,0 +1,371 @@
+package sse
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+)
+
+const (
+	// SessionParam is the query param of the session id of the POST requests, e.g. "http://example.com/sse?sid=xxx"
+	SessionParam = "sid"
+	// CodecParam is the query param of the event stream to negotiate the codec, e.g. "http://example.com/sse?codec=Protobuf.Snappy"
+	CodecParam = "codec"
+
+	// EventSession the first event of the stream, the data is the session id
+	EventSession = "session"
+	// EventBase64 the message is encoded by base64, because the codec is binary or the message contains the carriage return
+	EventBase64 = "base64"
+	// EventClose the last event of the stream closed by the server, the peer should not reconnect the stream automatically
+	EventClose = "close"
+
+	// the size of the read buffer, the frames not larger than it are read without copy
+	readBufferSize = 4096
+)
+
+type ClientFace interface {
+	gosocket.ClientFace
+	init(context.Context, *gosocket.Acceptor, http.ResponseWriter, *http.Request, *options) // init the client
+	Close()                                                                                 // close the session
+	SetIdentity(*gosocket.Identity)                                                         // set the authenticated identity
+	SetPeerCertificate(*x509.Certificate)                                                   // set the client certificate verified by the TLS handshake
+	SetCodec(protocol.Codec)                                                                // set the codec negotiated by the stream request
+	sid() string
+	writeEvent(event string, data []byte) error
+	write(<-chan struct{})
+	receive(ClientFace, http.ResponseWriter, *http.Request)
+}
+
+// Client the client of the Server-Sent Events transport,
+// the messages are sent by the event stream (GET), and received by the POST requests
+type Client struct {
+	gosocket.Client
+	id        string                   // the session id
+	o         *options                 // the options of the handler
+	w         http.ResponseWriter      // the response of the event stream
+	rc        *http.ResponseController // flush the events and extend the write deadline
+	buf       []byte                   // the buffer of the event
+	seen      int64                    // the time of the last POST request in nanoseconds
+	receiveMu sync.Mutex               // the messages of the POST requests are received in order
+}
+
+func (c *Client) init(baseCtx context.Context, a *gosocket.Acceptor, w http.ResponseWriter, r *http.Request, o *options) {
+	c.id = gosocket.NewSessionId()
+	c.o = o
+	c.w = w
+	c.rc = http.NewResponseController(w)
+	c.touch()
+
+	// 设置远程连接地址
+	c.SetRemoteAddr(gosocket.RemoteAddr(r))
+
+	// 初始化客户端
+	c.Init(baseCtx, a)
+}
+
+func (c *Client) sid() string {
+	return c.id
+}
+
+// Sid the session id, which is sent by the peer in the POST requests
+func (c *Client) Sid() string {
+	return c.id
+}
+
+// Close close the session and the event stream
+func (c *Client) Close() {
+	c.CloseConnCtx()
+}
+
+// touch record the time of the POST request, the session is closed if the peer is idle for too long
+func (c *Client) touch() {
+	atomic.StoreInt64(&c.seen, time.Now().UnixNano())
+}
+
+// Handler serves the Server-Sent Events clients of the acceptor:
+// GET opens the event stream, the first event is EventSession, then the messages are sent as the data of the events,
+// POST with the session id sends the messages framed in the request body,
+// DELETE with the session id closes the session
+type Handler struct {
+	baseCtx  context.Context
+	a        *gosocket.Acceptor
+	factory  func() ClientFace
+	o        *options
+	sessions sync.Map // map[session id]ClientFace
+}
+
+// NewHandler create the handler of the acceptor, the factory creates the client of each event stream, *Client if nil
+func NewHandler(baseCtx context.Context, a *gosocket.Acceptor, factory func() ClientFace, opts ...Option) *Handler {
+	if factory == nil {
+		factory = func() ClientFace { return new(Client) }
+	}
+	return &Handler{baseCtx: baseCtx, a: a, factory: factory, o: newOptions(opts)}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodGet {
+		h.stream(w, r)
+		return
+	}
+	v, ok := h.sessions.Load(r.URL.Query().Get(SessionParam))
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	c := v.(ClientFace)
+	switch r.Method {
+	case http.MethodPost:
+		c.receive(c, w, r)
+	case http.MethodDelete:
+		c.Close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// stream authenticate the request, negotiate the codec, then send the messages until the session is closed
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request) {
+	// the acceptor is shutting down
+	if h.a.Closing() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	// authenticate before the session is created, the rejected peer will never be registered
+	var identity *gosocket.Identity
+	if h.o.authenticator != nil {
+		var err error
+		if identity, err = h.o.authenticator(r); err != nil {
+			log.Println("[SSE][client][stream] authenticate error:", err, r.RemoteAddr)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// negotiate the codec of the client, the conf is used if not requested
+	var codec *protocol.Codec
+	if param := r.URL.Query().Get(CodecParam); param != "" {
+		v, err := protocol.ParseCodec(param)
+		if err != nil {
+			log.Println("[SSE][client][stream] negotiate error:", err, r.RemoteAddr)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		codec = &v
+	}
+
+	c := h.factory()
+	c.init(h.baseCtx, h.a, w, r, h.o)
+	c.SetIdentity(identity)
+	// the client certificate verified by the http.Server of the mutual TLS
+	c.SetPeerCertificate(gosocket.VerifiedPeerCertificate(r.TLS))
+	if codec != nil {
+		c.SetCodec(*codec)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	// disable the buffering of the proxy, e.g. nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := c.writeEvent(EventSession, []byte(c.sid())); err != nil {
+		log.Println("[SSE][client][stream] session event error:", err, c.RemoteAddr())
+		c.Close()
+		return
+	}
+	// add the ClientFace to acceptor, the acceptor may start shutting down after the check above
+	if !h.a.TryJoin(c) {
+		c.writeEvent(EventClose, nil)
+		c.Close()
+		return
+	}
+	h.sessions.Store(c.sid(), c)
+	defer h.sessions.Delete(c.sid())
+
+	// trigger the event: OnConnection
+	h.a.CallGivenEvent(c, gosocket.OnConnection)
+
+	// write message to client until the session is closed, the response ends with the stream
+	c.write(r.Context().Done())
+	c.Acceptor().Leave(c)
+}
+
+func (c *Client) write(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(conf.Acceptor.Heartbeat.PingInterval) * time.Second)
+	defer func() {
+		ticker.Stop()
+		c.Close()
+		// Give a signal to the sender(Emit)
+		// Here is the consumer program of the channel c.Out()
+		// Can not close c.Out() here
+		close(c.StopOut())
+	}()
+
+	// Tolerate one heartbeat cycle
+	wait := time.Duration((conf.Acceptor.Heartbeat.PingMaxTimes+2)*conf.Acceptor.Heartbeat.PingInterval) * time.Second
+	for {
+		select {
+		case msg, ok := <-c.Out():
+			if !ok {
+				log.Println("[SSE][client][write] msg send channel has been closed:", c.Id(), c.RemoteAddr())
+				c.writeEvent(EventClose, nil)
+				return
+			}
+			if err := c.writeMessage(msg); err != nil {
+				return
+			}
+		case <-c.Coalesced():
+			for _, msg := range c.TakeCoalesced() {
+				if err := c.writeMessage(msg); err != nil {
+					return
+				}
+			}
+		case <-c.Draining():
+			// the acceptor is shutting down, flush the messages waiting to be sent, then close the stream
+			for _, msg := range c.TakeCoalesced() {
+				if err := c.writeMessage(msg); err != nil {
+					return
+				}
+			}
+			c.writeEvent(EventClose, nil)
+			return
+		case <-c.Context().Done():
+			// the connection context was cancelled, e.g. disconnect the slow client by the backpressure policy
+			c.writeEvent(EventClose, nil)
+			return
+		case <-done:
+			// the peer closed the event stream
+			log.Println("[SSE][client][write] go away:", c.Id(), c.RemoteAddr())
+			return
+		case <-ticker.C:
+			// the peer stopped sending the messages, even the pong replies
+			if wait > 0 && time.Since(time.Unix(0, atomic.LoadInt64(&c.seen))) > wait {
+				log.Println("[SSE][client][write] read timeout:", c.Id(), c.RemoteAddr())
+				c.writeEvent(EventClose, nil)
+				return
+			}
+			// when the server sends `ping` messages for x consecutive times
+			// but does not receive any` pong` messages back,
+			// the server will actively close the stream
+			pings := c.Ping()
+			if len(pings) >= conf.Acceptor.Heartbeat.PingMaxTimes {
+				log.Println("[SSE][client][write] miss pong reply:", c.Id(), c.RemoteAddr(), len(pings))
+				c.writeEvent(EventClose, nil)
+				return
+			}
+			timeNow := time.Now()
+			millisecond := timeNow.UnixNano() / int64(time.Millisecond)
+			if msg, err := c.Acceptor().EncodeCodec(gosocket.EventPing, millisecond, "", c.SendCodec()); err == nil {
+				if err := c.writeMessage(msg); err != nil {
+					return
+				}
+				c.SetPing(millisecond, true)
+			}
+			if conf.Acceptor.Logs.Heartbeat.PingSend && c.Delay() >= conf.Acceptor.Logs.Heartbeat.PingSendPrintDelay {
+				log.Println("[heartbeat][SSE][ping]:", c.Id(), c.RemoteAddr(), millisecond, timeNow.Format("2006-01-02 15:04:05.999"), len(pings), c.Delay())
+			}
+		}
+	}
+}
+
+// writeMessage write the message as the data of the event, which is compressed by the compression stream first if the codec is streamed,
+// the binary message and the message contains the carriage return are encoded by base64
+func (c *Client) writeMessage(msg []byte) error {
+	msg, err := c.StreamZip(msg)
+	if err != nil {
+		log.Println("[SSE][client][write] stream zip error:", err, c.Id(), c.RemoteAddr())
+		return err
+	}
+	if c.SendCodec().Binary() || bytes.IndexByte(msg, '\r') >= 0 {
+		return c.writeEvent(EventBase64, base64.StdEncoding.AppendEncode(nil, msg))
+	}
+	return c.writeEvent("", msg)
+}
+
+// writeEvent write and flush the event, each line of the data is sent as a data field,
+// the lines are joined by the line feed again by the peer
+func (c *Client) writeEvent(event string, data []byte) error {
+	c.buf = c.buf[:0]
+	if event != "" {
+		c.buf = append(c.buf, "event: "...)
+		c.buf = append(c.buf, event...)
+		c.buf = append(c.buf, '\n')
+	}
+	for {
+		line, rest, found := bytes.Cut(data, []byte{'\n'})
+		c.buf = append(c.buf, "data: "...)
+		c.buf = append(c.buf, line...)
+		c.buf = append(c.buf, '\n')
+		if !found {
+			break
+		}
+		data = rest
+	}
+	c.buf = append(c.buf, '\n')
+
+	// the stream is alive as long as the events are sent
+	if wait := time.Duration(conf.Acceptor.Heartbeat.PingInterval) * time.Second; wait > 0 {
+		c.rc.SetWriteDeadline(time.Now().Add(2 * wait))
+	}
+	if _, err := c.w.Write(c.buf); err != nil {
+		log.Println("[SSE][client][write] error:", err, c.Id(), c.RemoteAddr())
+		return err
+	}
+	return c.rc.Flush()
+}
+
+// receive the messages framed in the body of the POST request
+func (c *Client) receive(face ClientFace, w http.ResponseWriter, r *http.Request) {
+	c.receiveMu.Lock()
+	defer c.receiveMu.Unlock()
+	defer c.touch()
+
+	fr := protocol.NewFrameReader(r.Body, readBufferSize)
+	fr.SetFramer(c.o.framer)
+	fr.SetMaxSize(conf.Acceptor.Transport.MaxMessageSize)
+	for {
+		row, err := fr.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var sizeErr *protocol.FrameSizeError
+			if errors.As(err, &sizeErr) {
+				// the frames afterwards can not be located, close the session
+				c.Acceptor().AddOversized()
+				c.Close()
+			}
+			log.Println("[SSE][client][receive] read error:", err, c.Id(), c.RemoteAddr())
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if row, err = c.StreamUnzip(row); err != nil {
+			// the compression stream is broken, the messages afterwards can not be decompressed
+			log.Println("[SSE][client][receive] stream unzip error:", err, c.Id(), c.RemoteAddr())
+			c.Close()
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		message, decodeErr := c.Acceptor().DecodeCodec(row, c.ReceiveCodec())
+		if decodeErr != nil {
+			log.Println("[SSE][client][receive] protocol Decode error:", decodeErr, row, string(row), c.Id(), c.RemoteAddr())
+			continue
+		}
+		// bind function handler
+		c.Acceptor().CallEvent(face, message)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,47 @@
+package sse
+
+import (
+	"net/http"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/protocol"
+)
+
+// Authenticator authenticate the request of the event stream, such as the header, query token or cookie,
+// the request is rejected with 401 Unauthorized if an error is returned,
+// and the identity returned is attached to the client
+type Authenticator func(r *http.Request) (*gosocket.Identity, error)
+
+type options struct {
+	authenticator Authenticator
+	framer        protocol.Framer
+}
+
+// Option configures the Handler
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{framer: protocol.DefaultFramer}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAuthenticator require the peer to be authenticated by the request of the event stream
+func WithAuthenticator(f Authenticator) Option {
+	return func(o *options) {
+		o.authenticator = f
+	}
+}
+
+// WithFramer set the framer of the messages in the body of the POST requests, protocol.DefaultFramer by default,
+// e.g. protocol.NewlineFramer{} for the text messages sent by the browsers
+func WithFramer(f protocol.Framer) Option {
+	return func(o *options) {
+		if f == nil {
+			f = protocol.DefaultFramer
+		}
+		o.framer = f
+	}
+}
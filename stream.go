@@ -0,0 +1,60 @@
+package gosocket
+
+import "github.com/plhwin/gosocket/protocol"
+
+// streams keep the compression streams of a connection, which are created on first use if the codec is streamed,
+// the zip stream is used by the writer of the connection only, and the unzip stream by the reader only
+type streams struct {
+	zip   protocol.ZipStream
+	unzip protocol.UnzipStream
+}
+
+// zipMessage compress the message by the zip stream, the message is returned as it is unless the codec is streamed
+func (s *streams) zipMessage(codec protocol.Codec, msg []byte) (_ []byte, err error) {
+	if !codec.Stream {
+		return msg, nil
+	}
+	if s.zip == nil {
+		if s.zip, err = protocol.NewZipStream(codec); err != nil {
+			return
+		}
+	}
+	return s.zip.Zip(msg)
+}
+
+// unzipMessage decompress the message by the unzip stream, the message is returned as it is unless the codec is streamed
+func (s *streams) unzipMessage(codec protocol.Codec, msg []byte) (_ []byte, err error) {
+	if !codec.Stream {
+		return msg, nil
+	}
+	if s.unzip == nil {
+		if s.unzip, err = protocol.NewUnzipStream(codec); err != nil {
+			return
+		}
+	}
+	return s.unzip.Unzip(msg)
+}
+
+// StreamZip compress the message by the compression stream of the client before writing it to the connection,
+// it must be called by the writer of the connection in the order of writing, see protocol.Codec.Stream
+func (c *Client) StreamZip(msg []byte) ([]byte, error) {
+	return c.streams.zipMessage(c.sendCodec, msg)
+}
+
+// StreamUnzip decompress the message read from the connection by the compression stream of the client before decoding it,
+// it must be called by the reader of the connection in the order of reading
+func (c *Client) StreamUnzip(msg []byte) ([]byte, error) {
+	return c.streams.unzipMessage(c.receiveCodec, msg)
+}
+
+// StreamZip compress the message by the compression stream of the conn before writing it to the connection,
+// it must be called by the writer of the connection in the order of writing, see protocol.Codec.Stream
+func (c *Conn) StreamZip(msg []byte) ([]byte, error) {
+	return c.streams.zipMessage(c.sendCodec, msg)
+}
+
+// StreamUnzip decompress the message read from the connection by the compression stream of the conn before decoding it,
+// it must be called by the reader of the connection in the order of reading
+func (c *Conn) StreamUnzip(msg []byte) ([]byte, error) {
+	return c.streams.unzipMessage(c.receiveCodec, msg)
+}
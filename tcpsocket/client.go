@@ -2,9 +2,13 @@ package tcpsocket
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"io"
 	"log"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/plhwin/gosocket/conf"
@@ -16,18 +20,44 @@ import (
 
 type ClientFace interface {
 	gosocket.ClientFace
-	init(context.Context, net.Conn, *gosocket.Acceptor) // init the client
+	init(context.Context, net.Conn, *gosocket.Acceptor, protocol.Framer) // init the client
+	Close()                                                              // close the client connection
+	SetIdentity(*gosocket.Identity)                                      // set the authenticated identity
+	SetPeerCertificate(*x509.Certificate)                                // set the client certificate verified by the TLS handshake
+	SetCodec(protocol.Codec)                                             // set the codec negotiated by the hello frame
+	ReceiveCodec() protocol.Codec                                        // the codec to decode the messages received from the client
+	StreamUnzip([]byte) ([]byte, error)                                  // decompress the message by the compression stream after reading
+	reader() *protocol.FrameReader                                       // the frame reader of the connection
 	read(ClientFace)
 	write()
 }
 
+const (
+	// the max size of the auth frame, the peer is not trusted before authenticated
+	maxAuthFrameSize = 64 * 1024
+	// the max size of the hello frame
+	maxHelloFrameSize = 256
+	// the size of the read buffer, the frames not larger than it are read without copy
+	readBufferSize = 4096
+	// the max number of the queued messages written in batch
+	maxBatchSize = 64
+	// the timeout of the TLS handshake of the acceptor side
+	tlsHandshakeTimeout = 10 * time.Second
+)
+
 type Client struct {
 	gosocket.Client
-	conn net.Conn // tcp socket conn
+	conn net.Conn              // tcp socket conn
+	fr   *protocol.FrameReader // read the frames from the conn
+	fw   *protocol.FrameWriter // write the frames to the conn
 }
 
-func (c *Client) init(baseCtx context.Context, conn net.Conn, a *gosocket.Acceptor) {
+func (c *Client) init(baseCtx context.Context, conn net.Conn, a *gosocket.Acceptor, framer protocol.Framer) {
 	c.conn = conn
+	c.fr = protocol.NewFrameReader(conn, readBufferSize)
+	c.fr.SetFramer(framer)
+	c.fw = protocol.NewFrameWriter(conn)
+	c.fw.SetFramer(framer)
 
 	// 设置远程连接地址
 	c.SetRemoteAddr(conn.RemoteAddr())
@@ -44,13 +74,129 @@ func (c *Client) Close() {
 	c.conn.Close()
 }
 
-// Serve handles socket requests from the peer
-func Serve(baseCtx context.Context, conn net.Conn, a *gosocket.Acceptor, c ClientFace) {
+// Serve handles socket requests from the peer,
+// the connection is served over TLS if it is the *tls.Conn or WithTLS is set, see WithTLS
+func Serve(baseCtx context.Context, conn net.Conn, a *gosocket.Acceptor, c ClientFace, opts ...Option) {
+	o := newOptions(opts)
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok && o.tlsConfig != nil {
+		tlsConn = tls.Server(conn, o.tlsConfig)
+		conn = tlsConn
+	}
+
 	// init tcp socket
-	c.init(baseCtx, conn, a)
+	c.init(baseCtx, conn, a, o.framer)
+
+	if tlsConn == nil && !o.negotiate && o.authenticator == nil {
+		serve(a, c)
+		return
+	}
+	// wait for the TLS handshake, the hello and auth frames without blocking the caller,
+	// the rejected peer will never be registered
+	go func() {
+		if tlsConn != nil {
+			if err := handshake(tlsConn, c); err != nil {
+				log.Println("[TCPSocket][client][Serve] TLS handshake error:", err, c.RemoteAddr())
+				c.Close()
+				return
+			}
+		}
+		if o.negotiate {
+			if err := negotiate(conn, c, o); err != nil {
+				oversized(a, err)
+				log.Println("[TCPSocket][client][Serve] negotiate error:", err, c.RemoteAddr())
+				c.Close()
+				return
+			}
+		}
+		if o.authenticator != nil {
+			if err := authenticate(conn, a, c, o); err != nil {
+				oversized(a, err)
+				log.Println("[TCPSocket][client][Serve] authenticate error:", err, c.RemoteAddr())
+				c.Close()
+				return
+			}
+		}
+		serve(a, c)
+	}()
+}
+
+// handshake complete the TLS handshake within the timeout, the verified client certificate is attached to the client
+func handshake(conn *tls.Conn, c ClientFace) error {
+	ctx, cancel := context.WithTimeout(c.Context(), tlsHandshakeTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return err
+	}
+	state := conn.ConnectionState()
+	c.SetPeerCertificate(gosocket.VerifiedPeerCertificate(&state))
+	return nil
+}
+
+// negotiate the codec by the hello frame sent by the peer within the timeout,
+// the hello frame is formatted as protocol.CodecPrefix + codec, e.g. "gosocket.Protobuf.Snappy"
+func negotiate(conn net.Conn, c ClientFace, o *options) (err error) {
+	if o.negotiateTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(o.negotiateTimeout))
+	}
+	var frame []byte
+	c.reader().SetMaxSize(maxHelloFrameSize)
+	if frame, err = c.reader().ReadFrame(); err != nil {
+		return
+	}
+	hello, ok := strings.CutPrefix(string(frame), protocol.CodecPrefix)
+	if !ok {
+		return errors.New("the first frame is not the hello frame")
+	}
+	var codec protocol.Codec
+	if codec, err = protocol.ParseCodec(hello); err != nil {
+		return
+	}
+	c.SetCodec(codec)
+	// the deadline of the hello frame must not limit the frames afterwards
+	return conn.SetReadDeadline(time.Time{})
+}
 
-	// add the ClientFace to acceptor
-	a.Join(c)
+// hello send the hello frame to negotiate the codec with the server
+func hello(fw *protocol.FrameWriter, codec protocol.Codec) error {
+	return fw.WriteFrames([]byte(protocol.CodecPrefix + codec.String()))
+}
+
+// authenticate the first frame sent by the peer within the timeout
+func authenticate(conn net.Conn, a *gosocket.Acceptor, c ClientFace, o *options) (err error) {
+	if o.authTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(o.authTimeout))
+	}
+	var frame []byte
+	c.reader().SetMaxSize(maxAuthFrameSize)
+	if frame, err = c.reader().ReadFrame(); err != nil {
+		return
+	}
+	if frame, err = c.StreamUnzip(frame); err != nil {
+		return
+	}
+	var msg *protocol.Message
+	if msg, err = a.DecodeCodec(frame, c.ReceiveCodec()); err != nil {
+		return
+	}
+	if msg.Event != gosocket.EventAuth {
+		return errors.New("the first frame is not the auth event: " + msg.Event)
+	}
+	var identity *gosocket.Identity
+	if identity, err = o.authenticator(msg); err != nil {
+		return
+	}
+	c.SetIdentity(identity)
+	// the deadline of the auth frame must not limit the frames afterwards
+	return conn.SetReadDeadline(time.Time{})
+}
+
+func serve(a *gosocket.Acceptor, c ClientFace) {
+	// add the ClientFace to acceptor, unless it is shutting down
+	if !a.TryJoin(c) {
+		c.Close()
+		return
+	}
 
 	// trigger the event: OnConnection
 	a.CallGivenEvent(c, gosocket.OnConnection)
@@ -74,6 +220,7 @@ func (c *Client) write() {
 		close(c.StopOut())
 	}()
 
+	var msgs [][]byte
 	for {
 		select {
 		case msg, ok := <-c.Out():
@@ -88,16 +235,33 @@ func (c *Client) write() {
 			//}
 			// for test end
 
-			pkg, err := protocol.EnPack(msg)
-			if err != nil {
-				log.Println("[TCPSocket][client][write] protocol EnPack error:", err, string(msg), c.Id(), c.RemoteAddr())
+			// the messages queued are written in batch
+			msgs = batch(c.Out(), append(msgs[:0], msg))
+			if err := c.writeFrames(msgs); err != nil {
+				log.Println("[TCPSocket][client][write] error:", err, len(msgs), c.Id(), c.RemoteAddr())
 				return
 			}
-
-			if n, err := c.conn.Write(pkg.Bytes()); err != nil {
-				log.Println("[TCPSocket][client][write] error:", err, n, string(msg), c.Id(), c.RemoteAddr())
+		case <-c.Coalesced():
+			if err := c.writeFrames(c.TakeCoalesced()); err != nil {
+				log.Println("[TCPSocket][client][write] error:", err, c.Id(), c.RemoteAddr())
+				return
+			}
+		case <-c.Draining():
+			// the acceptor is shutting down, flush the messages waiting to be sent,
+			// then send FIN to the client and wait for the client to close the connection
+			if err := c.writeFrames(c.TakeCoalesced()); err != nil {
+				return
+			}
+			if conn, ok := c.conn.(interface{ CloseWrite() error }); ok {
+				conn.CloseWrite()
+			} else {
 				return
 			}
+			<-c.Context().Done()
+			return
+		case <-c.Context().Done():
+			// the connection context was cancelled, e.g. disconnect the slow client by the backpressure policy
+			return
 		case <-ticker.C:
 			// when the socket server sends `ping` messages for x consecutive times
 			// but does not receive any` pong` messages back,
@@ -110,12 +274,8 @@ func (c *Client) write() {
 			}
 			timeNow := time.Now()
 			millisecond := timeNow.UnixNano() / int64(time.Millisecond)
-			if msg, err := c.Acceptor().Encode(gosocket.EventPing, millisecond, "", conf.Acceptor.Transport.Send.Serialize, conf.Acceptor.Transport.Send.Compress); err == nil {
-				pkg, err := protocol.EnPack(msg)
-				if err != nil {
-					return
-				}
-				if _, err := c.conn.Write(pkg.Bytes()); err != nil {
+			if msg, err := c.Acceptor().EncodeCodec(gosocket.EventPing, millisecond, "", c.SendCodec()); err == nil {
+				if err := c.writeFrames([][]byte{msg}); err != nil {
 					return
 				}
 				c.SetPing(millisecond, true)
@@ -127,15 +287,27 @@ func (c *Client) write() {
 	}
 }
 
+// writeFrames write the messages in batch, which are compressed by the compression stream first if the codec is streamed
+func (c *Client) writeFrames(msgs [][]byte) (err error) {
+	for n, msg := range msgs {
+		if msgs[n], err = c.StreamZip(msg); err != nil {
+			return
+		}
+	}
+	err = c.fw.WriteFrames(msgs...)
+	// do not keep the messages sent
+	clear(msgs)
+	return
+}
+
 func (c *Client) read(face ClientFace) {
 	defer func() {
 		c.Close()
-		c.LeaveAll()
-		c.Acceptor().CallGivenEvent(face, gosocket.OnDisconnection)
+		c.Acceptor().Leave(face)
 	}()
 
-	buf := make([]byte, 0, 4096) // 临时缓冲区的buffer
-	readBuf := make([]byte, 256) // 每次读取多大buffer
+	// TCP拆包：按照传输协议逐条读取消息，读取缓冲区可以容纳的消息不会被复制
+	c.fr.SetMaxSize(conf.Acceptor.Transport.MaxMessageSize)
 
 	// Tolerate one heartbeat cycle
 	wait := time.Duration((conf.Acceptor.Heartbeat.PingMaxTimes+2)*conf.Acceptor.Heartbeat.PingInterval) * time.Second
@@ -144,32 +316,60 @@ func (c *Client) read(face ClientFace) {
 			c.conn.SetReadDeadline(time.Now().Add(wait))
 		}
 
-		n, err := c.conn.Read(readBuf)
+		row, err := c.fr.ReadFrame()
 		if err != nil {
 			if err == io.EOF {
 				log.Println("[TCPSocket][client][read] connection was closed:", err, c.Id(), c.RemoteAddr())
+			} else if oversized(c.Acceptor(), err) {
+				// the frames afterwards can not be located, close the connection
+				log.Println("[TCPSocket][client][read] frame size error:", err, c.Id(), c.RemoteAddr())
 			} else {
 				log.Println("[TCPSocket][client][read] connection read error:", err, c.Id(), c.RemoteAddr())
 			}
 			break
 		}
-		buf = append(buf, readBuf[:n]...)
-
-		// TCP拆包：一次读取可能读到到一条或者多条符合传输协议的内容，通常readBuf设置的比协议消息体大
-		// 也可能什么内容也读取不到，要等待下一次读取与本次未处理的内容拼接再试，通常readBuf设置的比协议消息体小
-		var data [][]byte
-		if data, err = protocol.DePack(&buf); err != nil {
-			log.Println("[TCPSocket][client][read] protocol DePack error:", err, c.Id(), c.RemoteAddr())
+		if row, err = c.StreamUnzip(row); err != nil {
+			// the compression stream is broken, the messages afterwards can not be decompressed
+			log.Println("[TCPSocket][client][read] stream unzip error:", err, c.Id(), c.RemoteAddr())
+			break
+		}
+		message, decodeErr := c.Acceptor().DecodeCodec(row, c.ReceiveCodec())
+		if decodeErr != nil {
+			log.Println("[TCPSocket][client][read] protocol Decode error:", decodeErr, row, string(row), c.Id(), c.RemoteAddr())
 			continue
 		}
-		for _, row := range data {
-			message, decodeErr := c.Acceptor().Decode(row, conf.Acceptor.Transport.Receive.Serialize, conf.Acceptor.Transport.Receive.Compress)
-			if decodeErr != nil {
-				log.Println("[TCPSocket][client][read] protocol Decode error:", decodeErr, row, string(row), c.Id(), c.RemoteAddr())
-				continue
+		// bind function handler
+		c.Acceptor().CallEvent(face, message)
+	}
+}
+
+func (c *Client) reader() *protocol.FrameReader {
+	return c.fr
+}
+
+// oversized count the error if it is the protocol.FrameSizeError
+func oversized(counter interface{ AddOversized() }, err error) bool {
+	var sizeErr *protocol.FrameSizeError
+	if !errors.As(err, &sizeErr) {
+		return false
+	}
+	counter.AddOversized()
+	return true
+}
+
+// batch take the messages queued in the channel without blocking, up to maxBatchSize
+func batch(out chan []byte, msgs [][]byte) [][]byte {
+	for len(msgs) < maxBatchSize {
+		select {
+		case msg, ok := <-out:
+			if !ok {
+				// the closed channel is handled by the next receive
+				return msgs
 			}
-			// bind function handler
-			c.Acceptor().CallEvent(face, message)
+			msgs = append(msgs, msg)
+		default:
+			return msgs
 		}
 	}
+	return msgs
 }
@@ -1,41 +1,68 @@
 package tcpsocket
 
 import (
+	"crypto/tls"
 	"io"
 	"log"
 	"net"
 
-	"github.com/plhwin/gosocket/conf"
-
 	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
 	"github.com/plhwin/gosocket/protocol"
 )
 
 type ConnFace interface {
 	gosocket.ConnFace
-	init(net.Conn, *gosocket.Initiator) // init the conn
+	init(net.Conn, *gosocket.Initiator, protocol.Framer) // init the conn
+	Close()                                              // close the connection
+	writer() *protocol.FrameWriter                       // the frame writer of the connection
 	read(ConnFace)
 	write()
 }
 
 type Conn struct {
 	gosocket.Conn
-	conn net.Conn // tcp socket conn
+	conn net.Conn              // tcp socket conn
+	fr   *protocol.FrameReader // read the frames from the conn
+	fw   *protocol.FrameWriter // write the frames to the conn
 }
 
-func (c *Conn) init(conn net.Conn, i *gosocket.Initiator) {
+func (c *Conn) init(conn net.Conn, i *gosocket.Initiator, framer protocol.Framer) {
 	c.conn = conn
+	c.fr = protocol.NewFrameReader(conn, readBufferSize)
+	c.fr.SetFramer(framer)
+	c.fw = protocol.NewFrameWriter(conn)
+	c.fw.SetFramer(framer)
 	c.SetRemoteAddr(conn.RemoteAddr())
 	c.Init(i)
+	// the handshake was completed by the Dialer with WithTLS
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		c.SetPeerCertificate(gosocket.VerifiedPeerCertificate(&state))
+	}
 }
 
 func (c *Conn) Close() {
 	c.conn.Close()
 }
 
-// as a initiator, receive message from tcp socket server
-func Receive(i *gosocket.Initiator, conn net.Conn, c ConnFace) {
-	c.init(conn, i)
+// as a initiator, receive message from tcp socket server,
+// the hello frame is sent first if the codec was set by ConnFace.SetCodec, see WithNegotiation,
+// and then the auth frame if WithAuthPayload is set,
+// only the options of the initiator side take effect, e.g. WithFramer
+func Receive(i *gosocket.Initiator, conn net.Conn, c ConnFace, opts ...Option) {
+	o := newOptions(opts)
+	c.init(conn, i, o.framer)
+	if c.Negotiated() {
+		if err := hello(c.writer(), c.SendCodec()); err != nil {
+			log.Println("[TCPSocket][conn][Receive] hello error:", err, c.RemoteAddr())
+		}
+	}
+	if o.authPayload != nil {
+		if err := auth(c, o.authPayload); err != nil {
+			log.Println("[TCPSocket][conn][Receive] auth error:", err, c.RemoteAddr())
+		}
+	}
 	// After receive the SocketId event, then call OnConnection, see sponsor.go
 	go c.write()
 	go c.read(c)
@@ -47,51 +74,75 @@ func (c *Conn) read(face ConnFace) {
 		c.Initiator().CallGivenEvent(face, gosocket.OnDisconnection)
 	}()
 
-	buf := make([]byte, 0, 4096) // 临时缓冲区的buffer
-	readBuf := make([]byte, 256) // 每次读取多大buffer
+	// TCP拆包：按照传输协议逐条读取消息，读取缓冲区可以容纳的消息不会被复制
+	c.fr.SetMaxSize(conf.Initiator.Transport.MaxMessageSize)
 
 	for {
-		n, err := c.conn.Read(readBuf)
+		row, err := c.fr.ReadFrame()
 		if err != nil {
 			if err == io.EOF {
 				log.Println("[TCPSocket][conn][read] connection was closed:", err, c.Id(), c.RemoteAddr())
+			} else if oversized(c.Initiator(), err) {
+				// the frames afterwards can not be located, close the connection
+				log.Println("[TCPSocket][conn][read] frame size error:", err, c.Id(), c.RemoteAddr())
 			} else {
 				log.Println("[TCPSocket][conn][read] connection read error:", err, c.Id(), c.RemoteAddr())
 			}
 			break
 		}
-		buf = append(buf, readBuf[:n]...)
-
-		// TCP拆包：一次读取可能读到到一条或者多条符合传输协议的内容，通常readBuf设置的比协议消息体大
-		// 也可能什么内容也读取不到，要等待下一次读取与本次未处理的内容拼接再试，通常readBuf设置的比协议消息体小
-		var data [][]byte
-		if data, err = protocol.DePack(&buf); err != nil {
-			log.Println("[TCPSocket][conn][read] protocol DePack error:", err, c.Id(), c.RemoteAddr())
-			continue
+		if row, err = c.StreamUnzip(row); err != nil {
+			// the compression stream is broken, the messages afterwards can not be decompressed
+			log.Println("[TCPSocket][conn][read] stream unzip error:", err, c.Id(), c.RemoteAddr())
+			break
 		}
-		for _, row := range data {
-			message, decodeErr := c.Initiator().Decode(row, conf.Initiator.Transport.Receive.Serialize, conf.Initiator.Transport.Receive.Compress)
-			if decodeErr != nil {
-				log.Println("[TCPSocket][conn][read] protocol Decode error:", decodeErr, row, string(row), c.Id(), c.RemoteAddr())
-				continue
-			}
-			// bind function handler
-			c.Initiator().CallEvent(face, message)
+		message, decodeErr := c.Initiator().DecodeCodec(row, c.ReceiveCodec())
+		if decodeErr != nil {
+			log.Println("[TCPSocket][conn][read] protocol Decode error:", decodeErr, row, string(row), c.Id(), c.RemoteAddr())
+			continue
 		}
+		// bind function handler
+		c.Initiator().CallEvent(face, message)
 	}
 }
 
 func (c *Conn) write() {
 	defer c.Close()
+	var msgs [][]byte
 	for msg := range c.Out() {
-		pkg, err := protocol.EnPack(msg)
-		if err != nil {
-			log.Println("[TCPSocket][conn][write] protocol EnPack error:", err, string(msg), c.Id(), c.RemoteAddr())
+		// the messages queued are written in batch
+		msgs = batch(c.Out(), append(msgs[:0], msg))
+		if err := c.writeFrames(msgs); err != nil {
+			log.Println("[TCPSocket][conn][write] error:", err, len(msgs), c.Id(), c.RemoteAddr())
 			break
 		}
-		if _, err := c.conn.Write(pkg.Bytes()); err != nil {
-			log.Println("[TCPSocket][conn][write] error:", err, msg, string(msg), c.Id(), c.RemoteAddr())
-			break
+	}
+}
+
+// writeFrames write the messages in batch, which are compressed by the compression stream first if the codec is streamed
+func (c *Conn) writeFrames(msgs [][]byte) (err error) {
+	for n, msg := range msgs {
+		if msgs[n], err = c.StreamZip(msg); err != nil {
+			return
 		}
 	}
+	err = c.fw.WriteFrames(msgs...)
+	// do not keep the messages sent
+	clear(msgs)
+	return
+}
+
+// auth send the auth frame before the messages of the send channel, see WithAuthPayload
+func auth(c ConnFace, args interface{}) error {
+	msg, err := c.Initiator().EncodeCodec(gosocket.EventAuth, args, "", c.SendCodec())
+	if err != nil {
+		return err
+	}
+	if msg, err = c.StreamZip(msg); err != nil {
+		return err
+	}
+	return c.writer().WriteFrames(msg)
+}
+
+func (c *Conn) writer() *protocol.FrameWriter {
+	return c.fw
 }
@@ -0,0 +1,34 @@
+package tcpsocket
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/plhwin/gosocket"
+)
+
+// Dialer get the gosocket.DialFunc which dials the tcp socket server and receives on the connection,
+// it is used to keep the initiator connected by gosocket.Initiator.Reconnect.
+// the factory creates a new ConnFace for each connection, the options are passed to Receive,
+// the TLS handshake is completed before receiving if WithTLS is set
+func Dialer(network, addr string, factory func() ConnFace, opts ...Option) gosocket.DialFunc {
+	o := newOptions(opts)
+	return func(ctx context.Context, i *gosocket.Initiator) (gosocket.ConnFace, error) {
+		var conn net.Conn
+		var err error
+		if o.tlsConfig != nil {
+			d := tls.Dialer{Config: o.tlsConfig}
+			conn, err = d.DialContext(ctx, network, addr)
+		} else {
+			var d net.Dialer
+			conn, err = d.DialContext(ctx, network, addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		c := factory()
+		Receive(i, conn, c, opts...)
+		return c, nil
+	}
+}
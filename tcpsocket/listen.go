@@ -0,0 +1,173 @@
+package tcpsocket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/plhwin/gosocket"
+)
+
+// the max delay of retrying the accept after the temporary error, e.g. too many open files
+const maxAcceptDelay = time.Second
+
+// ListenAndServe listen on the address of the network and serve the connections by the acceptor until ctx is cancelled,
+// the network is "tcp", "tcp4", "tcp6" or "unix", the stale unix socket file left by the crashed process is removed before listening.
+// The factory creates a new ClientFace for each connection, see ServeListener
+func ListenAndServe(ctx context.Context, network, addr string, a *gosocket.Acceptor, factory func() ClientFace, opts ...Option) error {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	case "unix":
+		removeStaleSocket(addr)
+	default:
+		return net.UnknownNetworkError(network)
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return ServeListener(ctx, l, a, factory, opts...)
+}
+
+// ServeListener accept the connections of the listener and serve them by the acceptor until ctx is cancelled,
+// the factory creates a new ClientFace for each connection, the options are passed to Serve.
+// When ctx is cancelled, the listener and all the connections are closed, it returns nil after the connections were closed,
+// the acceptor should be shut down before to drain the clients, see gosocket.Acceptor.Shutdown.
+// The error of the listener is returned if it was closed by others, the connections are kept,
+// the listener is always closed when it returns
+func ServeListener(ctx context.Context, l net.Listener, a *gosocket.Acceptor, factory func() ClientFace, opts ...Option) error {
+	o := newOptions(opts)
+	s := &server{conns: make(map[*trackedConn]struct{})}
+	if o.maxConns > 0 {
+		s.sem = make(chan struct{}, o.maxConns)
+	}
+	defer l.Close()
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+
+	var delay time.Duration
+	for {
+		if s.sem != nil {
+			// wait for a connection to be closed if the limit is reached
+			select {
+			case s.sem <- struct{}{}:
+			case <-ctx.Done():
+				s.shutdown()
+				return nil
+			}
+		}
+		conn, err := l.Accept()
+		if err != nil {
+			if s.sem != nil {
+				<-s.sem
+			}
+			if ctx.Err() != nil {
+				s.shutdown()
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// e.g. too many open files, retry after a while
+			delay = min(max(2*delay, 5*time.Millisecond), maxAcceptDelay)
+			log.Println("[TCPSocket][server][accept] error:", err, "retrying in", delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		delay = 0
+
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.SetNoDelay(o.noDelay)
+			if o.keepAlive > 0 {
+				tcpConn.SetKeepAlive(true)
+				tcpConn.SetKeepAlivePeriod(o.keepAlive)
+			} else if o.keepAlive < 0 {
+				tcpConn.SetKeepAlive(false)
+			}
+		}
+		Serve(ctx, s.track(conn), a, factory(), opts...)
+	}
+}
+
+// removeStaleSocket remove the unix socket file if no one is listening on it
+func removeStaleSocket(path string) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		// in use, the listen fails with the address already in use
+		conn.Close()
+		return
+	}
+	os.Remove(path)
+}
+
+// server track the connections of the listener, which are closed when ctx is cancelled
+type server struct {
+	sem   chan struct{} // the semaphore of the max connections, nil means no limit
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+	wg    sync.WaitGroup
+}
+
+func (s *server) track(conn net.Conn) *trackedConn {
+	c := &trackedConn{Conn: conn, s: s}
+	s.wg.Add(1)
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	return c
+}
+
+func (s *server) remove(c *trackedConn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+	if s.sem != nil {
+		<-s.sem
+	}
+	s.wg.Done()
+}
+
+// shutdown close all the connections and wait for them to be removed
+func (s *server) shutdown() {
+	s.mu.Lock()
+	conns := make([]*trackedConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+	s.wg.Wait()
+}
+
+// trackedConn the connection removed from the server when it is closed
+type trackedConn struct {
+	net.Conn
+	s    *server
+	once sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { c.s.remove(c) })
+	return err
+}
+
+// CloseWrite send FIN to the peer if the connection supports, which is used to drain the client
+func (c *trackedConn) CloseWrite() error {
+	if conn, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return conn.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,112 @@
+package tcpsocket
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/protocol"
+)
+
+// Authenticator authenticate the first frame sent by the peer, which must be the gosocket.EventAuth event,
+// the connection is closed if an error is returned,
+// and the identity returned is attached to the client
+type Authenticator func(msg *protocol.Message) (*gosocket.Identity, error)
+
+type options struct {
+	authenticator Authenticator
+	authTimeout   time.Duration
+	authPayload   interface{}
+
+	negotiate        bool
+	negotiateTimeout time.Duration
+
+	framer protocol.Framer
+
+	tlsConfig *tls.Config
+
+	maxConns  int
+	keepAlive time.Duration
+	noDelay   bool
+}
+
+// Option configures the Serve, ListenAndServe, Receive and Dialer, the options of the acceptor side are ignored by the initiator side
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{noDelay: true}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAuthenticator require the peer to send the auth frame within the timeout after connected
+func WithAuthenticator(f Authenticator, timeout time.Duration) Option {
+	return func(o *options) {
+		o.authenticator = f
+		o.authTimeout = timeout
+	}
+}
+
+// WithAuthPayload send the auth frame by the initiator side, which is the gosocket.EventAuth event with the args,
+// it is written right after the hello frame on every connection, including the ones reconnected by the Dialer,
+// so that the initiator is authenticated by the acceptor side with WithAuthenticator before any other message
+func WithAuthPayload(args interface{}) Option {
+	return func(o *options) {
+		o.authPayload = args
+	}
+}
+
+// WithNegotiation require the peer to send the hello frame within the timeout after connected,
+// which negotiates the codec of the connection, e.g. "gosocket.Protobuf.Snappy",
+// the hello frame is sent first if the authenticator is also required.
+// The initiator sends the hello frame if the codec was set by ConnFace.SetCodec before receiving
+func WithNegotiation(timeout time.Duration) Option {
+	return func(o *options) {
+		o.negotiate = true
+		o.negotiateTimeout = timeout
+	}
+}
+
+// WithFramer frame the messages on the stream by the framer, e.g. protocol.Uint16Framer to interoperate with the devices,
+// the default is protocol.DefaultFramer, the peer must use the same framer
+func WithFramer(f protocol.Framer) Option {
+	return func(o *options) {
+		o.framer = f
+	}
+}
+
+// WithTLS serve or dial the connections over TLS, the acceptor side wraps the connection by tls.Server in Serve,
+// and the initiator side completes the handshake in Dialer, Receive takes the *tls.Conn dialed by the others.
+// For the mutual TLS, set ClientAuth to tls.RequireAndVerifyClientCert and ClientCAs of the acceptor side,
+// and Certificates of the initiator side, the verified certificate of the peer is exposed by PeerSubject and PeerCertificate
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// WithMaxConns limit the number of the concurrent connections of ListenAndServe and ServeListener,
+// the listener stops accepting until a connection is closed, 0 means no limit
+func WithMaxConns(n int) Option {
+	return func(o *options) {
+		o.maxConns = n
+	}
+}
+
+// WithKeepAlive set the keep-alive period of the tcp connections accepted by ListenAndServe,
+// 0 means the default period of the net package, a negative value disables the keep-alive
+func WithKeepAlive(period time.Duration) Option {
+	return func(o *options) {
+		o.keepAlive = period
+	}
+}
+
+// WithNoDelay set TCP_NODELAY of the tcp connections accepted by ListenAndServe and ServeListener, true by default,
+// false means the small frames may be delayed to be sent together by the Nagle's algorithm
+func WithNoDelay(noDelay bool) Option {
+	return func(o *options) {
+		o.noDelay = noDelay
+	}
+}
@@ -0,0 +1,145 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/tcpsocket"
+	"github.com/plhwin/gosocket/websocket"
+)
+
+func whoami(a *gosocket.Acceptor) {
+	a.On("whoami", func(c gosocket.ClientFace, args string, id string) {
+		gosocket.NewResponse(c, "whoami", "", id).Success(c.(gosocket.Identified).Identity().UserId)
+	})
+}
+
+func TestTCPAuthenticator(t *testing.T) {
+	auth := tcpsocket.WithAuthenticator(func(msg *protocol.Message) (*gosocket.Identity, error) {
+		if msg.Args != `"secret"` {
+			return nil, errors.New("wrong token")
+		}
+		return &gosocket.Identity{UserId: "alice"}, nil
+	}, time.Second)
+
+	a := gosocket.NewAcceptor()
+	whoami(a)
+	for _, token := range []string{"secret", "guess"} {
+		connected := make(chan bool, 1)
+		i := gosocket.NewInitiator()
+		i.On(gosocket.OnConnection, func(c gosocket.ConnFace) {
+			connected <- true
+		})
+		i.On(gosocket.OnDisconnection, func(c gosocket.ConnFace) {
+			connected <- false
+		})
+
+		server, client := net.Pipe()
+		tcpsocket.Serve(context.Background(), server, a, new(tcpsocket.Client), auth)
+		conn := new(tcpsocket.Conn)
+		tcpsocket.Receive(i, client, conn)
+		i.SetConn(conn)
+		i.Emit(gosocket.EventAuth, token, "")
+
+		if ok := <-connected; ok != (token == "secret") {
+			t.Fatal("unexpected authentication result:", token, ok)
+		}
+		if token == "secret" {
+			result, err := i.EmitSync("whoami", "", "")
+			if reply, ok := result.(map[string]interface{}); err != nil || !ok || reply["data"] != "alice" {
+				t.Fatalf("unexpected identity: %+v %v", result, err)
+			}
+		}
+	}
+}
+
+func TestWebsocketAuthenticator(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	whoami(a)
+	auth := websocket.WithAuthenticator(func(r *http.Request) (*gosocket.Identity, error) {
+		if r.URL.Query().Get("token") != "secret" {
+			return nil, errors.New("wrong token")
+		}
+		return &gosocket.Identity{UserId: "alice"}, nil
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		websocket.Serve(context.Background(), a, w, r, new(websocket.Client), auth)
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	if _, resp, err := websocket.Dial(url+"?token=guess", nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal("the peer should be rejected:", err)
+	}
+
+	conn, _, err := websocket.Dial(url+"?token=secret", nil)
+	if err != nil {
+		t.Fatal("dial error:", err)
+	}
+	connected := make(chan bool, 1)
+	i := gosocket.NewInitiator()
+	i.On(gosocket.OnConnection, func(c gosocket.ConnFace) {
+		connected <- true
+	})
+	c := new(websocket.Conn)
+	websocket.Receive(i, conn, c)
+	i.SetConn(c)
+	<-connected
+
+	result, err := i.EmitSync("whoami", "", "")
+	if reply, ok := result.(map[string]interface{}); err != nil || !ok || reply["data"] != "alice" {
+		t.Fatalf("unexpected identity: %+v %v", result, err)
+	}
+}
+
+func TestTCPAuthPayloadReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := gosocket.NewAcceptor()
+	whoami(a)
+	clients := make(chan gosocket.ClientFace, 2)
+	a.On(gosocket.OnConnection, func(c gosocket.ClientFace) {
+		clients <- c
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tcpsocket.ServeListener(ctx, l, a, func() tcpsocket.ClientFace {
+		return new(tcpsocket.Client)
+	}, tcpsocket.WithAuthenticator(func(msg *protocol.Message) (*gosocket.Identity, error) {
+		if msg.Args != `"secret"` {
+			return nil, errors.New("wrong token")
+		}
+		return &gosocket.Identity{UserId: "alice"}, nil
+	}, time.Second))
+
+	i := gosocket.NewInitiator()
+	dial := tcpsocket.Dialer("tcp", l.Addr().String(), func() tcpsocket.ConnFace {
+		return new(tcpsocket.Conn)
+	}, tcpsocket.WithAuthPayload("secret"))
+	go i.Reconnect(ctx, dial, gosocket.Backoff{Min: 50 * time.Millisecond, Max: time.Second, Factor: 2})
+
+	// authenticated again after reconnected
+	for n := 0; n < 2; n++ {
+		select {
+		case c := <-clients:
+			if identity := c.(gosocket.Identified).Identity(); identity == nil || identity.UserId != "alice" {
+				t.Fatal("unexpected identity:", identity)
+			}
+			if n == 0 {
+				c.(*tcpsocket.Client).Close()
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("the initiator was not authenticated:", n)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/tcpsocket"
+)
+
+// emit 20 quotes to a client which does not read, then start reading and return the received quotes
+func slowConsumer(t *testing.T, b gosocket.Backpressure) (*tcpsocket.Client, []string, bool) {
+	a := gosocket.NewAcceptor()
+	a.SetBackpressure(b)
+
+	server, client := net.Pipe()
+	c := new(tcpsocket.Client)
+	tcpsocket.Serve(context.Background(), server, a, c)
+	for n := 0; n < 20; n++ {
+		c.Emit("quote", strconv.Itoa(n), "")
+	}
+
+	quotes := make(chan string, 20)
+	disconnected := make(chan bool, 1)
+	i := gosocket.NewInitiator()
+	i.On("quote", func(c gosocket.ConnFace, args string) {
+		quotes <- args
+	})
+	i.On(gosocket.OnDisconnection, func(c gosocket.ConnFace) {
+		disconnected <- true
+	})
+	tcpsocket.Receive(i, client, new(tcpsocket.Conn))
+
+	var received []string
+	for {
+		select {
+		case quote := <-quotes:
+			received = append(received, quote)
+		case <-disconnected:
+			return c, received, true
+		case <-time.After(200 * time.Millisecond):
+			client.Close()
+			return c, received, false
+		}
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	// the handlers are called concurrently, so only the latest quote is checked
+	latest := func(quotes []string) bool {
+		for _, quote := range quotes {
+			if quote == "19" {
+				return true
+			}
+		}
+		return false
+	}
+
+	c, quotes, _ := slowConsumer(t, gosocket.Backpressure{Policy: conf.BackpressureDropNewest, Capacity: 4})
+	if c.Dropped() == 0 || latest(quotes) {
+		t.Fatal("DropNewest: the latest quote should be dropped", c.Dropped(), quotes)
+	}
+
+	c, quotes, _ = slowConsumer(t, gosocket.Backpressure{Policy: conf.BackpressureDropOldest, Capacity: 4})
+	if c.Dropped() == 0 || !latest(quotes) || len(quotes) > 4 {
+		t.Fatal("DropOldest: the latest 4 quotes should be kept", c.Dropped(), quotes)
+	}
+
+	c, quotes, _ = slowConsumer(t, gosocket.Backpressure{Policy: conf.BackpressureCoalesce, Capacity: 4})
+	if c.Dropped() == 0 || !latest(quotes) || len(quotes) > 5 {
+		t.Fatal("Coalesce: the latest quote should be kept", c.Dropped(), quotes)
+	}
+
+	c, _, disconnected := slowConsumer(t, gosocket.Backpressure{Policy: conf.BackpressureDisconnect, Capacity: 4})
+	if c.Dropped() == 0 || !disconnected {
+		t.Fatal("Disconnect: the slow client should be disconnected", c.Dropped())
+	}
+}
+
+func TestBackpressureBlock(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	a.SetBackpressure(gosocket.Backpressure{Policy: conf.BackpressureBlock, Capacity: 1, BlockTimeout: 50 * time.Millisecond})
+
+	server, client := net.Pipe()
+	defer client.Close()
+	c := new(tcpsocket.Client)
+	tcpsocket.Serve(context.Background(), server, a, c)
+	// wait until the writer is blocked by the client which does not read, with the queued messages taken in batch,
+	// then fill the message send channel
+	for len(c.Out()) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Emit("quote", "0", "")
+
+	start := time.Now()
+	ack := <-c.EmitWithAck("quote", "1", 0)
+	if ack.Err != gosocket.ErrorEmitDropped || time.Since(start) < 50*time.Millisecond {
+		t.Fatal("Block: the sender should be blocked until timeout", ack.Err, time.Since(start))
+	}
+}
+
+func TestBackpressureBlockRooms(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	// the timeout must be positive, the sender is never blocked forever
+	a.SetBackpressure(gosocket.Backpressure{Policy: conf.BackpressureBlock, Capacity: 1})
+	if a.Backpressure().BlockTimeout <= 0 {
+		t.Fatal("the block timeout should be defaulted:", a.Backpressure().BlockTimeout)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	c := new(tcpsocket.Client)
+	tcpsocket.Serve(context.Background(), server, a, c)
+	c.Join("EURUSD")
+	for len(c.Out()) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Emit("quote", "0", "")
+
+	// the broadcasts to the client which does not read never block the rooms
+	done := make(chan bool)
+	go func() {
+		for n := 0; n < 5; n++ {
+			a.BroadcastTo("EURUSD", "quote", strconv.Itoa(n), "")
+		}
+		c.Join("GBPUSD")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("the rooms were blocked by the slow client")
+	}
+	if c.Dropped() == 0 {
+		t.Fatal("the broadcasts to the slow client should be dropped")
+	}
+}
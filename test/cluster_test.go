@@ -0,0 +1,157 @@
+package test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/cluster"
+	"github.com/plhwin/gosocket/tcpsocket"
+)
+
+// receive the "quote" event by a client connected to a2, which is broadcast by a1
+func testBroadcastAcrossNodes(t *testing.T, a1, a2 *gosocket.Acceptor) {
+	quotes := make(chan string, 16)
+	i := gosocket.NewInitiator()
+	i.On("quote", func(c gosocket.ConnFace, args string) {
+		quotes <- args
+	})
+	c, _ := pipe(t, a2, i)
+
+	deadline := time.After(3 * time.Second)
+	for {
+		// join the room from the other node,
+		// retry until the nodes are connected, the operations are dropped before that
+		a1.JoinRoom(c.Id(), "EURUSD")
+		a1.BroadcastTo("EURUSD", "quote", "1.21581", "")
+		select {
+		case quote := <-quotes:
+			if quote != "1.21581" {
+				t.Fatal("unexpected quote:", quote)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("broadcast not received across the nodes")
+		}
+	}
+}
+
+func TestMemoryAdapter(t *testing.T) {
+	hub := cluster.NewMemoryHub()
+	a1, a2 := gosocket.NewAcceptor(), gosocket.NewAcceptor()
+	a1.SetAdapter(hub.NewAdapter())
+	a2.SetAdapter(hub.NewAdapter())
+	testBroadcastAcrossNodes(t, a1, a2)
+}
+
+func TestTCPAdapter(t *testing.T) {
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err = cluster.NewTCPAdapter(l1, []string{l2.Addr().String()}); err != cluster.ErrorNodeUnauthenticated {
+		t.Fatal("the links between the nodes must be authenticated:", err)
+	}
+	ad1, err := cluster.NewTCPAdapter(l1, []string{l2.Addr().String()}, cluster.WithSecret("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ad2, err := cluster.NewTCPAdapter(l2, []string{l1.Addr().String()}, cluster.WithSecret("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ad1.Run(ctx)
+	go ad2.Run(ctx)
+
+	a1, a2 := gosocket.NewAcceptor(), gosocket.NewAcceptor()
+	a1.SetAdapter(ad1)
+	a2.SetAdapter(ad2)
+	testBroadcastAcrossNodes(t, a1, a2)
+}
+
+func TestTCPAdapterUnauthenticatedPeer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ad, err := cluster.NewTCPAdapter(l, nil, cluster.WithSecret("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ad.Run(ctx)
+	a := gosocket.NewAcceptor()
+	a.SetAdapter(ad)
+
+	quotes := make(chan string, 1)
+	i := gosocket.NewInitiator()
+	i.On("quote", func(c gosocket.ConnFace, args string) {
+		quotes <- args
+	})
+	c, _ := pipe(t, a, i)
+
+	// the operations of the peer with a wrong secret are not applied
+	disconnected := make(chan bool, 1)
+	peer := gosocket.NewInitiator()
+	peer.On(gosocket.OnDisconnection, func(c gosocket.ConnFace) {
+		disconnected <- true
+	})
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := new(tcpsocket.Conn)
+	tcpsocket.Receive(peer, conn, pc, tcpsocket.WithAuthPayload("guess"))
+	pc.Emit(cluster.EventAdapter, gosocket.AdapterMessage{Type: gosocket.AdapterEmit, ClientId: c.Id(), Event: "quote", Args: []byte(`"1.21581"`)}, "")
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the unauthenticated peer was not disconnected")
+	}
+	select {
+	case quote := <-quotes:
+		t.Fatal("the operation of the unauthenticated peer was applied:", quote)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTCPAdapterPublishNonBlocking(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// the peer is never connected, the operations are queued up to the queue size
+	ad, err := cluster.NewTCPAdapter(l, []string{"127.0.0.1:1"}, cluster.WithSecret("s3cret"), cluster.WithQueueSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := gosocket.NewAcceptor()
+	a.SetAdapter(ad)
+	done := make(chan bool)
+	go func() {
+		for n := 0; n < 10; n++ {
+			a.BroadcastTo("EURUSD", "quote", "1.21581", "")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the broadcast was blocked by the peer")
+	}
+	if dropped := ad.Dropped(); dropped != 6 {
+		t.Fatal("unexpected dropped operations:", dropped)
+	}
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/tcpsocket"
+	"github.com/plhwin/gosocket/websocket"
+)
+
+func TestParseCodec(t *testing.T) {
+	for s, want := range map[string]protocol.Codec{
+		"Protobuf.Snappy": {Serialize: conf.TransportSerializeProtobuf, Compress: conf.TransportCompressSnappy},
+		"protobuf.gzip":   {Serialize: conf.TransportSerializeProtobuf, Compress: conf.TransportCompressGzip},
+		"text":            {Serialize: conf.TransportSerializeText, Compress: conf.TransportCompressNone},
+		"Text.FLate":      {Serialize: conf.TransportSerializeText, Compress: conf.TransportCompressFLate},
+	} {
+		codec, err := protocol.ParseCodec(s)
+		if err != nil || codec != want {
+			t.Fatal("unexpected codec:", s, codec, err)
+		}
+		if codec.Binary() != (s != "text") {
+			t.Fatal("unexpected binary:", s)
+		}
+	}
+	for _, s := range []string{"", "Xml", "Protobuf.Zip", ".None"} {
+		if _, err := protocol.ParseCodec(s); err != protocol.ErrorUnsupportedCodec {
+			t.Fatal("the codec should be unsupported:", s, err)
+		}
+	}
+}
+
+func echoAcceptor() *gosocket.Acceptor {
+	a := gosocket.NewAcceptor()
+	a.On("echo", func(c gosocket.ClientFace, args string, id string) {
+		c.Emit("echo", args+" "+c.(interface{ SendCodec() protocol.Codec }).SendCodec().String(), id)
+	})
+	return a
+}
+
+func TestTCPSocketNegotiation(t *testing.T) {
+	a := echoAcceptor()
+	// the clients with different codecs on the same acceptor
+	for _, codec := range []*protocol.Codec{
+		{Serialize: conf.TransportSerializeProtobuf, Compress: conf.TransportCompressSnappy},
+		{Serialize: conf.TransportSerializeText, Compress: conf.TransportCompressGzip},
+		nil,
+	} {
+		server, client := net.Pipe()
+		tcpsocket.Serve(context.Background(), server, a, new(tcpsocket.Client), tcpsocket.WithNegotiation(time.Second))
+
+		i := gosocket.NewInitiator()
+		conn := new(tcpsocket.Conn)
+		want := "hi Text.None"
+		if codec != nil {
+			conn.SetCodec(*codec)
+			want = "hi " + codec.String()
+		} else {
+			// without the codec, the hello frame is still required
+			conn.SetCodec(protocol.Codec{Serialize: conf.TransportSerializeText, Compress: conf.TransportCompressNone})
+		}
+		tcpsocket.Receive(i, client, conn)
+		i.SetConn(conn)
+		reply, err := i.EmitSync("echo", "hi", "")
+		if err != nil || reply != want {
+			t.Fatal("unexpected reply:", reply, err)
+		}
+		conn.Close()
+	}
+
+	// the peer does not send the hello frame
+	server, client := net.Pipe()
+	defer client.Close()
+	c := new(tcpsocket.Client)
+	tcpsocket.Serve(context.Background(), server, a, c, tcpsocket.WithNegotiation(100*time.Millisecond))
+	select {
+	case <-c.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("the peer without hello frame should be closed")
+	}
+}
+
+func TestWebsocketNegotiation(t *testing.T) {
+	a := echoAcceptor()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		websocket.Serve(context.Background(), a, w, r, new(websocket.Client))
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	codec := protocol.Codec{Serialize: conf.TransportSerializeProtobuf, Compress: conf.TransportCompressSnappy}
+	for _, tc := range []struct {
+		url   string
+		codec *protocol.Codec
+		want  string
+	}{
+		{url, &codec, "hi Protobuf.Snappy"},                            // by the subprotocol
+		{url + "?codec=protobuf.snappy", &codec, "hi Protobuf.Snappy"}, // by the query param
+		{url, nil, "hi Text.None"},                                     // by the conf
+	} {
+		i := gosocket.NewInitiator()
+		dial := websocket.Dialer(tc.url, nil, func() websocket.ConnFace {
+			c := new(websocket.Conn)
+			if tc.codec != nil {
+				c.SetCodec(*tc.codec)
+			}
+			return c
+		})
+		c, err := dial(context.Background(), i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i.SetConn(c)
+		reply, err := i.EmitSync("echo", "hi", "")
+		if err != nil || reply != tc.want {
+			t.Fatal("unexpected reply:", tc.url, reply, err)
+		}
+		c.(websocket.ConnFace).Close()
+	}
+
+	resp, err := http.Get(server.URL + "?codec=xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("the unsupported codec should be rejected:", resp.StatusCode)
+	}
+}
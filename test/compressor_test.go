@@ -0,0 +1,100 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/util"
+)
+
+func quoteMessage(n int) []byte {
+	return []byte(fmt.Sprintf(`["quote",{"symbol":"EURUSD","bid":1.08%03d,"ask":1.08%03d,"time":17000%05d},"q%d"]`, n%1000, (n+2)%1000, n, n))
+}
+
+func TestCompressors(t *testing.T) {
+	data := bytes.Repeat(quoteMessage(1), 10)
+	for _, name := range []string{conf.TransportCompressLZ4, conf.TransportCompressZstd} {
+		c := protocol.Compressors[name]
+		zipped, err := c.Zip(data)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if len(zipped) >= len(data) {
+			t.Fatal("the data should be compressed:", name, len(zipped), len(data))
+		}
+		unzipped, err := c.Unzip(zipped)
+		if err != nil || !bytes.Equal(unzipped, data) {
+			t.Fatal("unexpected unzipped data:", name, err)
+		}
+		if empty, err := c.Zip(nil); err != nil {
+			t.Fatal(name, err)
+		} else if unzipped, err = c.Unzip(empty); err != nil || len(unzipped) != 0 {
+			t.Fatal("unexpected empty data:", name, unzipped, err)
+		}
+	}
+}
+
+func TestCompressorsMaxSize(t *testing.T) {
+	// the small message decompressed into the data larger than the max message size
+	size := max(conf.Acceptor.Transport.MaxMessageSize, conf.Initiator.Transport.MaxMessageSize)
+	for _, name := range []string{conf.TransportCompressLZ4, conf.TransportCompressZstd} {
+		c := protocol.Compressors[name]
+		zipped, err := c.Zip(make([]byte, size+1))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if _, err = c.Unzip(zipped); err != util.ErrorSizeExceeded {
+			t.Fatal("the data larger than the max message size should not be unzipped:", name, err)
+		}
+		zipped, _ = c.Zip(make([]byte, size))
+		if unzipped, err := c.Unzip(zipped); err != nil || len(unzipped) != size {
+			t.Fatal("unexpected unzipped data:", name, len(unzipped), err)
+		}
+	}
+}
+
+func TestZstdDictionary(t *testing.T) {
+	var samples [][]byte
+	for n := 0; n < 200; n++ {
+		samples = append(samples, quoteMessage(n))
+	}
+	d, err := dict.BuildZstdDict(samples, dict.Options{MaxDictSize: 4096, HashBytes: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withDict, err := protocol.NewZstdCompressor(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutDict := protocol.Compressors[conf.TransportCompressZstd]
+
+	msg := quoteMessage(1234)
+	small, err := withDict.Zip(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, _ := withoutDict.Zip(msg)
+	if len(small) >= len(large) {
+		t.Fatal("the dictionary should shrink the small message:", len(small), len(large))
+	}
+	if unzipped, err := withDict.Unzip(small); err != nil || !bytes.Equal(unzipped, msg) {
+		t.Fatal("unexpected unzipped data:", string(unzipped), err)
+	}
+	// the peer must use the same dictionary
+	if _, err = withoutDict.Unzip(small); err == nil {
+		t.Fatal("the message compressed with the dictionary should not be unzipped without it")
+	}
+
+	// registered while the connections of the other tests are served
+	protocol.RegisterCompressor("ZstdQuote", withDict)
+	if protocol.GetCompressor("ZstdQuote") != withDict {
+		t.Fatal("the registered compressor is not found")
+	}
+	if codec, err := protocol.ParseCodec("msgpack.zstdquote"); err != nil || codec.Compress != "ZstdQuote" {
+		t.Fatal("unexpected codec:", codec, err)
+	}
+}
@@ -0,0 +1,38 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+)
+
+func TestEmitWithAck(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	i := gosocket.NewInitiator()
+	i.On("logout", func(c gosocket.ConnFace, args string, id string) {
+		c.Emit("logout", "bye "+args, id)
+	})
+	c, _ := pipe(t, a, i)
+
+	ack := <-c.EmitWithAck("logout", "alice", time.Second)
+	if ack.Err != nil || ack.Result != "bye alice" {
+		t.Fatalf("unexpected ack: %+v", ack)
+	}
+
+	ack = <-c.EmitWithAck("nobody", nil, 100*time.Millisecond)
+	if ack.Err != gosocket.ErrorAckTimeout {
+		t.Fatal("expect timeout error, got:", ack.Err)
+	}
+
+	result := c.EmitWithAck("nobody", nil, 0)
+	c.Close()
+	select {
+	case ack = <-result:
+		if ack.Err != gosocket.ErrorAckDisconnected {
+			t.Fatal("expect disconnected error, got:", ack.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ack not failed after the client disconnected")
+	}
+}
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+)
+
+func TestEmitSync(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	a.On("echo", func(c gosocket.ClientFace, args string, id string) {
+		gosocket.NewResponse(c, "echo", "", id).Success(args)
+	})
+	i := gosocket.NewInitiator()
+	_, conn := pipe(t, a, i)
+
+	result, err := conn.EmitSync("echo", "hello", "")
+	if err != nil {
+		t.Fatal("emit sync error:", err)
+	}
+	reply, ok := result.(map[string]interface{})
+	if !ok || reply["result"] != true || reply["data"] != "hello" {
+		t.Fatalf("unexpected reply: %+v", result)
+	}
+}
+
+func TestEmitSyncDisconnected(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	i := gosocket.NewInitiator()
+	c, _ := pipe(t, a, i)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		c.Close()
+	}()
+	if _, err := i.EmitSync("nobody", nil, ""); err != gosocket.ErrorEmitSyncDisconnected {
+		t.Fatal("expect disconnected error, got:", err)
+	}
+	if _, err := i.EmitSync("nobody", nil, ""); err != gosocket.ErrorEmitSyncDisconnected {
+		t.Fatal("expect disconnected error after closed, got:", err)
+	}
+}
+
+func TestEmitSyncFailFast(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	a.On("slow", func(c gosocket.ClientFace, args string, id string) {
+		time.Sleep(300 * time.Millisecond)
+		gosocket.NewResponse(c, "slow", "", id).Success(args)
+	})
+	i := gosocket.NewInitiator()
+	_, conn := pipe(t, a, i)
+
+	// the args can not be encoded, the error is returned without waiting for the timeout
+	start := time.Now()
+	if _, err := conn.EmitSync("slow", make(chan int), ""); err == nil {
+		t.Fatal("expect encode error")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("emit sync waited for the timeout after the encode error")
+	}
+
+	// the waiter of the same id is kept, the duplicate one is rejected
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.EmitSync("slow", "first", "dup")
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if _, err := conn.EmitSync("slow", "second", "dup"); err != gosocket.ErrorEmitSyncDuplicateId {
+		t.Fatal("expect duplicate id error, got:", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal("the first waiter was broken by the duplicate id:", err)
+	}
+}
+
+func TestEmitSyncSendTimeout(t *testing.T) {
+	timeout := conf.Initiator.EmitSync.Timeout
+	conf.Initiator.EmitSync.Timeout = 1
+	defer func() { conf.Initiator.EmitSync.Timeout = timeout }()
+
+	i := gosocket.NewInitiator()
+	pipe(t, gosocket.NewAcceptor(), i)
+
+	// nobody writes the send channel of the conn, it is full
+	conn := new(gosocket.Conn)
+	conn.Init(i)
+	for len(conn.Out()) < cap(conn.Out()) {
+		conn.Out() <- nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.EmitSync("echo", "hello", "")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != gosocket.ErrorEmitSyncTimeout {
+			t.Fatal("expect timeout error, got:", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("emit sync blocked on the full send channel past the timeout")
+	}
+}
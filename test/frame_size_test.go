@@ -0,0 +1,144 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/tcpsocket"
+	"github.com/plhwin/gosocket/websocket"
+)
+
+func TestFrameSize(t *testing.T) {
+	var sizeErr *protocol.FrameSizeError
+	for _, length := range []uint32{1 << 31, 0xffffffff, 1025} {
+		buf := binary.BigEndian.AppendUint32(nil, length)
+		if _, err := protocol.DePackLimit(&buf, 1024); !errors.As(err, &sizeErr) || sizeErr.Length != int(int32(length)) || sizeErr.Max != 1024 {
+			t.Fatal("the frame should be rejected:", length, err)
+		}
+		r := protocol.NewFrameReader(bytes.NewReader(buf), 256)
+		r.SetMaxSize(1024)
+		if _, err := r.ReadFrame(); !errors.As(err, &sizeErr) {
+			t.Fatal("the frame should be rejected:", length, err)
+		}
+	}
+	// the frame of the max size and the incomplete frame
+	buf := protocol.AppendPack(nil, make([]byte, 1024))
+	buf = append(buf, 0, 0, 4)
+	if data, err := protocol.DePackLimit(&buf, 1024); err != nil || len(data) != 1 || len(buf) != 3 {
+		t.Fatal("unexpected frames:", len(data), len(buf), err)
+	}
+}
+
+func TestTCPSocketOversized(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	server, client := net.Pipe()
+	defer client.Close()
+	c := new(tcpsocket.Client)
+	tcpsocket.Serve(context.Background(), server, a, c)
+	go func() {
+		// discard the socket id and pings
+		buf := make([]byte, 1024)
+		for {
+			if _, err := client.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	client.Write(binary.BigEndian.AppendUint32(nil, uint32(conf.Acceptor.Transport.MaxMessageSize+1)))
+	select {
+	case <-c.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("the client sent the oversized frame should be closed")
+	}
+	if a.Oversized() != 1 {
+		t.Fatal("unexpected oversized:", a.Oversized())
+	}
+}
+
+func TestWebsocketOversized(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		websocket.Serve(context.Background(), a, w, r, new(websocket.Client))
+	}))
+	defer server.Close()
+
+	conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.WriteMessage(gorilla.TextMessage, make([]byte, conf.Acceptor.Transport.MaxMessageSize+1))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err = conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	if !gorilla.IsCloseError(err, gorilla.CloseMessageTooBig) {
+		t.Fatal("the client sent the oversized message should be closed:", err)
+	}
+	// the close message is sent before the read loop of the server returns
+	for start := time.Now(); a.Oversized() == 0 && time.Since(start) < time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	if a.Oversized() != 1 {
+		t.Fatal("unexpected oversized:", a.Oversized())
+	}
+}
+
+func FuzzDePack(f *testing.F) {
+	f.Add(protocol.AppendPack(nil, quoteMessage(1)))
+	f.Add(protocol.AppendPack(protocol.AppendPack(nil, []byte(`["ping"]`)), nil)[:10])
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{0, 0, 4, 1, 'x'})
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		buf := bytes.Clone(stream)
+		data, err := protocol.DePackLimit(&buf, 1024)
+		var size int
+		for _, row := range data {
+			if len(row) > 1024 {
+				t.Fatal("the frame larger than the max size:", len(row))
+			}
+			size += 4 + len(row)
+		}
+		if size+len(buf) != len(stream) || !bytes.Equal(buf, stream[size:]) {
+			t.Fatal("the rest of the stream is lost:", size, len(buf), len(stream))
+		}
+		if err != nil {
+			return
+		}
+		// the rest is an incomplete frame
+		if len(buf) >= 4 && int(binary.BigEndian.Uint32(buf)) <= len(buf)-4 {
+			t.Fatal("the complete frame is not unpacked:", buf)
+		}
+	})
+}
+
+func FuzzTextProtocolDecode(f *testing.F) {
+	for _, seed := range []string{`["ping"]`, `["quote",{"bid":1.08},"1"]`, `["echo","hi"]`, `["echo","hi","1"]`, `[",",",","]`, `["","x"]`, `"`, `[]`, `["é",["中文"],"ü"]`} {
+		f.Add([]byte(seed))
+	}
+	f.Add(quoteMessage(1))
+	p := new(protocol.DefaultTextProtocol)
+	f.Fuzz(func(t *testing.T, text []byte) {
+		msg := new(protocol.Message)
+		if err := p.Decode(text, msg); err != nil {
+			return
+		}
+		if msg.Event == "" {
+			t.Fatal("the message without event is decoded:", string(text))
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/plhwin/gosocket/protocol"
+)
+
+func TestFrameReaderAndWriter(t *testing.T) {
+	msgs := [][]byte{quoteMessage(1), {}, bytes.Repeat(quoteMessage(2), 100), quoteMessage(3)}
+	var buf bytes.Buffer
+	if err := protocol.NewFrameWriter(&buf).WriteFrames(msgs...); err != nil {
+		t.Fatal(err)
+	}
+	// the same as packed one by one
+	var packed []byte
+	for _, msg := range msgs {
+		packed = protocol.AppendPack(packed, msg)
+	}
+	if !bytes.Equal(buf.Bytes(), packed) {
+		t.Fatal("unexpected frames:", buf.Len(), len(packed))
+	}
+
+	// the frames are read byte by byte, the large frame is larger than the read buffer
+	r := protocol.NewFrameReader(iotest.OneByteReader(bytes.NewReader(packed)), 256)
+	for _, msg := range msgs {
+		frame, err := r.ReadFrame()
+		if err != nil || !bytes.Equal(frame, msg) {
+			t.Fatal("unexpected frame:", len(frame), len(msg), err)
+		}
+	}
+	if _, err := r.ReadFrame(); err != io.EOF {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// the frame larger than the max size is rejected
+	large := len(msgs[2])
+	r = protocol.NewFrameReader(bytes.NewReader(packed), 256)
+	r.SetMaxSize(large - 1)
+	var sizeErr *protocol.FrameSizeError
+	for _, msg := range msgs[:2] {
+		if frame, err := r.ReadFrame(); err != nil || !bytes.Equal(frame, msg) {
+			t.Fatal("unexpected frame:", len(frame), len(msg), err)
+		}
+	}
+	if _, err := r.ReadFrame(); !errors.As(err, &sizeErr) || sizeErr.Length != large || sizeErr.Max != large-1 {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func BenchmarkEnPack(b *testing.B) {
+	msg := quoteMessage(1)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		protocol.EnPack(msg)
+	}
+}
+
+func BenchmarkAppendPack(b *testing.B) {
+	msg := quoteMessage(1)
+	var buf []byte
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		buf = protocol.AppendPack(buf[:0], msg)
+	}
+}
+
+// the frames read in 256 bytes chunks and unpacked by DePack, as the read loop did
+func BenchmarkDePack(b *testing.B) {
+	stream := framesStream(100)
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		r := bytes.NewReader(stream)
+		buf := make([]byte, 0, 4096)
+		readBuf := make([]byte, 256)
+		for {
+			m, err := r.Read(readBuf)
+			if err != nil {
+				break
+			}
+			buf = append(buf, readBuf[:m]...)
+			if _, err = protocol.DePack(&buf); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkFrameReader(b *testing.B) {
+	stream := framesStream(100)
+	r := bytes.NewReader(stream)
+	frames := protocol.NewFrameReader(r, 4096)
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		r.Reset(stream)
+		for {
+			if _, err := frames.ReadFrame(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkFrameWriter(b *testing.B) {
+	msgs := make([][]byte, 64)
+	for n := range msgs {
+		msgs[n] = quoteMessage(n)
+	}
+	frames := protocol.NewFrameWriter(io.Discard)
+	batch := make([][]byte, len(msgs))
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		copy(batch, msgs)
+		if err := frames.WriteFrames(batch...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// the frames of the quote messages
+func framesStream(size int) (stream []byte) {
+	for n := 0; n < size; n++ {
+		stream = protocol.AppendPack(stream, quoteMessage(n))
+	}
+	return
+}
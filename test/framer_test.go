@@ -0,0 +1,118 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/tcpsocket"
+)
+
+func TestFramers(t *testing.T) {
+	msgs := [][]byte{[]byte(`["ping"]`), {}, []byte(strings.Repeat(`["quote","EURUSD"]`, 20)), quoteMessage(1)}
+	for _, framer := range []protocol.Framer{protocol.Int32Framer{}, protocol.Uint16Framer{}, protocol.UvarintFramer{}, protocol.NewlineFramer{}} {
+		var buf bytes.Buffer
+		w := protocol.NewFrameWriter(&buf)
+		w.SetFramer(framer)
+		if err := w.WriteFrames(msgs...); err != nil {
+			t.Fatal(framer, err)
+		}
+		if err := w.WriteFrames(msgs[3]); err != nil {
+			t.Fatal(framer, err)
+		}
+		// the frames are read byte by byte, some of them are larger than the read buffer
+		r := protocol.NewFrameReader(iotest.OneByteReader(&buf), 16)
+		r.SetFramer(framer)
+		for _, msg := range append(msgs, msgs[3]) {
+			frame, err := r.ReadFrame()
+			if err != nil || !bytes.Equal(frame, msg) {
+				t.Fatal("unexpected frame:", framer, string(frame), string(msg), err)
+			}
+		}
+		if _, err := r.ReadFrame(); err != io.EOF {
+			t.Fatal("unexpected error:", framer, err)
+		}
+	}
+
+	var sizeErr *protocol.FrameSizeError
+	if _, err := (protocol.Uint16Framer{}).AppendHeader(nil, make([]byte, 65536)); !errors.As(err, &sizeErr) {
+		t.Fatal("the message larger than 65535 bytes should be rejected:", err)
+	}
+	if _, err := (protocol.NewlineFramer{}).AppendHeader(nil, []byte("a\nb")); err != protocol.ErrorDelimiter {
+		t.Fatal("the message contains the delimiter should be rejected:", err)
+	}
+	if _, _, err := (protocol.NewlineFramer{}).Unpack([]byte("abcdef"), 4); !errors.As(err, &sizeErr) {
+		t.Fatal("the line longer than the max size should be rejected:", err)
+	}
+	if msg, n, err := (protocol.NewlineFramer{}).Unpack([]byte("abcd\r\nef"), 4); err != nil || string(msg) != "abcd" || n != 6 {
+		t.Fatal("unexpected line:", string(msg), n, err)
+	}
+	overflow := bytes.Repeat([]byte{0xff}, 10)
+	if _, _, err := (protocol.UvarintFramer{}).Unpack(append(overflow, 1), 1024); !errors.As(err, &sizeErr) {
+		t.Fatal("the overflow length should be rejected:", err)
+	}
+	if _, _, err := (protocol.UvarintFramer{}).Unpack(binary.AppendUvarint(nil, 1025), 1024); !errors.As(err, &sizeErr) {
+		t.Fatal("the oversized length should be rejected:", err)
+	}
+}
+
+func TestTCPSocketFramer(t *testing.T) {
+	a := echoAcceptor()
+
+	// the initiator with the newline framer
+	server, client := net.Pipe()
+	tcpsocket.Serve(context.Background(), server, a, new(tcpsocket.Client), tcpsocket.WithFramer(protocol.NewlineFramer{}))
+	i := gosocket.NewInitiator()
+	conn := new(tcpsocket.Conn)
+	tcpsocket.Receive(i, client, conn, tcpsocket.WithFramer(protocol.NewlineFramer{}))
+	i.SetConn(conn)
+	if reply, err := i.EmitSync("echo", "hi", ""); err != nil || reply != "hi Text.None" {
+		t.Fatal("unexpected reply:", reply, err)
+	}
+	conn.Close()
+
+	// the device with the uint16 length header
+	server, device := net.Pipe()
+	defer device.Close()
+	tcpsocket.Serve(context.Background(), server, a, new(tcpsocket.Client), tcpsocket.WithFramer(protocol.Uint16Framer{}))
+	replies := make(chan string, 10)
+	go func() {
+		r := bufio.NewReader(device)
+		header := make([]byte, 2)
+		for {
+			if _, err := io.ReadFull(r, header); err != nil {
+				return
+			}
+			body := make([]byte, binary.BigEndian.Uint16(header))
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+			replies <- string(body)
+		}
+	}()
+	req := []byte(`["echo","hi","1"]`)
+	device.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(req))), req...))
+	for {
+		select {
+		case reply := <-replies:
+			if strings.HasPrefix(reply, `["echo"`) {
+				if reply != `["echo","hi Text.None","1"]` {
+					t.Fatal("unexpected reply:", reply)
+				}
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no reply from the acceptor")
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/polling"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/sse"
+)
+
+// httpTransportAcceptor the acceptor of the HTTP transports, the disconnected client ids are sent to the channel
+func httpTransportAcceptor() (*gosocket.Acceptor, chan string) {
+	a := gosocket.NewAcceptor()
+	a.On("echo", func(c gosocket.ClientFace, args string, id string) {
+		c.Emit("echo", args, id)
+	})
+	a.On("join", func(c gosocket.ClientFace, room string) {
+		c.Join(room)
+		c.Emit("joined", room, "")
+	})
+	disconnected := make(chan string, 1)
+	a.On(gosocket.OnDisconnection, func(c gosocket.ClientFace) {
+		disconnected <- c.Id()
+	})
+	return a, disconnected
+}
+
+func httpRequest(t *testing.T, method, url string, body []byte) *http.Response {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// poll the messages of the session, the messages are returned in batch
+func poll(t *testing.T, url string) (msgs []string) {
+	resp := httpRequest(t, http.MethodGet, url, nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("unexpected poll status:", resp.StatusCode)
+	}
+	fr := protocol.NewFrameReader(resp.Body, 1024)
+	for {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		msgs = append(msgs, string(frame))
+	}
+}
+
+// expectMessages receive the messages until all of the events were received in any order,
+// because the handlers are called concurrently, the messages of the events are returned
+func expectMessages(t *testing.T, receive func() []string, events ...string) map[string]string {
+	received := make(map[string]string)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(received) < len(events) {
+		if time.Now().After(deadline) {
+			t.Fatal("the events were not received:", events, received)
+		}
+		for _, msg := range receive() {
+			for _, event := range events {
+				if strings.HasPrefix(msg, `["`+event+`"`) {
+					received[event] = msg
+				}
+			}
+		}
+	}
+	return received
+}
+
+func TestPolling(t *testing.T) {
+	a, disconnected := httpTransportAcceptor()
+	server := httptest.NewServer(polling.NewHandler(context.Background(), a, nil, polling.WithPollTimeout(100*time.Millisecond)))
+	defer server.Close()
+
+	resp := httpRequest(t, http.MethodGet, server.URL, nil)
+	resp.Body.Close()
+	sid := resp.Header.Get(polling.SessionHeader)
+	if resp.StatusCode != http.StatusOK || sid == "" {
+		t.Fatal("unexpected handshake response:", resp.StatusCode, sid)
+	}
+	url := server.URL + "?" + polling.SessionParam + "=" + sid
+	receive := func() []string { return poll(t, url) }
+	expectMessages(t, receive, gosocket.EventSocketId)
+
+	// the messages of the POST request are handled in order
+	body := protocol.AppendPack(nil, []byte(`["echo","hi","1"]`))
+	body = protocol.AppendPack(body, []byte(`["join","EURUSD"]`))
+	if resp = httpRequest(t, http.MethodPost, url, body); resp.StatusCode != http.StatusNoContent {
+		t.Fatal("unexpected post status:", resp.StatusCode)
+	}
+	resp.Body.Close()
+	if msgs := expectMessages(t, receive, "echo", "joined"); msgs["echo"] != `["echo","hi","1"]` {
+		t.Fatal("unexpected echo:", msgs)
+	}
+
+	// the rooms work as the other transports
+	a.BroadcastTo("EURUSD", "quote", "1.0842", "")
+	if msgs := expectMessages(t, receive, "quote"); msgs["quote"] != `["quote","1.0842"]` {
+		t.Fatal("unexpected quote:", msgs)
+	}
+
+	// close the session by the peer
+	if resp = httpRequest(t, http.MethodDelete, url, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatal("unexpected delete status:", resp.StatusCode)
+	}
+	resp.Body.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("the session was not closed")
+	}
+	resp = httpRequest(t, http.MethodGet, url, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatal("unexpected status of the closed session:", resp.StatusCode)
+	}
+}
+
+// readEvent read the next event of the stream, the data lines are joined by the line feed
+func readEvent(t *testing.T, r *bufio.Reader) (event, data string) {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal("read event error:", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if lines != nil || event != "" {
+				return event, strings.Join(lines, "\n")
+			}
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			lines = append(lines, strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func TestSSE(t *testing.T) {
+	a, disconnected := httpTransportAcceptor()
+	server := httptest.NewServer(sse.NewHandler(context.Background(), a, nil, sse.WithFramer(protocol.NewlineFramer{})))
+	defer server.Close()
+
+	resp := httpRequest(t, http.MethodGet, server.URL, nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal("unexpected stream response:", resp.StatusCode, resp.Header)
+	}
+	r := bufio.NewReader(resp.Body)
+	event, sid := readEvent(t, r)
+	if event != sse.EventSession || sid == "" {
+		t.Fatal("unexpected session event:", event, sid)
+	}
+	receive := func() []string {
+		_, data := readEvent(t, r)
+		return []string{data}
+	}
+	expectMessages(t, receive, gosocket.EventSocketId)
+
+	url := server.URL + "?" + sse.SessionParam + "=" + sid
+	post := httpRequest(t, http.MethodPost, url, []byte("[\"echo\",\"hi\",\"1\"]\n[\"join\",\"EURUSD\"]\n"))
+	post.Body.Close()
+	if post.StatusCode != http.StatusNoContent {
+		t.Fatal("unexpected post status:", post.StatusCode)
+	}
+	if msgs := expectMessages(t, receive, "echo", "joined"); msgs["echo"] != `["echo","hi","1"]` {
+		t.Fatal("unexpected echo:", msgs)
+	}
+	a.BroadcastTo("EURUSD", "quote", "1.0842", "")
+	if msgs := expectMessages(t, receive, "quote"); msgs["quote"] != `["quote","1.0842"]` {
+		t.Fatal("unexpected quote:", msgs)
+	}
+
+	// the stream ends by the close event after the session was closed
+	del := httpRequest(t, http.MethodDelete, url, nil)
+	del.Body.Close()
+	for event != sse.EventClose {
+		event, _ = readEvent(t, r)
+	}
+	if _, err := r.ReadString('\n'); err != io.EOF {
+		t.Fatal("the stream was not ended:", err)
+	}
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("the session was not closed")
+	}
+}
+
+func TestRemoteAddrAndSessionId(t *testing.T) {
+	for addr, expected := range map[string]string{"1.2.3.4:5678": "1.2.3.4:5678", "[::1]:80": "[::1]:80", "1.2.3.4": ":0"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = addr
+		if remoteAddr := gosocket.RemoteAddr(r).String(); remoteAddr != expected {
+			t.Fatal("unexpected remote address:", addr, remoteAddr)
+		}
+	}
+	// the session ids are random and safe in the url
+	ids := make(map[string]bool)
+	for n := 0; n < 100; n++ {
+		id := gosocket.NewSessionId()
+		if len(id) != 20 || ids[id] || url.QueryEscape(id) != id {
+			t.Fatal("unexpected session id:", id)
+		}
+		ids[id] = true
+	}
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/tcpsocket"
+)
+
+// listenDial connect the initiator to the listener, the connected channel receives after the socket id was received
+func listenDial(t *testing.T, network, addr string) (i *gosocket.Initiator, echo chan string, connected chan bool) {
+	echo = make(chan string, 1)
+	connected = make(chan bool, 1)
+	i = gosocket.NewInitiator()
+	i.On(gosocket.OnConnection, func(c gosocket.ConnFace) {
+		connected <- true
+	})
+	i.On("echo", func(c gosocket.ConnFace, args string) {
+		echo <- args
+	})
+	dial := tcpsocket.Dialer(network, addr, func() tcpsocket.ConnFace {
+		return new(tcpsocket.Conn)
+	})
+	c, err := dial(context.Background(), i)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	i.SetConn(c)
+	return
+}
+
+// listenConnect connect the initiator to the listener, and wait until the socket id was received
+func listenConnect(t *testing.T, network, addr string) (*gosocket.Initiator, chan string) {
+	i, echo, connected := listenDial(t, network, addr)
+	select {
+	case <-connected:
+	case <-time.After(time.Second):
+		t.Fatal("no socket id received")
+	}
+	return i, echo
+}
+
+func TestListenAndServeUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gosocket.sock")
+	// the stale socket file left by the crashed process
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	a := gosocket.NewAcceptor()
+	a.On("echo", func(c gosocket.ClientFace, args string, id string) {
+		c.Emit("echo", args, id)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- tcpsocket.ListenAndServe(ctx, "unix", path, a, func() tcpsocket.ClientFace {
+			return new(tcpsocket.Client)
+		}, tcpsocket.WithMaxConns(1))
+	}()
+	// wait until the stale socket file was replaced
+	for {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			break
+		}
+		select {
+		case err = <-served:
+			t.Fatal("ListenAndServe error:", err)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	i, echo := listenConnect(t, "unix", path)
+	i.Emit("echo", "hi", "")
+	if args := <-echo; args != "hi" {
+		t.Fatal("unexpected echo:", args)
+	}
+
+	// the second connection is not accepted until the first one is closed
+	_, _, second := listenDial(t, "unix", path)
+	select {
+	case <-second:
+		t.Fatal("the max connections was exceeded")
+	case <-time.After(100 * time.Millisecond):
+	}
+	for _, c := range a.Clients() {
+		c.(*tcpsocket.Client).Close()
+	}
+	select {
+	case <-second:
+	case <-time.After(time.Second):
+		t.Fatal("the second connection was not accepted")
+	}
+
+	cancel()
+	select {
+	case err = <-served:
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ListenAndServe was not stopped")
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("the socket file was not removed:", err)
+	}
+	// the clients leave the acceptor asynchronously after the connections were closed
+	deadline := time.Now().Add(time.Second)
+	for len(a.Clients()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the connections were not closed:", len(a.Clients()))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServeListenerTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := gosocket.NewAcceptor()
+	a.On("echo", func(c gosocket.ClientFace, args string, id string) {
+		c.Emit("echo", args, id)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- tcpsocket.ServeListener(ctx, l, a, func() tcpsocket.ClientFace {
+			return new(tcpsocket.Client)
+		}, tcpsocket.WithKeepAlive(time.Minute), tcpsocket.WithNoDelay(true))
+	}()
+
+	i, echo := listenConnect(t, "tcp", l.Addr().String())
+	i.Emit("echo", "hi", "")
+	if args := <-echo; args != "hi" {
+		t.Fatal("unexpected echo:", args)
+	}
+
+	cancel()
+	if err = <-served; err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err = net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Fatal("the listener was not closed")
+	}
+}
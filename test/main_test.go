@@ -0,0 +1,41 @@
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/tcpsocket"
+)
+
+func TestMain(m *testing.M) {
+	conf.Init("../config-example.yaml")
+	os.Exit(m.Run())
+}
+
+// pipe connect the initiator to the acceptor over an in-memory tcp socket connection,
+// it returns after the initiator received the socket id
+func pipe(t *testing.T, a *gosocket.Acceptor, i *gosocket.Initiator) (*tcpsocket.Client, *tcpsocket.Conn) {
+	connected := make(chan bool, 1)
+	i.On(gosocket.OnConnection, func(c gosocket.ConnFace) {
+		connected <- true
+	})
+
+	server, client := net.Pipe()
+	c := new(tcpsocket.Client)
+	tcpsocket.Serve(context.Background(), server, a, c)
+	conn := new(tcpsocket.Conn)
+	tcpsocket.Receive(i, client, conn)
+	i.SetConn(conn)
+
+	select {
+	case <-connected:
+	case <-time.After(time.Second):
+		t.Fatal("no socket id received")
+	}
+	return c, conn
+}
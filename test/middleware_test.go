@@ -0,0 +1,61 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/protocol"
+)
+
+func TestMiddleware(t *testing.T) {
+	var order []string
+	trace := func(name string) gosocket.Middleware {
+		return func(next gosocket.HandlerFunc) gosocket.HandlerFunc {
+			return func(c interface{}, msg *protocol.Message) {
+				if msg.Event == "echo" {
+					order = append(order, name)
+				}
+				next(c, msg)
+			}
+		}
+	}
+	auth := func(next gosocket.HandlerFunc) gosocket.HandlerFunc {
+		return func(c interface{}, msg *protocol.Message) {
+			if msg.Event == "secret" {
+				gosocket.NewResponse(c.(gosocket.ClientFace), msg.Event, "", msg.Id).Fail("unauthorized")
+				return
+			}
+			next(c, msg)
+		}
+	}
+
+	a := gosocket.NewAcceptor()
+	a.Use(gosocket.Recover(), trace("first"), trace("second"), auth)
+	a.On("echo", func(c gosocket.ClientFace, args string, id string) {
+		gosocket.NewResponse(c, "echo", "", id).Success(args)
+	})
+	a.On("secret", func(c gosocket.ClientFace, args string, id string) {
+		gosocket.NewResponse(c, "secret", "", id).Success("the secret")
+	})
+	a.On("boom", func(c gosocket.ClientFace) {
+		panic("boom")
+	})
+	i := gosocket.NewInitiator()
+	pipe(t, a, i)
+
+	// the panic is recovered by the middleware
+	i.Emit("boom", nil, "")
+
+	result, err := i.EmitSync("secret", "please", "")
+	if reply, ok := result.(map[string]interface{}); err != nil || !ok || reply["result"] != false || reply["message"] != "unauthorized" {
+		t.Fatalf("the call should be short-circuited: %+v %v", result, err)
+	}
+
+	result, err = i.EmitSync("echo", "hello", "")
+	if reply, ok := result.(map[string]interface{}); err != nil || !ok || reply["data"] != "hello" {
+		t.Fatalf("unexpected reply: %+v %v", result, err)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Fatal("unexpected middleware order:", order)
+	}
+}
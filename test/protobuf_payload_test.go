@@ -0,0 +1,97 @@
+package test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/tcpsocket"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestEncodeProtobufPayload(t *testing.T) {
+	p := new(protocol.Protocol)
+	p.SetProtocol(nil)
+	tick := timestamppb.New(time.Unix(1700000000, 123456789))
+
+	b, err := p.Encode("tick", tick, "1", conf.TransportSerializeProtobuf, conf.TransportCompressNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := p.Decode(b, conf.TransportSerializeProtobuf, conf.TransportCompressNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Event != "tick" || msg.Id != "1" || msg.Args != "" {
+		t.Fatal("unexpected message:", msg)
+	}
+	decoded := new(timestamppb.Timestamp)
+	if err = proto.Unmarshal(msg.Data, decoded); err != nil || !proto.Equal(decoded, tick) {
+		t.Fatal("unexpected data:", decoded, err)
+	}
+
+	// the json args wrapped in protobuf is larger
+	j, err := p.Encode("tick", map[string]int64{"seconds": tick.Seconds, "nanos": int64(tick.Nanos)}, "1", conf.TransportSerializeProtobuf, conf.TransportCompressNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) >= len(j) {
+		t.Fatal("the binary payload should be smaller:", len(b), len(j))
+	}
+
+	// the Text serialize still uses json
+	b, err = p.Encode("tick", tick, "1", conf.TransportSerializeText, conf.TransportCompressNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, err = p.Decode(b, conf.TransportSerializeText, conf.TransportCompressNone); err != nil || len(msg.Data) != 0 || msg.Args == "" {
+		t.Fatal("unexpected text message:", msg, err)
+	}
+}
+
+func TestProtobufPayloadHandler(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	a.On("tick", func(c gosocket.ClientFace, tick *timestamppb.Timestamp, id string) {
+		tick.Seconds++
+		c.Emit("tick", tick, id)
+	})
+
+	server, client := net.Pipe()
+	tcpsocket.Serve(context.Background(), server, a, new(tcpsocket.Client), tcpsocket.WithNegotiation(time.Second))
+	i := gosocket.NewInitiator()
+	ticks := make(chan *timestamppb.Timestamp, 2)
+	i.On("tick", func(c gosocket.ConnFace, tick *timestamppb.Timestamp) {
+		ticks <- tick
+	})
+	conn := new(tcpsocket.Conn)
+	conn.SetCodec(protocol.Codec{Serialize: conf.TransportSerializeProtobuf, Compress: conf.TransportCompressSnappy})
+	tcpsocket.Receive(i, client, conn)
+	i.SetConn(conn)
+	defer conn.Close()
+
+	// the reply of EmitSync is the binary data
+	reply, err := i.EmitSync("tick", timestamppb.New(time.Unix(100, 5)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tick := new(timestamppb.Timestamp)
+	if err = proto.Unmarshal(reply.([]byte), tick); err != nil || tick.Seconds != 101 || tick.Nanos != 5 {
+		t.Fatal("unexpected reply:", tick, err)
+	}
+
+	// the empty message has no data
+	i.Emit("tick", new(timestamppb.Timestamp), "")
+	select {
+	case tick = <-ticks:
+		if tick == nil || tick.Seconds != 1 || tick.Nanos != 0 {
+			t.Fatal("unexpected tick:", tick)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("tick not received")
+	}
+}
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/tcpsocket"
+)
+
+func TestBackoff(t *testing.T) {
+	b := gosocket.Backoff{Min: 100 * time.Millisecond, Max: time.Second, Factor: 2}
+	for attempt, want := range []time.Duration{100, 100, 200, 400, 800, 1000, 1000} {
+		if d := b.Duration(attempt); d != want*time.Millisecond {
+			t.Fatal("unexpected backoff:", attempt, d)
+		}
+	}
+	b.Jitter = 0.5
+	for n := 0; n < 100; n++ {
+		if d := b.Duration(3); d < 200*time.Millisecond || d > 600*time.Millisecond {
+			t.Fatal("unexpected jitter:", d)
+		}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	a := gosocket.NewAcceptor()
+	a.On("join", func(c gosocket.ClientFace, room string) {
+		c.Join(room)
+		c.Emit("joined", room, "")
+	})
+	a.On("hello", func(c gosocket.ClientFace, args string) {
+		c.Emit("hello", args, "")
+	})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			tcpsocket.Serve(context.Background(), conn, a, new(tcpsocket.Client))
+		}
+	}()
+
+	events := make(chan string, 16)
+	i := gosocket.NewInitiator()
+	i.SetOfflineBuffer(10)
+	i.On(gosocket.OnConnection, func(c gosocket.ConnFace) {
+		events <- "connection"
+	})
+	i.On(gosocket.OnDisconnection, func(c gosocket.ConnFace) {
+		// emitted while disconnected, sent after reconnected
+		i.Emit("hello", "again", "")
+		events <- "disconnection"
+	})
+	i.On("joined", func(c gosocket.ConnFace, room string) {
+		events <- "joined " + room
+	})
+	i.On("hello", func(c gosocket.ConnFace, args string) {
+		events <- "hello " + args
+	})
+	i.Subscribe("join", "EURUSD")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dial := tcpsocket.Dialer("tcp", l.Addr().String(), func() tcpsocket.ConnFace {
+		return new(tcpsocket.Conn)
+	})
+	go i.Reconnect(ctx, dial, gosocket.Backoff{Min: 50 * time.Millisecond, Max: time.Second, Factor: 2})
+
+	expect := func(want ...string) {
+		got := make(map[string]bool)
+		for range want {
+			select {
+			case event := <-events:
+				got[event] = true
+			case <-time.After(2 * time.Second):
+				t.Fatal("events not received:", want, got)
+			}
+		}
+		for _, event := range want {
+			if !got[event] {
+				t.Fatal("event not received:", event, got)
+			}
+		}
+	}
+	expect("connection", "joined EURUSD")
+
+	// the server closes the connection
+	for _, c := range a.Clients() {
+		c.(*tcpsocket.Client).Close()
+	}
+	expect("disconnection", "connection", "joined EURUSD", "hello again")
+	if clients := a.ClientsByRoom("EURUSD"); len(clients) != 1 {
+		t.Fatal("the room join should be replayed after reconnected:", len(clients))
+	}
+}
+
+func TestReconnectClosedImmediately(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// the server closes the connection immediately after accepted, maybe before the initiator set it
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	i := gosocket.NewInitiator()
+	dialer := tcpsocket.Dialer("tcp", l.Addr().String(), func() tcpsocket.ConnFace {
+		return new(tcpsocket.Conn)
+	})
+	dials := make(chan struct{}, 64)
+	dial := func(ctx context.Context, i *gosocket.Initiator) (gosocket.ConnFace, error) {
+		c, err := dialer(ctx, i)
+		if err == nil {
+			// let the connection be closed before it is returned
+			time.Sleep(20 * time.Millisecond)
+			dials <- struct{}{}
+		}
+		return c, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		i.Reconnect(ctx, dial, gosocket.Backoff{Min: 10 * time.Millisecond, Max: 10 * time.Millisecond, Factor: 1})
+		close(done)
+	}()
+
+	// Reconnect is not blocked by the connection closed before it was set
+	for n := 0; n < 3; n++ {
+		select {
+		case <-dials:
+		case <-time.After(2 * time.Second):
+			t.Fatal("reconnect blocked after the connection was closed immediately:", n)
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("reconnect not returned after the ctx was done")
+	}
+	if i.Alive() {
+		t.Fatal("the initiator should not be alive")
+	}
+}
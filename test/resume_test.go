@@ -0,0 +1,204 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/tcpsocket"
+)
+
+func resumeServer(t *testing.T, grace time.Duration) (a *gosocket.Acceptor, dial gosocket.DialFunc) {
+	a, addr := resumeListen(t, grace)
+	dial = tcpsocket.Dialer("tcp", addr, func() tcpsocket.ConnFace {
+		return new(tcpsocket.Conn)
+	})
+	return
+}
+
+// resumeListen serve the acceptor which resumes the sessions, return the address listened
+func resumeListen(t *testing.T, grace time.Duration, opts ...tcpsocket.Option) (a *gosocket.Acceptor, addr string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	a = gosocket.NewAcceptor()
+	a.SetResume(gosocket.Resume{Grace: grace, BufferSize: 10})
+	a.On("join", func(c gosocket.ClientFace, room string, id string) {
+		c.Join(room)
+		c.Emit("join", room, id)
+	})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			tcpsocket.Serve(context.Background(), conn, a, new(tcpsocket.Client), opts...)
+		}
+	}()
+	return a, l.Addr().String()
+}
+
+// connect and wait until the resume token was issued
+func resumeConnect(t *testing.T, i *gosocket.Initiator, dial gosocket.DialFunc) gosocket.ConnFace {
+	c, err := dial(context.Background(), i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.SetConn(c)
+	deadline := time.Now().Add(2 * time.Second)
+	for i.Session() == nil || i.Session().Id != c.Id() {
+		if time.Now().After(deadline) {
+			t.Fatal("resume token not received")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return c
+}
+
+func closeClients(a *gosocket.Acceptor) {
+	for _, c := range a.Clients() {
+		c.(*tcpsocket.Client).Close()
+	}
+	// wait for the server to suspend the session
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestResume(t *testing.T) {
+	a, dial := resumeServer(t, time.Second)
+	disconnected := make(chan string, 1)
+	resumed := make(chan string, 1)
+	a.On(gosocket.OnDisconnection, func(c gosocket.ClientFace) {
+		disconnected <- c.Id()
+	})
+	a.On(gosocket.OnResume, func(c gosocket.ClientFace) {
+		resumed <- c.Id()
+	})
+
+	news := make(chan string, 10)
+	i := gosocket.NewInitiator()
+	i.On("news", func(c gosocket.ConnFace, args string) {
+		news <- args
+	})
+	c := resumeConnect(t, i, dial)
+	id := c.Id()
+	if _, err := i.EmitSync("join", "EURUSD", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	closeClients(a)
+	// sent while the client was away
+	a.BroadcastTo("EURUSD", "news", "1.0842", "")
+
+	c = resumeConnect(t, i, dial)
+	if c.Id() != id {
+		t.Fatal("the previous socket id should be resumed:", id, c.Id())
+	}
+	select {
+	case rid := <-resumed:
+		if rid != id {
+			t.Fatal("unexpected resumed id:", rid)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnResume not triggered")
+	}
+	select {
+	case args := <-news:
+		if args != "1.0842" {
+			t.Fatal("unexpected message:", args)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the buffered message not replayed")
+	}
+	// the rooms were restored
+	a.BroadcastTo("EURUSD", "news", "1.0843", "")
+	select {
+	case args := <-news:
+		if args != "1.0843" {
+			t.Fatal("unexpected message:", args)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the room not restored")
+	}
+	if clients := a.Clients(); len(clients) != 1 {
+		t.Fatal("the previous client should be replaced:", len(clients))
+	}
+	select {
+	case id := <-disconnected:
+		t.Fatal("OnDisconnection should not be triggered after resumed:", id)
+	default:
+	}
+}
+
+func TestResumeExpired(t *testing.T) {
+	a, dial := resumeServer(t, 200*time.Millisecond)
+	disconnected := make(chan string, 1)
+	a.On(gosocket.OnDisconnection, func(c gosocket.ClientFace) {
+		disconnected <- c.Id()
+	})
+
+	i := gosocket.NewInitiator()
+	c := resumeConnect(t, i, dial)
+	id := c.Id()
+	closeClients(a)
+	select {
+	case <-disconnected:
+		t.Fatal("OnDisconnection should be deferred until the grace window expired")
+	default:
+	}
+	select {
+	case did := <-disconnected:
+		if did != id {
+			t.Fatal("unexpected disconnected id:", did)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnection not triggered after the grace window")
+	}
+
+	// the session can not be resumed any more
+	c = resumeConnect(t, i, dial)
+	if c.Id() == id {
+		t.Fatal("the expired session should not be resumed")
+	}
+	if len(a.ClientsByRoom("EURUSD")) != 0 || len(a.Clients()) != 1 {
+		t.Fatal("the expired client should be removed")
+	}
+}
+
+func TestResumeMismatched(t *testing.T) {
+	a, addr := resumeListen(t, time.Second, tcpsocket.WithNegotiation(time.Second), tcpsocket.WithAuthenticator(func(msg *protocol.Message) (*gosocket.Identity, error) {
+		var user string
+		err := json.Unmarshal([]byte(msg.Args), &user)
+		return &gosocket.Identity{UserId: user}, err
+	}, time.Second))
+	dial := func(user, compress string) gosocket.DialFunc {
+		return tcpsocket.Dialer("tcp", addr, func() tcpsocket.ConnFace {
+			conn := new(tcpsocket.Conn)
+			conn.SetCodec(protocol.Codec{Serialize: conf.TransportSerializeText, Compress: compress})
+			return conn
+		}, tcpsocket.WithAuthPayload(user))
+	}
+
+	for _, tc := range []struct {
+		user, compress string
+		resumed        bool
+	}{
+		{"alice", conf.TransportCompressNone, true},
+		{"bob", conf.TransportCompressNone, false},
+		{"alice", conf.TransportCompressSnappy, false},
+	} {
+		i := gosocket.NewInitiator()
+		id := resumeConnect(t, i, dial("alice", conf.TransportCompressNone)).Id()
+		closeClients(a)
+		if c := resumeConnect(t, i, dial(tc.user, tc.compress)); (c.Id() == id) != tc.resumed {
+			t.Fatal("unexpected resume result:", tc.user, tc.compress, id, c.Id())
+		}
+	}
+}
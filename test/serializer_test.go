@@ -0,0 +1,155 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/tcpsocket"
+)
+
+// jsonObjectSerializer serialize the message as {"event":"$event","args":$args,"id":"$id"}
+type jsonObjectSerializer struct{}
+
+type jsonObject struct {
+	Event string          `json:"event"`
+	Args  json.RawMessage `json:"args,omitempty"`
+	Id    string          `json:"id,omitempty"`
+}
+
+func (s jsonObjectSerializer) Marshal(event string, args interface{}, id string) ([]byte, error) {
+	b, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonObject{event, b, id})
+}
+
+func (s jsonObjectSerializer) Unmarshal(data []byte, msg *protocol.Message) error {
+	var o jsonObject
+	if err := json.Unmarshal(data, &o); err != nil {
+		return err
+	}
+	msg.Event, msg.Args, msg.Id = o.Event, string(o.Args), o.Id
+	return nil
+}
+
+func TestSerializers(t *testing.T) {
+	p := new(protocol.Protocol)
+	p.SetProtocol(nil)
+	args := Args{ArgsCommon: ArgsCommon{Server: 1, Token: "token"}, Symbol: "EURUSD", Period: "M1", From: -1, To: 1 << 40, Count: 3}
+	for _, serialize := range []string{conf.TransportSerializeMsgPack, conf.TransportSerializeCBOR, conf.TransportSerializeProtobuf, conf.TransportSerializeText} {
+		for _, compress := range []string{conf.TransportCompressNone, conf.TransportCompressGzip} {
+			b, err := p.Encode("quote", args, "id-1", serialize, compress)
+			if err != nil {
+				t.Fatal(serialize, compress, err)
+			}
+			msg, err := p.Decode(b, serialize, compress)
+			if err != nil {
+				t.Fatal(serialize, compress, err)
+			}
+			var decoded Args
+			if err = json.Unmarshal([]byte(msg.Args), &decoded); err != nil {
+				t.Fatal(serialize, compress, msg.Args, err)
+			}
+			if msg.Event != "quote" || msg.Id != "id-1" || !reflect.DeepEqual(decoded, args) {
+				t.Fatal("unexpected message:", serialize, compress, msg, decoded)
+			}
+		}
+		// without args and id
+		b, err := p.Encode("ping", nil, "", serialize, conf.TransportCompressNone)
+		if err != nil {
+			t.Fatal(serialize, err)
+		}
+		if msg, err := p.Decode(b, serialize, conf.TransportCompressNone); err != nil || msg.Event != "ping" || msg.Args != "" || msg.Id != "" {
+			t.Fatal("unexpected message:", serialize, msg, err)
+		}
+	}
+	// the malformed message
+	for _, serialize := range []string{conf.TransportSerializeMsgPack, conf.TransportSerializeCBOR} {
+		if _, err := p.Decode([]byte{0x01, 0x02}, serialize, conf.TransportCompressNone); err == nil {
+			t.Fatal("the malformed message should not be decoded:", serialize)
+		}
+	}
+}
+
+func TestSerializersRawArgs(t *testing.T) {
+	p := new(protocol.Protocol)
+	p.SetProtocol(nil)
+	// the args marshalled into json already, e.g. relayed by the adapter
+	args := json.RawMessage(`{"symbol":"EURUSD","bid":1.5,"count":3,"ticks":[1,2]}`)
+	text, err := p.Encode("quote", args, "1", conf.TransportSerializeText, conf.TransportCompressNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, serialize := range []string{conf.TransportSerializeMsgPack, conf.TransportSerializeCBOR} {
+		b, err := p.Encode("quote", args, "1", serialize, conf.TransportCompressNone)
+		if err != nil {
+			t.Fatal(serialize, err)
+		}
+		// encoded natively rather than as the json bytes
+		if len(b) >= len(text) {
+			t.Fatal("the args should be encoded natively:", serialize, len(b), len(text))
+		}
+		msg, err := p.Decode(b, serialize, conf.TransportCompressNone)
+		if err != nil {
+			t.Fatal(serialize, err)
+		}
+		var decoded, expected map[string]interface{}
+		json.Unmarshal(args, &expected)
+		if err = json.Unmarshal([]byte(msg.Args), &decoded); err != nil || !reflect.DeepEqual(decoded, expected) {
+			t.Fatal("unexpected args:", serialize, msg.Args, err)
+		}
+	}
+}
+
+func TestRegisterSerializer(t *testing.T) {
+	// registered while the connections of the other tests are served
+	protocol.RegisterSerializer("JSONObject", new(jsonObjectSerializer))
+	codec, err := protocol.ParseCodec("jsonobject.snappy")
+	if err != nil || codec.Serialize != "JSONObject" {
+		t.Fatal("unexpected codec:", codec, err)
+	}
+
+	// selected in the config
+	if v := conf.SelectSerialize("JSONObject"); v != "JSONObject" {
+		t.Fatal("the registered serialize should be selected:", v)
+	}
+	if v := conf.SelectSerialize("Unregistered"); v != conf.TransportSerializeText {
+		t.Fatal("the unregistered serialize should fall back to Text:", v)
+	}
+
+	p := new(protocol.Protocol)
+	p.SetProtocol(nil)
+	b, err := p.Encode("quote", map[string]int{"bid": 1}, "1", "JSONObject", conf.TransportCompressNone)
+	if err != nil || string(b) != `{"event":"quote","args":{"bid":1},"id":"1"}` {
+		t.Fatal("unexpected message:", string(b), err)
+	}
+}
+
+func TestSerializerNegotiation(t *testing.T) {
+	a := echoAcceptor()
+	for _, codec := range []protocol.Codec{
+		{Serialize: conf.TransportSerializeMsgPack, Compress: conf.TransportCompressNone},
+		{Serialize: conf.TransportSerializeCBOR, Compress: conf.TransportCompressSnappy},
+	} {
+		server, client := net.Pipe()
+		tcpsocket.Serve(context.Background(), server, a, new(tcpsocket.Client), tcpsocket.WithNegotiation(time.Second))
+		i := gosocket.NewInitiator()
+		conn := new(tcpsocket.Conn)
+		conn.SetCodec(codec)
+		tcpsocket.Receive(i, client, conn)
+		i.SetConn(conn)
+		reply, err := i.EmitSync("echo", "hi", "")
+		if err != nil || reply != "hi "+codec.String() {
+			t.Fatal("unexpected reply:", reply, err)
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,204 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/tcpsocket"
+	"github.com/plhwin/gosocket/websocket"
+)
+
+// connect an initiator which counts the quotes and records the going away event
+func shutdownInitiator(t *testing.T, dial func(i *gosocket.Initiator)) (quotes *int64, goingAway chan string) {
+	quotes = new(int64)
+	goingAway = make(chan string, 1)
+	connected := make(chan bool, 1)
+	i := gosocket.NewInitiator()
+	i.On(gosocket.OnConnection, func(c gosocket.ConnFace) {
+		connected <- true
+	})
+	i.On("quote", func(c gosocket.ConnFace, args int) {
+		atomic.AddInt64(quotes, 1)
+	})
+	i.On(gosocket.EventGoingAway, func(c gosocket.ConnFace, args string) {
+		goingAway <- args
+	})
+	dial(i)
+	select {
+	case <-connected:
+	case <-time.After(time.Second):
+		t.Fatal("not connected")
+	}
+	return
+}
+
+func testShutdown(t *testing.T, a *gosocket.Acceptor, quotes *int64, goingAway chan string) {
+	var disconnected int64
+	a.On(gosocket.OnDisconnection, func(c gosocket.ClientFace) {
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt64(&disconnected, 1)
+	})
+	a.SetGoingAway(gosocket.EventGoingAway, "bye")
+	for n := 0; n < 100; n++ {
+		a.BroadcastToAll("quote", n, "")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := a.Shutdown(ctx); err != nil {
+		t.Fatal("shutdown error:", err)
+	}
+	if atomic.LoadInt64(&disconnected) != 1 {
+		t.Fatal("the OnDisconnection handler should return before shutdown completed")
+	}
+	if len(a.Clients()) != 0 {
+		t.Fatal("the clients should leave after shutdown")
+	}
+	if args := <-goingAway; args != "bye" {
+		t.Fatal("unexpected going away args:", args)
+	}
+	// the handlers of the initiator are called concurrently
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt64(quotes); n != 100 {
+		t.Fatal("the queued messages should be flushed before closed:", n)
+	}
+}
+
+func TestTCPShutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	a := gosocket.NewAcceptor()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			tcpsocket.Serve(context.Background(), conn, a, new(tcpsocket.Client))
+		}
+	}()
+
+	quotes, goingAway := shutdownInitiator(t, func(i *gosocket.Initiator) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tcpsocket.Receive(i, conn, new(tcpsocket.Conn))
+	})
+	testShutdown(t, a, quotes, goingAway)
+
+	// the new client is rejected after shutdown
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("the new client should be rejected", n)
+	}
+}
+
+func TestWebsocketShutdown(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		websocket.Serve(context.Background(), a, w, r, new(websocket.Client))
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	quotes, goingAway := shutdownInitiator(t, func(i *gosocket.Initiator) {
+		conn, _, err := websocket.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		websocket.Receive(i, conn, new(websocket.Conn))
+	})
+	testShutdown(t, a, quotes, goingAway)
+
+	if _, resp, err := websocket.Dial(url, nil); err == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatal("the new client should be rejected:", err)
+	}
+}
+
+func TestShutdownLateJoin(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	var joined, left int64
+	start := make(chan struct{})
+	done := make(chan struct{})
+	for n := 0; n < 50; n++ {
+		go func() {
+			c := new(gosocket.Client)
+			c.SetRemoteAddr(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 10000 + n})
+			c.Init(context.Background(), a)
+			<-start
+			if !a.TryJoin(c) {
+				return
+			}
+			atomic.AddInt64(&joined, 1)
+			// the transport leaves after the client was drained
+			go func() {
+				select {
+				case <-c.Draining():
+				case <-done:
+					return
+				}
+				atomic.AddInt64(&left, 1)
+				a.Leave(c)
+			}()
+		}()
+	}
+	close(start)
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := a.Shutdown(ctx); err != nil {
+		t.Fatal("the late joined clients were not drained:", err, atomic.LoadInt64(&joined), atomic.LoadInt64(&left))
+	}
+	if joined, left := atomic.LoadInt64(&joined), atomic.LoadInt64(&left); joined != left {
+		t.Fatal("shutdown completed before all the clients left:", joined, left)
+	}
+	if a.TryJoin(new(gosocket.Client)) {
+		t.Fatal("the client joined after shutdown")
+	}
+}
+
+// foreignClient implements gosocket.ClientFace without embedding gosocket.Client
+type foreignClient struct {
+	gosocket.ClientFace
+}
+
+func TestShutdownForeignClient(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	b := new(gosocket.Client)
+	b.SetRemoteAddr(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 10000})
+	b.Init(context.Background(), a)
+	c := foreignClient{b}
+	if _, ok := gosocket.ClientFace(c).(gosocket.AckEmitter); ok {
+		t.Fatal("the foreign client should not support the acks")
+	}
+	if !a.TryJoin(c) {
+		t.Fatal("the foreign client was not joined")
+	}
+	// the foreign client can not be drained, its connection is closed
+	go func() {
+		<-c.Context().Done()
+		a.Leave(c)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := a.Shutdown(ctx); err != nil {
+		t.Fatal("the foreign client was not closed:", err)
+	}
+}
@@ -0,0 +1,342 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/socketio"
+)
+
+// socketIOClient the raw Engine.IO client, which skips the messages not expected
+type socketIOClient struct {
+	t    *testing.T
+	conn *gorilla.Conn
+}
+
+func dialSocketIO(t *testing.T, url string) *socketIOClient {
+	conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/socket.io/?EIO=4&transport=websocket", nil)
+	if err != nil {
+		t.Fatal("dial error:", err)
+	}
+	return &socketIOClient{t: t, conn: conn}
+}
+
+func (c *socketIOClient) send(messageType int, data string) {
+	if err := c.conn.WriteMessage(messageType, []byte(data)); err != nil {
+		c.t.Fatal("write error:", err)
+	}
+}
+
+// expect read the messages until the one with the prefix
+func (c *socketIOClient) expect(prefix string) string {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.t.Fatal("no message of the prefix:", prefix, err)
+		}
+		if strings.HasPrefix(string(data), prefix) {
+			return string(data)
+		}
+	}
+}
+
+func TestSocketIO(t *testing.T) {
+	a := socketio.NewAcceptor()
+	a.On("echo", func(c gosocket.ClientFace, args string, id string) {
+		c.Emit("echo", args+" "+c.(*socketio.Client).Namespace(), id)
+	})
+	a.On("file", func(c gosocket.ClientFace, data []byte) {
+		c.Emit("file", socketio.Binary(append(data, '!')), "")
+	})
+	a.On("ask", func(c gosocket.ClientFace, question string) {
+		go func() {
+			ack := <-c.(gosocket.AckEmitter).EmitWithAck("question", question, time.Second)
+			c.Emit("answer", ack.Result, "")
+		}()
+	})
+	auths := make(chan string, 1)
+	admin := socketio.NewAcceptor()
+	admin.On("echo", func(c gosocket.ClientFace, args string, id string) {
+		c.Emit("echo", args+" "+c.(*socketio.Client).Namespace(), id)
+	})
+	admin.On(gosocket.OnConnection, func(c gosocket.ClientFace) {
+		auths <- string(c.(*socketio.Client).Auth())
+	})
+	disconnected := make(chan string, 1)
+	admin.On(gosocket.OnDisconnection, func(c gosocket.ClientFace) {
+		disconnected <- c.Id()
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		socketio.Serve(context.Background(), a, w, r, socketio.WithNamespace("/admin", admin))
+	}))
+	defer server.Close()
+
+	c := dialSocketIO(t, server.URL)
+	defer c.conn.Close()
+	var open struct {
+		Sid          string `json:"sid"`
+		PingInterval int    `json:"pingInterval"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(c.expect("0"), "0")), &open); err != nil || open.Sid == "" || open.PingInterval <= 0 {
+		t.Fatal("unexpected open packet:", open, err)
+	}
+
+	// the main namespace
+	c.send(gorilla.TextMessage, "40")
+	if connected := c.expect("40"); !strings.HasPrefix(connected, `40{"sid":"`) {
+		t.Fatal("unexpected connect packet:", connected)
+	}
+	c.send(gorilla.TextMessage, `421["echo","hi"]`)
+	if ack := c.expect("43"); ack != `431["hi /"]` {
+		t.Fatal("unexpected ack packet:", ack)
+	}
+
+	// the binary attachments
+	c.send(gorilla.TextMessage, `451-["file",{"_placeholder":true,"num":0}]`)
+	c.send(gorilla.BinaryMessage, "\x00\x01")
+	if event := c.expect("45"); event != `451-["file",{"_placeholder":true,"num":0}]` {
+		t.Fatal("unexpected binary event packet:", event)
+	}
+	if messageType, data, err := c.conn.ReadMessage(); err != nil || messageType != gorilla.BinaryMessage || !bytes.Equal(data, []byte("\x00\x01!")) {
+		t.Fatal("unexpected attachment:", messageType, data, err)
+	}
+
+	// the server emits with ack
+	c.send(gorilla.TextMessage, `42["ask","why"]`)
+	if question := c.expect(`42`); !strings.HasPrefix(question, `42`) || !strings.HasSuffix(question, `["question","why"]`) {
+		t.Fatal("unexpected question:", question)
+	} else {
+		id := strings.TrimSuffix(strings.TrimPrefix(question, "42"), `["question","why"]`)
+		c.send(gorilla.TextMessage, "43"+id+`["because"]`)
+	}
+	if answer := c.expect(`42["answer"`); answer != `42["answer","because"]` {
+		t.Fatal("unexpected answer:", answer)
+	}
+
+	// the other namespaces
+	c.send(gorilla.TextMessage, `40/nope,`)
+	c.expect(`44/nope,{"message":`)
+	c.send(gorilla.TextMessage, `40/admin,{"token":"abc"}`)
+	c.expect(`40/admin,{"sid":"`)
+	if auth := <-auths; auth != `{"token":"abc"}` {
+		t.Fatal("unexpected auth:", auth)
+	}
+	c.send(gorilla.TextMessage, `42/admin,7["echo","hi"]`)
+	if ack := c.expect("43"); ack != `43/admin,7["hi /admin"]` {
+		t.Fatal("unexpected ack packet:", ack)
+	}
+
+	// the ping of the client is replied with the same payload
+	c.send(gorilla.TextMessage, "2probe")
+	c.expect("3probe")
+
+	// disconnect from the namespace, the main namespace is still connected
+	c.send(gorilla.TextMessage, "41/admin,")
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("the client was not disconnected from the namespace")
+	}
+	c.send(gorilla.TextMessage, `422["echo","again"]`)
+	if ack := c.expect("43"); ack != `432["again /"]` {
+		t.Fatal("unexpected ack packet:", ack)
+	}
+}
+
+// expectClosed read until the connection is closed by the server
+func (c *socketIOClient) expectClosed() {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+				c.t.Fatal("the connection was not closed")
+			}
+			return
+		}
+	}
+}
+
+func TestSocketIOAttachmentLimits(t *testing.T) {
+	a := socketio.NewAcceptor()
+	files := make(chan int, 1)
+	a.On("file", func(c gosocket.ClientFace, data []byte) {
+		files <- len(data)
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		socketio.Serve(context.Background(), a, w, r)
+	}))
+	defer server.Close()
+
+	// too many attachments
+	c := dialSocketIO(t, server.URL)
+	defer c.conn.Close()
+	c.send(gorilla.TextMessage, "40")
+	c.expect("40")
+	c.send(gorilla.TextMessage, `4511-["file",{"_placeholder":true,"num":0}]`)
+	c.expectClosed()
+
+	// the attachments are larger than the max message size in total
+	c = dialSocketIO(t, server.URL)
+	defer c.conn.Close()
+	c.send(gorilla.TextMessage, "40")
+	c.expect("40")
+	c.send(gorilla.TextMessage, `453-["file",{"_placeholder":true,"num":0},{"_placeholder":true,"num":1},{"_placeholder":true,"num":2}]`)
+	chunk := strings.Repeat("x", conf.Acceptor.Transport.MaxMessageSize/2)
+	for n := 0; n < 3; n++ {
+		if c.conn.WriteMessage(gorilla.BinaryMessage, []byte(chunk)) != nil {
+			break
+		}
+	}
+	c.expectClosed()
+	select {
+	case <-files:
+		t.Fatal("the oversized packet was dispatched")
+	default:
+	}
+	if n := a.Oversized(); n != 2 {
+		t.Fatal("unexpected oversized count:", n)
+	}
+
+	// the attachments within the limits
+	c = dialSocketIO(t, server.URL)
+	defer c.conn.Close()
+	c.send(gorilla.TextMessage, "40")
+	c.expect("40")
+	c.send(gorilla.TextMessage, `451-["file",{"_placeholder":true,"num":0}]`)
+	c.send(gorilla.BinaryMessage, chunk)
+	select {
+	case n := <-files:
+		if n != len(chunk) {
+			t.Fatal("unexpected attachment size:", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the packet within the limits was not dispatched")
+	}
+}
+
+func TestSocketIOHandshake(t *testing.T) {
+	a := socketio.NewAcceptor()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		socketio.Serve(context.Background(), a, w, r)
+	}))
+	defer server.Close()
+
+	for query, code := range map[string]float64{"EIO=3&transport=websocket": 5, "EIO=4&transport=flash": 0, "EIO=4&transport=websocket&sid=abc": 1, "EIO=4&transport=polling&sid=abc": 1} {
+		resp, err := http.Get(server.URL + "/socket.io/?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var e map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&e)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || e["code"] != code {
+			t.Fatal("unexpected handshake response:", query, resp.StatusCode, e)
+		}
+	}
+}
+
+func TestSocketIOPolling(t *testing.T) {
+	a := socketio.NewAcceptor()
+	a.On("echo", func(c gosocket.ClientFace, args string, id string) {
+		c.Emit("echo", args+" "+c.(*socketio.Client).Namespace(), id)
+	})
+	a.On("file", func(c gosocket.ClientFace, data []byte) {
+		c.Emit("file", socketio.Binary(append(data, '!')), "")
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		socketio.Serve(context.Background(), a, w, r)
+	}))
+	defer server.Close()
+
+	// the handshake
+	resp, err := http.Get(server.URL + "/socket.io/?EIO=4&transport=polling")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	resp.Body.Close()
+	var open struct {
+		Sid      string   `json:"sid"`
+		Upgrades []string `json:"upgrades"`
+	}
+	if err = json.Unmarshal(bytes.TrimPrefix(buf.Bytes(), []byte("0")), &open); err != nil || open.Sid == "" || len(open.Upgrades) != 1 || open.Upgrades[0] != "websocket" {
+		t.Fatal("unexpected open packet:", buf.String(), err)
+	}
+	url := server.URL + "/socket.io/?EIO=4&transport=polling&sid=" + open.Sid
+	post := func(payload string) {
+		resp, err := http.Post(url, "text/plain;charset=UTF-8", strings.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || buf.String() != "ok" {
+			t.Fatal("unexpected post response:", resp.StatusCode, buf.String())
+		}
+	}
+	poll := func() string {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		resp.Body.Close()
+		return buf.String()
+	}
+
+	post("40")
+	if connected := poll(); !strings.HasPrefix(connected, `40{"sid":"`) {
+		t.Fatal("unexpected connect packet:", connected)
+	}
+	post(`421["echo","hi"]`)
+	if ack := poll(); ack != `431["hi /"]` {
+		t.Fatal("unexpected ack packet:", ack)
+	}
+	// the binary attachment is encoded as "b" + base64
+	post("451-[\"file\",{\"_placeholder\":true,\"num\":0}]\x1ebAAE=")
+	if event := poll(); event != "451-[\"file\",{\"_placeholder\":true,\"num\":0}]\x1ebAAEh" {
+		t.Fatal("unexpected binary event packet:", event)
+	}
+
+	// the upgrade to websocket
+	polled := make(chan string, 1)
+	go func() { polled <- poll() }()
+	conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/socket.io/?EIO=4&transport=websocket&sid="+open.Sid, nil)
+	if err != nil {
+		t.Fatal("dial error:", err)
+	}
+	defer conn.Close()
+	c := &socketIOClient{t: t, conn: conn}
+	c.send(gorilla.TextMessage, "2probe")
+	if probe := c.expect("3"); probe != "3probe" {
+		t.Fatal("unexpected probe packet:", probe)
+	}
+	select {
+	case noop := <-polled:
+		if noop != "6" {
+			t.Fatal("unexpected noop packet:", noop)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the poll request was not released")
+	}
+	c.send(gorilla.TextMessage, "5")
+	c.send(gorilla.TextMessage, `422["echo","ws"]`)
+	if ack := c.expect("43"); ack != `432["ws /"]` {
+		t.Fatal("unexpected ack packet:", ack)
+	}
+}
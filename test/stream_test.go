@@ -0,0 +1,127 @@
+package test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/tcpsocket"
+	"github.com/plhwin/gosocket/util"
+	"github.com/plhwin/gosocket/websocket"
+)
+
+func TestCompressStream(t *testing.T) {
+	for _, compress := range []string{conf.TransportCompressFLate, conf.TransportCompressZstd} {
+		codec := protocol.Codec{Serialize: conf.TransportSerializeText, Compress: compress, Stream: true}
+		zip, err := protocol.NewZipStream(codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unzip, err := protocol.NewUnzipStream(codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var streamed, standalone int
+		for n := 0; n < 100; n++ {
+			quote := []byte(fmt.Sprintf(`["quote",{"symbol":"EURUSD","bid":1.08%02d,"ask":1.08%02d,"time":17000000%02d}]`, n, n+2, n))
+			msg, err := zip.Zip(quote)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := unzip.Unzip(msg)
+			if err != nil || string(data) != string(quote) {
+				t.Fatal("unexpected data:", compress, n, string(data), err)
+			}
+			b, _ := protocol.Compressors[compress].Zip(quote)
+			streamed += len(msg)
+			standalone += len(b)
+		}
+		// the redundancy across the messages is compressed by the stream
+		if streamed*2 > standalone {
+			t.Fatal("the stream should compress better:", compress, streamed, standalone)
+		}
+
+		// the stream is broken by the wrong message
+		if _, err = unzip.Unzip([]byte{10, 1, 2, 3}); err == nil {
+			t.Fatal("the wrong message should be rejected:", compress)
+		}
+		msg, _ := zip.Zip([]byte("[\"ping\"]"))
+		if _, err = unzip.Unzip(msg); err == nil {
+			t.Fatal("the broken stream should be rejected:", compress)
+		}
+
+		// the length of the raw data larger than the max message size
+		unzip, _ = protocol.NewUnzipStream(codec)
+		size := max(conf.Acceptor.Transport.MaxMessageSize, conf.Initiator.Transport.MaxMessageSize)
+		msg = append(binary.AppendUvarint(nil, uint64(size)+1), msg[1:]...)
+		if _, err = unzip.Unzip(msg); err != util.ErrorSizeExceeded {
+			t.Fatal("the length larger than the max message size should be rejected:", compress, err)
+		}
+	}
+
+	codec, err := protocol.ParseCodec("msgpack.zstd.stream")
+	if err != nil || !codec.Stream || codec.String() != "MsgPack.Zstd.stream" {
+		t.Fatal("unexpected codec:", codec, err)
+	}
+	if _, err = protocol.ParseCodec("Text.Snappy.stream"); err != protocol.ErrorUnsupportedCodec {
+		t.Fatal("the codec should be unsupported:", err)
+	}
+}
+
+func TestTCPSocketCompressStream(t *testing.T) {
+	a := echoAcceptor()
+	server, client := net.Pipe()
+	tcpsocket.Serve(context.Background(), server, a, new(tcpsocket.Client), tcpsocket.WithNegotiation(time.Second))
+	i := gosocket.NewInitiator()
+	conn := new(tcpsocket.Conn)
+	conn.SetCodec(protocol.Codec{Serialize: conf.TransportSerializeMsgPack, Compress: conf.TransportCompressZstd, Stream: true})
+	tcpsocket.Receive(i, client, conn)
+	i.SetConn(conn)
+	defer conn.Close()
+
+	for n := 0; n < 10; n++ {
+		args := strings.Repeat("hi", n*100)
+		reply, err := i.EmitSync("echo", args, "")
+		if err != nil || reply != args+" MsgPack.Zstd.stream" {
+			t.Fatal("unexpected reply:", n, reply, err)
+		}
+	}
+}
+
+func TestWebsocketCompressStream(t *testing.T) {
+	a := echoAcceptor()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		websocket.Serve(context.Background(), a, w, r, new(websocket.Client))
+	}))
+	defer server.Close()
+
+	i := gosocket.NewInitiator()
+	dial := websocket.Dialer("ws"+strings.TrimPrefix(server.URL, "http"), nil, func() websocket.ConnFace {
+		c := new(websocket.Conn)
+		c.SetCodec(protocol.Codec{Serialize: conf.TransportSerializeText, Compress: conf.TransportCompressFLate, Stream: true})
+		return c
+	})
+	c, err := dial(context.Background(), i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.SetConn(c)
+	defer c.(*websocket.Conn).Close()
+
+	for n := 0; n < 10; n++ {
+		args := strings.Repeat("hi", n*100)
+		reply, err := i.EmitSync("echo", args, "")
+		if err != nil || reply != args+" Text.FLate.stream" {
+			t.Fatal("unexpected reply:", n, reply, err)
+		}
+	}
+}
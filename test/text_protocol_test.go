@@ -0,0 +1,190 @@
+package test
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/plhwin/gosocket/protocol"
+)
+
+func TestTextProtocolDecode(t *testing.T) {
+	p := new(protocol.DefaultTextProtocol)
+	cases := []struct {
+		text  string
+		event string
+		args  string
+		id    string
+	}{
+		// the messages sent by the existing clients
+		{`["ping"]`, "ping", "", ""},
+		{`["echo","hi"]`, "echo", `"hi"`, ""},
+		{`["echo","hi","1"]`, "echo", `"hi"`, "1"},
+		{`["kline",{"symbol":"EURUSD","count":300},"DtUwOg67X4V6AHHXOPxvYwWwM6we3RWU"]`, "kline", `{"symbol":"EURUSD","count":300}`, "DtUwOg67X4V6AHHXOPxvYwWwM6we3RWU"},
+		{`["pong",1590422400000]`, "pong", "1590422400000", ""},
+		// the escaped quotes, the commas and the brackets in the strings
+		{`["say \"hi\"","a\",\"b","i\"d"]`, `say "hi"`, `"a\",\"b"`, `i"d`},
+		{`["e",{"a":"]\"}","b":[1,"x,y"]},"1"]`, "e", `{"a":"]\"}","b":[1,"x,y"]}`, "1"},
+		{`["eé\n","中文"]`, "eé\n", `"中文"`, ""},
+		// the whitespaces and the explicit null
+		{" [ \"e\" , [ 1 , 2 ] , \"1\" ] \r\n", "e", "[ 1 , 2 ]", "1"},
+		{`["e",null,"1"]`, "e", "", "1"},
+		{`["e",{"a":1},null]`, "e", `{"a":1}`, ""},
+		{`["e",-1.5e+3,"1"]`, "e", "-1.5e+3", "1"},
+		{`["e",true,"1"]`, "e", "true", "1"},
+	}
+	for _, c := range cases {
+		msg := new(protocol.Message)
+		if err := p.Decode([]byte(c.text), msg); err != nil {
+			t.Fatal("decode error:", c.text, err)
+		}
+		if msg.Event != c.event || msg.Args != c.args || msg.Id != c.id {
+			t.Fatalf("unexpected message of %s: %q %q %q", c.text, msg.Event, msg.Args, msg.Id)
+		}
+	}
+
+	for _, text := range []string{``, `[]`, `[""]`, `["e"`, `["e",]`, `["e",1,2]`, `["e",1,"1",2]`, `["e",{"a"}]`, `["e",[1,}]`,
+		`["e",01]`, `["e",tru]`, `["e\"]`, `["e"]x`, `["e",1"1"]`, "[\"e\x01\"]", `[1,"e"]`, `{"e":1}`, `["e\x"]`} {
+		if err := p.Decode([]byte(text), new(protocol.Message)); err == nil {
+			t.Fatal("the wrong message is decoded:", text)
+		}
+	}
+}
+
+func TestTextProtocolEncode(t *testing.T) {
+	p := new(protocol.DefaultTextProtocol)
+	cases := []struct {
+		event, args, id string
+		text            string
+	}{
+		{"ping", "", "", `["ping"]`},
+		{"echo", `"hi"`, "", `["echo","hi"]`},
+		{"echo", `"hi"`, "1", `["echo","hi","1"]`},
+		// the id is never taken as the args
+		{"echo", "", "1", `["echo",null,"1"]`},
+		{"say \"hi\"\n", "1", "i\\d\x01", `["say \"hi\"\n",1,"i\\d\u0001"]`},
+	}
+	for _, c := range cases {
+		text, err := p.Encode(c.event, c.args, c.id)
+		if err != nil || string(text) != c.text {
+			t.Fatal("unexpected text:", string(text), c.text, err)
+		}
+	}
+}
+
+// randomTextString generate the strings of the quotes, the escapes, the delimiters and the unicode
+func randomTextString(r *rand.Rand) string {
+	const chars = "ab\"\\,[]{}: \n\t\x00\x1f/é中😀"
+	runes := []rune(chars)
+	var b strings.Builder
+	for n := r.Intn(8); n > 0; n-- {
+		b.WriteRune(runes[r.Intn(len(runes))])
+	}
+	return b.String()
+}
+
+func randomTextArgs(r *rand.Rand, depth int) interface{} {
+	switch n := r.Intn(7); {
+	case n == 0:
+		return nil
+	case n == 1:
+		return r.Intn(2) == 0
+	case n == 2:
+		return r.NormFloat64() * 1e6
+	case n == 3 || depth > 3:
+		return randomTextString(r)
+	case n == 4:
+		args := make([]interface{}, r.Intn(4))
+		for i := range args {
+			args[i] = randomTextArgs(r, depth+1)
+		}
+		return args
+	default:
+		args := make(map[string]interface{})
+		for i := r.Intn(4); i > 0; i-- {
+			args[randomTextString(r)] = randomTextArgs(r, depth+1)
+		}
+		return args
+	}
+}
+
+func TestTextProtocolProperty(t *testing.T) {
+	var p protocol.Protocol
+	p.SetProtocol(new(protocol.DefaultTextProtocol))
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		event := "e" + randomTextString(r)
+		var id string
+		if r.Intn(2) == 0 {
+			id = randomTextString(r)
+		}
+		args := randomTextArgs(r, 0)
+		text, err := p.Encode(event, args, id, "Text", "None")
+		if err != nil {
+			t.Fatal("encode error:", err)
+		}
+		// the text is the json array which is decoded by encoding/json as well
+		var v []interface{}
+		if err = json.Unmarshal(text, &v); err != nil || v[0] != event {
+			t.Fatal("the text is not the json array:", string(text), err)
+		}
+		msg, err := p.Decode(text, "Text", "None")
+		if err != nil {
+			t.Fatal("decode error:", string(text), err)
+		}
+		if msg.Event != event || msg.Id != id {
+			t.Fatalf("unexpected message of %s: %q %q", text, msg.Event, msg.Id)
+		}
+		want, _ := json.Marshal(args)
+		if args == nil {
+			want = nil
+		}
+		if msg.Args != string(want) {
+			t.Fatalf("unexpected args of %s: %s", text, msg.Args)
+		}
+	}
+}
+
+// FuzzTextProtocolEncoding the decoder must agree with encoding/json, and the message must be encoded back
+func FuzzTextProtocolEncoding(f *testing.F) {
+	for _, seed := range []string{`["ping"]`, `["echo","hi","1"]`, `["e",null,"1"]`, `["e",{"a":"]\"}"},null]`, ` ["e\"",[1,2.5e3,true] ,"é"] `, `["e",01]`} {
+		f.Add([]byte(seed))
+	}
+	p := new(protocol.DefaultTextProtocol)
+	f.Fuzz(func(t *testing.T, text []byte) {
+		msg := new(protocol.Message)
+		err := p.Decode(text, msg)
+
+		var elems []json.RawMessage
+		var event string
+		var id *string
+		valid := json.Unmarshal(text, &elems) == nil && len(elems) > 0 && len(elems) <= 3 &&
+			json.Unmarshal(elems[0], &event) == nil && event != "" && elems[0][0] == '"' &&
+			(len(elems) < 3 || json.Unmarshal(elems[2], &id) == nil)
+		if valid != (err == nil) {
+			t.Fatalf("the decoder disagrees with encoding/json: %q %v", text, err)
+		}
+		if err != nil {
+			return
+		}
+		if msg.Event != event || (id != nil && msg.Id != *id) {
+			t.Fatalf("unexpected message of %q: %q %q", text, msg.Event, msg.Id)
+		}
+		if len(elems) > 1 && string(elems[1]) != "null" && msg.Args != string(elems[1]) {
+			t.Fatalf("unexpected args of %q: %q", text, msg.Args)
+		}
+
+		encoded, err := p.Encode(msg.Event, msg.Args, msg.Id)
+		if err != nil {
+			t.Fatal("encode error:", err)
+		}
+		decoded := new(protocol.Message)
+		if err = p.Decode(encoded, decoded); err != nil {
+			t.Fatalf("the encoded message can not be decoded: %q %v", encoded, err)
+		}
+		if decoded.Event != msg.Event || decoded.Args != msg.Args || decoded.Id != msg.Id {
+			t.Fatalf("unexpected message of %q: %+v", encoded, decoded)
+		}
+	})
+}
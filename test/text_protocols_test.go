@@ -0,0 +1,161 @@
+package test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/tcpsocket"
+)
+
+// upperTextProtocol the text protocol registered by the user, which formats the message as EVENT|args|id
+type upperTextProtocol struct {
+}
+
+func (p upperTextProtocol) Encode(event string, data, id string) ([]byte, error) {
+	return []byte(strings.ToUpper(event) + "|" + data + "|" + id), nil
+}
+
+func (p upperTextProtocol) Decode(text []byte, msg *protocol.Message) error {
+	parts := strings.SplitN(string(text), "|", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return protocol.ErrorWrongMessage
+	}
+	msg.Event, msg.Args, msg.Id = strings.ToLower(parts[0]), parts[1], parts[2]
+	return nil
+}
+
+func TestTextProtocols(t *testing.T) {
+	protocol.RegisterTextProtocol("Upper", upperTextProtocol{})
+	if conf.Acceptor.Transport.TextProtocol != conf.TextProtocolJSONArray {
+		t.Fatal("unexpected default text protocol:", conf.Acceptor.Transport.TextProtocol)
+	}
+	messages := []struct{ Event, Args, Id string }{
+		{Event: "ping"},
+		{Event: "echo", Args: `"hi"`},
+		{Event: "echo", Args: `{"a":[1,"x,y\"]"]}`, Id: "1"},
+		{Event: "echo", Id: "2"},
+		{Event: "say \"hi\":\n", Args: `["中文"]`},
+	}
+	for _, name := range protocol.TextProtocolNames() {
+		p := protocol.GetTextProtocol(name)
+		for _, m := range messages {
+			text, err := p.Encode(m.Event, m.Args, m.Id)
+			if err != nil {
+				t.Fatal("encode error:", name, err)
+			}
+			msg := new(protocol.Message)
+			if err = p.Decode(text, msg); err != nil {
+				t.Fatal("decode error:", name, string(text), err)
+			}
+			if name == conf.TextProtocolSocketIO && m.Id != "" {
+				// the message with id is the ack packet
+				m.Event = protocol.SocketIOAckEvent
+			}
+			if msg.Event != m.Event || msg.Args != m.Args || msg.Id != m.Id {
+				t.Fatalf("unexpected message of %s: %q %+v", name, text, msg)
+			}
+		}
+	}
+}
+
+func TestTextProtocolWireFormats(t *testing.T) {
+	cases := []struct {
+		name            string
+		text            string
+		event, args, id string
+	}{
+		{conf.TextProtocolJSONObject, `{"e":"echo","a":{"b":1},"i":"1"}`, "echo", `{"b":1}`, "1"},
+		{conf.TextProtocolJSONObject, `{"i":null,"a":null,"e":"ping"}`, "ping", "", ""},
+		{conf.TextProtocolSocketIO, `2["ping"]`, "ping", "", ""},
+		{conf.TextProtocolSocketIO, `212["echo","hi"]`, "echo", `"hi"`, "12"},
+		{conf.TextProtocolSocketIO, `2/,3["echo",1,{"a":2}]`, "echo", `[1,{"a":2}]`, "3"},
+		{conf.TextProtocolSocketIO, `37[]`, protocol.SocketIOAckEvent, "", "7"},
+		{conf.TextProtocolSocketIO, `37["ok"]`, protocol.SocketIOAckEvent, `"ok"`, "7"},
+		{conf.TextProtocolSTOMP, "SEND\r\ndestination:echo\r\nid:a\\cb\r\n\r\n\"hi\"\x00\r\n", "echo", `"hi"`, "a:b"},
+		{conf.TextProtocolSTOMP, "MESSAGE\ndestination:echo\ndestination:other\ncontent-length:4\n\n[1]\n\x00", "echo", "[1]\n", ""},
+	}
+	for _, c := range cases {
+		msg := new(protocol.Message)
+		if err := protocol.GetTextProtocol(c.name).Decode([]byte(c.text), msg); err != nil {
+			t.Fatal("decode error:", c.name, c.text, err)
+		}
+		if msg.Event != c.event || msg.Args != c.args || msg.Id != c.id {
+			t.Fatalf("unexpected message of %s %q: %+v", c.name, c.text, msg)
+		}
+	}
+
+	wrong := map[string][]string{
+		conf.TextProtocolJSONObject: {`{"a":1}`, `{"e":1}`, `["e"]`},
+		conf.TextProtocolSocketIO:   {`0`, `42["e"]`, `51-["e",{"_placeholder":true,"num":0}]`, `2/admin,["e"]`, `2[""]`, `2["e"`, `2["e",]`, `29007199254740992["e"]`, `3[1,]`},
+		conf.TextProtocolSTOMP:      {"CONNECT\n\n\x00", "SEND\nid:1\n\n\x00", "SEND\ndestination:e\n\n{\x00", "SEND\ndestination:e\\t\n\n\x00", "SEND\ndestination:e\n\n1", "SEND\ndestination:e\ncontent-length:2\n\n1\x00"},
+	}
+	for name, texts := range wrong {
+		for _, text := range texts {
+			if err := protocol.GetTextProtocol(name).Decode([]byte(text), new(protocol.Message)); err == nil {
+				t.Fatal("the wrong message is decoded:", name, text)
+			}
+		}
+	}
+
+	text, err := protocol.GetTextProtocol(conf.TextProtocolSocketIO).Encode("echo", `"hi"`, "12")
+	if err != nil || string(text) != `312["hi"]` {
+		t.Fatal("unexpected ack packet:", string(text), err)
+	}
+	if _, err = protocol.GetTextProtocol(conf.TextProtocolSocketIO).Encode("echo", `"hi"`, "VsL7ZQOTe60hM"); err != protocol.ErrorSocketIOAckId {
+		t.Fatal("the non-numeric id should be rejected:", err)
+	}
+	text, _ = protocol.GetTextProtocol(conf.TextProtocolSTOMP).Encode("a:b", `"hi"`, "")
+	if string(text) != "MESSAGE\ndestination:a\\cb\ncontent-type:application/json\ncontent-length:4\n\n\"hi\"\x00" {
+		t.Fatalf("unexpected frame: %q", text)
+	}
+}
+
+func TestTextProtocolSelected(t *testing.T) {
+	protocol.RegisterTextProtocol("Upper", upperTextProtocol{})
+	for _, name := range []string{conf.TextProtocolJSONObject, conf.TextProtocolSTOMP, "Upper"} {
+		a := echoAcceptor()
+		a.SetProtocol(protocol.GetTextProtocol(name))
+		i := gosocket.NewInitiator()
+		i.SetProtocol(protocol.GetTextProtocol(name))
+		_, conn := pipe(t, a, i)
+		if reply, err := i.EmitSync("echo", "hi", ""); err != nil || reply != "hi Text.None" {
+			t.Fatal("unexpected reply:", name, reply, err)
+		}
+		conn.Close()
+	}
+}
+
+func TestSocketIOTextProtocolAck(t *testing.T) {
+	a := echoAcceptor()
+	a.SetProtocol(protocol.GetTextProtocol(conf.TextProtocolSocketIO))
+
+	// the Socket.IO client emits the event with the ack id, and receives the ack packet
+	server, client := net.Pipe()
+	defer client.Close()
+	tcpsocket.Serve(context.Background(), server, a, new(tcpsocket.Client), tcpsocket.WithFramer(protocol.NewlineFramer{}))
+	fw := protocol.NewFrameWriter(client)
+	fw.SetFramer(protocol.NewlineFramer{})
+	go fw.WriteFrames([]byte(`212["echo","hi"]`))
+
+	fr := protocol.NewFrameReader(client, 1024)
+	fr.SetFramer(protocol.NewlineFramer{})
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatal("read error:", err)
+		}
+		if strings.HasPrefix(string(frame), "3") {
+			if string(frame) != `312["hi Text.None"]` {
+				t.Fatal("unexpected ack packet:", string(frame))
+			}
+			return
+		}
+	}
+}
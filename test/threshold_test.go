@@ -0,0 +1,81 @@
+package test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+	"github.com/plhwin/gosocket/protocol"
+	"github.com/plhwin/gosocket/tcpsocket"
+)
+
+func TestCompressThreshold(t *testing.T) {
+	p := new(protocol.Protocol)
+	p.SetProtocol(nil)
+	codec, err := protocol.ParseCodec("text.gzip.64")
+	if err != nil || codec.Threshold != 64 || codec.String() != "Text.Gzip.64" || !codec.Binary() {
+		t.Fatal("unexpected codec:", codec, err)
+	}
+
+	// the small message is not compressed
+	b, err := p.EncodeCodec(gosocket.EventPong, int64(1700000000000), "", codec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[0] != protocol.FlagRaw || string(b[1:]) != `["pong",1700000000000]` {
+		t.Fatal("unexpected small message:", b)
+	}
+	msg, err := p.DecodeCodec(b, codec)
+	if err != nil || msg.Event != gosocket.EventPong || msg.Args != "1700000000000" {
+		t.Fatal("unexpected message:", msg, err)
+	}
+
+	// the large message is compressed
+	snapshot := strings.Repeat("EURUSD,1.0842,1.0844;", 100)
+	if b, err = p.EncodeCodec("snapshot", snapshot, "1", codec); err != nil {
+		t.Fatal(err)
+	}
+	if b[0] != protocol.FlagCompressed || len(b) >= len(snapshot) {
+		t.Fatal("unexpected large message:", b[0], len(b))
+	}
+	if msg, err = p.DecodeCodec(b, codec); err != nil || msg.Event != "snapshot" || msg.Args != `"`+snapshot+`"` || msg.Id != "1" {
+		t.Fatal("unexpected message:", msg, err)
+	}
+
+	for _, wrong := range [][]byte{nil, {2, '[', ']'}} {
+		if _, err = p.DecodeCodec(wrong, codec); err != protocol.ErrorWrongFlag {
+			t.Fatal("the wrong flag should be rejected:", wrong, err)
+		}
+	}
+	for _, s := range []string{"Text.Gzip.-1", "Text.Gzip.x"} {
+		if _, err = protocol.ParseCodec(s); err != protocol.ErrorUnsupportedCodec {
+			t.Fatal("the codec should be unsupported:", s, err)
+		}
+	}
+}
+
+func TestCompressThresholdNegotiation(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	a.On("echo", func(c gosocket.ClientFace, args string, id string) {
+		c.Emit("echo", args, id)
+	})
+	server, client := net.Pipe()
+	tcpsocket.Serve(context.Background(), server, a, new(tcpsocket.Client), tcpsocket.WithNegotiation(time.Second))
+	i := gosocket.NewInitiator()
+	conn := new(tcpsocket.Conn)
+	conn.SetCodec(protocol.Codec{Serialize: conf.TransportSerializeMsgPack, Compress: conf.TransportCompressZstd, Threshold: 128})
+	tcpsocket.Receive(i, client, conn)
+	i.SetConn(conn)
+	defer conn.Close()
+
+	for _, args := range []string{"hi", strings.Repeat("hi", 1000)} {
+		reply, err := i.EmitSync("echo", args, "")
+		if err != nil || reply != args {
+			t.Fatal("unexpected reply:", len(args), reply, err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/tcpsocket"
+	"github.com/plhwin/gosocket/websocket"
+)
+
+// testCA the in-memory certificate authority issuing the certificates of the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gosocket test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue the certificate of the common name, which is valid for the localhost
+func (ca *testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"gosocket"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// mutualTLS the TLS configs of the server and the client which verify each other
+func mutualTLS(t *testing.T) (server, client *tls.Config) {
+	ca := newTestCA(t)
+	server = &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "gateway", x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	}
+	client = &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "billing", x509.ExtKeyUsageClientAuth)},
+		RootCAs:      ca.pool,
+	}
+	return
+}
+
+// whoamiAcceptor reply the common name of the verified client certificate
+func whoamiAcceptor() *gosocket.Acceptor {
+	a := gosocket.NewAcceptor()
+	a.On("whoami", func(c gosocket.ClientFace, args string, id string) {
+		c.Emit("whoami", c.(gosocket.Identified).PeerSubject().CommonName, id)
+	})
+	return a
+}
+
+// expectWhoami connect the initiator by the dialer, and check the subjects verified by both sides
+func expectWhoami(t *testing.T, dial gosocket.DialFunc) {
+	connected := make(chan bool, 1)
+	whoami := make(chan string, 1)
+	i := gosocket.NewInitiator()
+	i.On(gosocket.OnConnection, func(c gosocket.ConnFace) {
+		connected <- true
+	})
+	i.On("whoami", func(c gosocket.ConnFace, args string) {
+		whoami <- args
+	})
+	c, err := dial(context.Background(), i)
+	if err != nil {
+		t.Fatal("dial error:", err)
+	}
+	i.SetConn(c)
+	select {
+	case <-connected:
+	case <-time.After(time.Second):
+		t.Fatal("no socket id received")
+	}
+	if cn := c.PeerSubject().CommonName; cn != "gateway" {
+		t.Fatal("unexpected server subject:", cn)
+	}
+	i.Emit("whoami", "", "")
+	select {
+	case cn := <-whoami:
+		if cn != "billing" {
+			t.Fatal("unexpected client subject:", cn)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no whoami reply")
+	}
+}
+
+func TestTCPSocketMutualTLS(t *testing.T) {
+	serverConfig, clientConfig := mutualTLS(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := whoamiAcceptor()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tcpsocket.ServeListener(ctx, l, a, func() tcpsocket.ClientFace {
+		return new(tcpsocket.Client)
+	}, tcpsocket.WithTLS(serverConfig))
+
+	factory := func() tcpsocket.ConnFace {
+		return new(tcpsocket.Conn)
+	}
+	expectWhoami(t, tcpsocket.Dialer("tcp", l.Addr().String(), factory, tcpsocket.WithTLS(clientConfig)))
+
+	// the client without the certificate is never registered
+	anonymous := clientConfig.Clone()
+	anonymous.Certificates = nil
+	connected := make(chan bool, 1)
+	i := gosocket.NewInitiator()
+	i.On(gosocket.OnConnection, func(c gosocket.ConnFace) {
+		connected <- true
+	})
+	if c, err := tcpsocket.Dialer("tcp", l.Addr().String(), factory, tcpsocket.WithTLS(anonymous))(context.Background(), i); err == nil {
+		// the client certificate is verified by the server after the client finished the TLS 1.3 handshake
+		i.SetConn(c)
+	}
+	select {
+	case <-connected:
+		t.Fatal("the client without the certificate was connected")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebsocketMutualTLS(t *testing.T) {
+	serverConfig, clientConfig := mutualTLS(t)
+	a := whoamiAcceptor()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		websocket.Serve(context.Background(), a, w, r, new(websocket.Client))
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	url := "wss" + strings.TrimPrefix(server.URL, "https")
+	expectWhoami(t, websocket.Dialer(url, nil, func() websocket.ConnFace {
+		return new(websocket.Conn)
+	}, websocket.WithTLSConfig(clientConfig)))
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/websocket"
+)
+
+func TestWebsocketUpgraderOptions(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		websocket.Serve(context.Background(), a, w, r, new(websocket.Client),
+			websocket.WithAllowedOrigins("https://example.com", "*.example.org", "example.net"),
+			websocket.WithSubprotocols("gosocket.v2", "gosocket.v1"),
+		)
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for origin, allowed := range map[string]bool{
+		"https://example.com":          true,
+		"https://app.example.org":      true,
+		"https://app.example.org:8443": true,
+		"http://example.net:8080":      true,
+		"https://example.com:8443":     false,
+		"https://evilexample.org":      false,
+		"https://evil.com":             false,
+		"":                             true,
+	} {
+		header := http.Header{"Sec-Websocket-Protocol": {"gosocket.v1"}}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := websocket.Dial(url, header)
+		if (err == nil) != allowed {
+			t.Fatal("unexpected origin check result:", origin, err)
+		}
+		if !allowed {
+			if resp.StatusCode != http.StatusForbidden {
+				t.Fatal("unexpected status:", origin, resp.StatusCode)
+			}
+			continue
+		}
+		if conn.Subprotocol() != "gosocket.v1" {
+			t.Fatal("unexpected subprotocol:", conn.Subprotocol())
+		}
+		conn.Close()
+	}
+}
+
+func TestWebsocketDefaultOrigins(t *testing.T) {
+	a := gosocket.NewAcceptor()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var opts []websocket.Option
+		if r.URL.Query().Get("any") != "" {
+			opts = append(opts, websocket.WithAllowedOrigins("*"))
+		}
+		websocket.Serve(context.Background(), a, w, r, new(websocket.Client), opts...)
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// the allowed origins of the config is empty, only the same origin is allowed
+	for _, tc := range []struct {
+		url     string
+		origin  string
+		allowed bool
+	}{
+		{url, server.URL, true},
+		{url, "", true},
+		{url, "https://evil.com", false},
+		{url + "?any=1", "https://evil.com", true},
+	} {
+		header := http.Header{}
+		if tc.origin != "" {
+			header.Set("Origin", tc.origin)
+		}
+		conn, resp, err := websocket.Dial(tc.url, header)
+		if (err == nil) != tc.allowed {
+			t.Fatal("unexpected origin check result:", tc.url, tc.origin, err)
+		}
+		if !tc.allowed {
+			if resp.StatusCode != http.StatusForbidden {
+				t.Fatal("unexpected status:", tc.origin, resp.StatusCode)
+			}
+			continue
+		}
+		conn.Close()
+	}
+}
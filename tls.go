@@ -0,0 +1,15 @@
+package gosocket
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// VerifiedPeerCertificate the leaf certificate of the peer verified by the TLS handshake, nil if the peer was not verified,
+// e.g. the client certificate of the mutual TLS, or the server certificate verified by the initiator
+func VerifiedPeerCertificate(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
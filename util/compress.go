@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"github.com/golang/snappy"
+	"github.com/pierrec/lz4/v4"
 	"io"
 )
 
+var ErrorSizeExceeded = errors.New("the decompressed data exceeds the max size")
+
 // zip data by gzip
 func Zip(buf []byte) (data []byte, err error) {
 	var b bytes.Buffer
@@ -97,3 +101,29 @@ func UnzipSnappy(data []byte) ([]byte, error) {
 
 	return out, err
 }
+
+// zip data by LZ4
+func ZipLZ4(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := lz4.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// unzip data by LZ4, return ErrorSizeExceeded if the decompressed data is larger than max bytes
+func UnzipLZ4(data []byte, max int) ([]byte, error) {
+	out, err := io.ReadAll(io.LimitReader(lz4.NewReader(bytes.NewReader(data)), int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > max {
+		return nil, ErrorSizeExceeded
+	}
+	return out, nil
+}
@@ -2,62 +2,66 @@ package websocket
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
 	"log"
 	"net"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/plhwin/gosocket/conf"
 
 	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/protocol"
 
 	"github.com/gorilla/websocket"
 )
 
+// ErrorClosing the request is rejected because the acceptor is shutting down
+var ErrorClosing = errors.New("the acceptor is shutting down")
+
 type ClientFace interface {
 	gosocket.ClientFace
-	init(context.Context, *websocket.Conn, *gosocket.Acceptor, *http.Request) // init the client
+	init(context.Context, *websocket.Conn, *gosocket.Acceptor, *http.Request, *protocol.Codec) // init the client
+	SetIdentity(*gosocket.Identity)                                                            // set the authenticated identity
+	SetPeerCertificate(*x509.Certificate)                                                      // set the client certificate verified by the TLS handshake
 	read(ClientFace)
 	write()
 }
 
 type Client struct {
 	gosocket.Client
-	conn *websocket.Conn // websocket conn
-}
-
-var upgrader = websocket.Upgrader{
-	//ReadBufferSize:  4096,
-	//WriteBufferSize: 4096,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	conn        *websocket.Conn // websocket conn
+	messageType int             // the message type to send message
 }
 
-func (c *Client) init(baseCtx context.Context, conn *websocket.Conn, a *gosocket.Acceptor, r *http.Request) {
+func (c *Client) init(baseCtx context.Context, conn *websocket.Conn, a *gosocket.Acceptor, r *http.Request, codec *protocol.Codec) {
 	c.conn = conn
-	// Set remoteAddr: Consider proxy
-	// Use custom header name and controlled by the developers to avoid fake IP
-	// Only set the name when the proxy is turned on
-	// The header value should be contained two parts, the format is ip:port
-	remoteAddr := conn.RemoteAddr()
-	if conf.Acceptor.Websocket.RemoteAddrHeaderName != "" {
-		if remoteAddrStr := r.Header.Get(conf.Acceptor.Websocket.RemoteAddrHeaderName); remoteAddrStr != "" {
-			if ss := strings.Split(remoteAddrStr, ":"); len(ss) == 2 {
-				if port, err := strconv.Atoi(ss[1]); err == nil {
-					remoteAddr = &net.TCPAddr{IP: net.ParseIP(ss[0]), Port: port}
-				}
-			}
-		}
-	}
 
 	// 设置远程连接地址
-	c.SetRemoteAddr(remoteAddr)
+	c.SetRemoteAddr(RemoteAddr(conn, r))
 
 	// 初始化客户端
 	c.Init(baseCtx, a)
+
+	// the larger message closes the connection by websocket.ErrReadLimit
+	conn.SetReadLimit(int64(conf.Acceptor.Transport.MaxMessageSize))
+
+	c.messageType = websocket.TextMessage
+	if conf.Acceptor.Websocket.MessageType == conf.WebsocketMessageTypeBinary {
+		c.messageType = websocket.BinaryMessage
+	}
+	// the negotiated codec decides the message type
+	if codec != nil {
+		c.SetCodec(*codec)
+		c.messageType = messageTypeOf(*codec)
+	}
+}
+
+// RemoteAddr the remote address of the connection, consider proxy, see gosocket.RemoteAddr,
+// the address of the conn is the same as the request, it is kept for compatibility
+func RemoteAddr(conn *websocket.Conn, r *http.Request) net.Addr {
+	return gosocket.RemoteAddr(r)
 }
 
 func (c *Client) Close() {
@@ -69,17 +73,24 @@ func (c *Client) Close() {
 }
 
 // Serve handles websocket requests from the peer
-func Serve(baseCtx context.Context, a *gosocket.Acceptor, w http.ResponseWriter, r *http.Request, c ClientFace) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+func Serve(baseCtx context.Context, a *gosocket.Acceptor, w http.ResponseWriter, r *http.Request, c ClientFace, opts ...Option) {
+	conn, codec, identity, err := Upgrade(a, w, r, opts...)
 	if err != nil {
-		log.Println("[WebSocket][client][Serve] upgrade error:", err)
 		return
 	}
 
-	c.init(baseCtx, conn, a, r)
+	c.init(baseCtx, conn, a, r, codec)
+	c.SetIdentity(identity)
+	// the client certificate verified by the http.Server of the mutual TLS
+	c.SetPeerCertificate(gosocket.VerifiedPeerCertificate(r.TLS))
 
-	// add the ClientFace to acceptor
-	a.Join(c)
+	// add the ClientFace to acceptor, the acceptor may start shutting down after the upgrade
+	if !a.TryJoin(c) {
+		c.CloseConnCtx()
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
 
 	// trigger the event: OnConnection
 	a.CallGivenEvent(c, gosocket.OnConnection)
@@ -91,6 +102,55 @@ func Serve(baseCtx context.Context, a *gosocket.Acceptor, w http.ResponseWriter,
 	go c.read(c)
 }
 
+// Upgrade authenticate the request, negotiate the codec and upgrade the connection,
+// it is the handshake of Serve, which is shared by the protocols on top of the websocket, such as Socket.IO,
+// the error response has been written to the peer if an error is returned
+func Upgrade(a *gosocket.Acceptor, w http.ResponseWriter, r *http.Request, opts ...Option) (conn *websocket.Conn, codec *protocol.Codec, identity *gosocket.Identity, err error) {
+	o := newOptions(opts)
+
+	// the acceptor is shutting down
+	if a.Closing() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return nil, nil, nil, ErrorClosing
+	}
+
+	// authenticate before upgrade, the rejected peer will never be registered
+	if o.authenticator != nil {
+		if identity, err = o.authenticator(r); err != nil {
+			log.Println("[WebSocket][client][Serve] authenticate error:", err, r.RemoteAddr)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// negotiate the codec of the client, the conf is used if not requested
+	var subprotocol string
+	if codec, subprotocol, err = negotiate(r); err != nil {
+		log.Println("[WebSocket][client][Serve] negotiate error:", err, r.RemoteAddr)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	upgrader := o.upgrader()
+	if subprotocol != "" {
+		upgrader.Subprotocols = append([]string{subprotocol}, upgrader.Subprotocols...)
+	}
+
+	if conn, err = upgrader.Upgrade(w, r, nil); err != nil {
+		log.Println("[WebSocket][client][Serve] upgrade error:", err)
+	}
+	return
+}
+
+// Authenticate run the authenticator set by WithAuthenticator, the identity is nil if not set,
+// it is shared by the transports which are not upgraded to the websocket, such as the polling transport of Socket.IO
+func Authenticate(r *http.Request, opts ...Option) (*gosocket.Identity, error) {
+	o := newOptions(opts)
+	if o.authenticator == nil {
+		return nil, nil
+	}
+	return o.authenticator(r)
+}
+
 func (c *Client) write() {
 	ticker := time.NewTicker(time.Duration(conf.Acceptor.Heartbeat.PingInterval) * time.Second)
 	defer func() {
@@ -103,10 +163,7 @@ func (c *Client) write() {
 		close(c.StopOut())
 	}()
 
-	messageType := websocket.TextMessage
-	if conf.Acceptor.Websocket.MessageType == conf.WebsocketMessageTypeBinary {
-		messageType = websocket.BinaryMessage
-	}
+	messageType := c.messageType
 
 	for {
 		select {
@@ -116,9 +173,30 @@ func (c *Client) write() {
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-			if err := c.conn.WriteMessage(messageType, msg); err != nil {
+			if err := c.writeMessage(messageType, msg); err != nil {
 				return
 			}
+		case <-c.Coalesced():
+			for _, msg := range c.TakeCoalesced() {
+				if err := c.writeMessage(messageType, msg); err != nil {
+					return
+				}
+			}
+		case <-c.Draining():
+			// the acceptor is shutting down, flush the messages waiting to be sent,
+			// then tell the client we are going away and wait for the client to close the connection
+			for _, msg := range c.TakeCoalesced() {
+				if err := c.writeMessage(messageType, msg); err != nil {
+					return
+				}
+			}
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+			<-c.Context().Done()
+			return
+		case <-c.Context().Done():
+			// the connection context was cancelled, e.g. disconnect the slow client by the backpressure policy
+			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
 		case <-ticker.C:
 			// when the Websocket server sends `ping` messages for x consecutive times
 			// but does not receive any` pong` messages back,
@@ -132,8 +210,8 @@ func (c *Client) write() {
 			}
 			timeNow := time.Now()
 			millisecond := timeNow.UnixNano() / int64(time.Millisecond)
-			if msg, err := c.Acceptor().Encode(gosocket.EventPing, millisecond, "", conf.Acceptor.Transport.Send.Serialize, conf.Acceptor.Transport.Send.Compress); err == nil {
-				if err := c.conn.WriteMessage(messageType, msg); err != nil {
+			if msg, err := c.Acceptor().EncodeCodec(gosocket.EventPing, millisecond, "", c.SendCodec()); err == nil {
+				if err := c.writeMessage(messageType, msg); err != nil {
 					return
 				}
 				c.SetPing(millisecond, true)
@@ -148,8 +226,7 @@ func (c *Client) write() {
 func (c *Client) read(face ClientFace) {
 	defer func() {
 		c.Close()
-		c.LeaveAll()
-		c.Acceptor().CallGivenEvent(face, gosocket.OnDisconnection)
+		c.Acceptor().Leave(face)
 	}()
 	// Tolerate one heartbeat cycle
 	wait := time.Duration((conf.Acceptor.Heartbeat.PingMaxTimes+2)*conf.Acceptor.Heartbeat.PingInterval) * time.Second
@@ -159,18 +236,36 @@ func (c *Client) read(face ClientFace) {
 		}
 		_, msg, err := c.conn.ReadMessage()
 		if err != nil {
+			if err == websocket.ErrReadLimit {
+				c.Acceptor().AddOversized()
+			}
 			log.Println("[WebSocket][client][read] go away:", err, c.Id(), c.RemoteAddr())
 			break
 			// error reading the message, break out of the loop,
 			// the function of defer will executes the instruction to disconnect the client
 		}
+		if msg, err = c.StreamUnzip(msg); err != nil {
+			// the compression stream is broken, the messages afterwards can not be decompressed
+			log.Println("[WebSocket][client][read] stream unzip error:", err, c.Id(), c.RemoteAddr())
+			break
+		}
 		c.process(face, msg)
 	}
 }
 
+// writeMessage write the message, which is compressed by the compression stream first if the codec is streamed
+func (c *Client) writeMessage(messageType int, msg []byte) error {
+	msg, err := c.StreamZip(msg)
+	if err != nil {
+		log.Println("[WebSocket][client][write] stream zip error:", err, c.Id(), c.RemoteAddr())
+		return err
+	}
+	return c.conn.WriteMessage(messageType, msg)
+}
+
 func (c *Client) process(face ClientFace, msg []byte) {
 	// parse the message to determine what the client connection wants to do
-	message, err := c.Acceptor().Decode(msg, conf.Acceptor.Transport.Receive.Serialize, conf.Acceptor.Transport.Receive.Compress)
+	message, err := c.Acceptor().DecodeCodec(msg, c.ReceiveCodec())
 	if err != nil {
 		log.Println("[WebSocket][client][read] msg decode error:", err, msg, string(msg), c.Id(), c.RemoteAddr())
 		return
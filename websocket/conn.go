@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"crypto/tls"
 	"log"
 	"net/http"
 
@@ -13,6 +14,7 @@ import (
 type ConnFace interface {
 	gosocket.ConnFace
 	init(*websocket.Conn, *gosocket.Initiator) // init to conn
+	Close()                                    // close the connection
 	read(ConnFace)
 	write()
 }
@@ -26,20 +28,28 @@ func (c *Conn) init(conn *websocket.Conn, i *gosocket.Initiator) {
 	c.conn = conn
 	c.SetRemoteAddr(conn.RemoteAddr())
 	c.Init(i)
+	if tlsConn, ok := conn.UnderlyingConn().(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		c.SetPeerCertificate(gosocket.VerifiedPeerCertificate(&state))
+	}
+	// the larger message closes the connection by websocket.ErrReadLimit
+	conn.SetReadLimit(int64(conf.Initiator.Transport.MaxMessageSize))
 }
 
 func (c *Conn) Close() {
 	c.conn.Close()
 }
 
-func Dial(urlStr string, requestHeader http.Header) (*websocket.Conn, *http.Response, error) {
-	return websocket.DefaultDialer.Dial(urlStr, requestHeader)
+// Dial connect the websocket server, the "wss" server is dialed by the TLS config of WithTLSConfig
+func Dial(urlStr string, requestHeader http.Header, opts ...Option) (*websocket.Conn, *http.Response, error) {
+	return newOptions(opts).dialer().Dial(urlStr, requestHeader)
 }
 
 // Receive as an initiator, receive message from websocket server
 // Receive is a non-blocking method.
 // The blocking process is managed by the outer layer.
-// For example, the outer layer can freely control the automatic reconnection after the connection is disconnected.
+// For example, the outer layer can freely control the automatic reconnection after the connection is disconnected,
+// or use gosocket.Initiator.Reconnect with the Dialer to reconnect automatically.
 // Therefore, the outer method cannot close the websocket connection.
 // The closing of the connection will be handled here
 func Receive(i *gosocket.Initiator, conn *websocket.Conn, c ConnFace) {
@@ -58,10 +68,18 @@ func (c *Conn) read(face ConnFace) {
 	for {
 		messageType, msg, err := c.conn.ReadMessage()
 		if err != nil {
+			if err == websocket.ErrReadLimit {
+				c.Initiator().AddOversized()
+			}
 			log.Println("[WebSocket][conn][read] connection read error:", err, c.conn.LocalAddr(), "|", messageType, "|", msg, "|", string(msg), "|", c.Id(), c.RemoteAddr())
 			break
 		}
-		message, decodeErr := c.Initiator().Decode(msg, conf.Initiator.Transport.Receive.Serialize, conf.Initiator.Transport.Receive.Compress)
+		if msg, err = c.StreamUnzip(msg); err != nil {
+			// the compression stream is broken, the messages afterwards can not be decompressed
+			log.Println("[WebSocket][conn][read] stream unzip error:", err, c.Id(), c.RemoteAddr())
+			break
+		}
+		message, decodeErr := c.Initiator().DecodeCodec(msg, c.ReceiveCodec())
 		if decodeErr != nil {
 			log.Println("[WebSocket][conn][read] protocol Decode error:", decodeErr, msg, string(msg), c.Id(), c.RemoteAddr())
 			continue
@@ -78,7 +96,16 @@ func (c *Conn) write() {
 	if conf.Initiator.Websocket.MessageType == conf.WebsocketMessageTypeBinary {
 		messageType = websocket.BinaryMessage
 	}
+	// the negotiated codec decides the message type
+	if c.Negotiated() {
+		messageType = messageTypeOf(c.SendCodec())
+	}
 	for msg := range c.Out() {
+		msg, err := c.StreamZip(msg)
+		if err != nil {
+			log.Println("[WebSocket][conn][write] stream zip error:", err, c.Id(), c.RemoteAddr())
+			break
+		}
 		if err := c.conn.WriteMessage(messageType, msg); err != nil {
 			log.Println("[WebSocket][conn][write] error:", err, msg, string(msg), c.Id(), c.RemoteAddr())
 			break
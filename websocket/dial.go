@@ -0,0 +1,26 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/plhwin/gosocket"
+)
+
+// Dialer get the gosocket.DialFunc which dials the websocket server and receives on the connection,
+// it is used to keep the initiator connected by gosocket.Initiator.Reconnect.
+// the factory creates a new ConnFace for each connection,
+// the codec is negotiated by the subprotocol if it was set by ConnFace.SetCodec in the factory,
+// the "wss" server is dialed by the TLS config of WithTLSConfig
+func Dialer(urlStr string, requestHeader http.Header, factory func() ConnFace, opts ...Option) gosocket.DialFunc {
+	d := newOptions(opts).dialer()
+	return func(ctx context.Context, i *gosocket.Initiator) (gosocket.ConnFace, error) {
+		c := factory()
+		conn, _, err := dial(ctx, d, urlStr, requestHeader, c)
+		if err != nil {
+			return nil, err
+		}
+		Receive(i, conn, c)
+		return c, nil
+	}
+}
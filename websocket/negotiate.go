@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/plhwin/gosocket/protocol"
+)
+
+// CodecParam is the query param to negotiate the codec, e.g. "ws://example.com/ws?codec=Protobuf.Snappy",
+// the codec can also be negotiated by the subprotocol, e.g. "gosocket.Protobuf.Snappy"
+const CodecParam = "codec"
+
+// negotiate the codec requested by the query param or the subprotocol, the query param takes precedence,
+// the subprotocol of the codec is returned to be selected by the upgrader, nil codec means not requested
+func negotiate(r *http.Request) (codec *protocol.Codec, subprotocol string, err error) {
+	if param := r.URL.Query().Get(CodecParam); param != "" {
+		var v protocol.Codec
+		if v, err = protocol.ParseCodec(param); err != nil {
+			return
+		}
+		codec = &v
+	}
+	for _, s := range websocket.Subprotocols(r) {
+		name, ok := strings.CutPrefix(s, protocol.CodecPrefix)
+		if !ok {
+			continue
+		}
+		v, parseErr := protocol.ParseCodec(name)
+		if parseErr != nil || (codec != nil && v != *codec) {
+			continue
+		}
+		return &v, s, nil
+	}
+	return
+}
+
+// the message type of the codec
+func messageTypeOf(codec protocol.Codec) int {
+	if codec.Binary() {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// dial the server with the subprotocol which negotiates the codec if the codec was set
+func dial(ctx context.Context, d *websocket.Dialer, urlStr string, requestHeader http.Header, c ConnFace) (conn *websocket.Conn, resp *http.Response, err error) {
+	if !c.Negotiated() {
+		return d.DialContext(ctx, urlStr, requestHeader)
+	}
+	subprotocol := protocol.CodecPrefix + c.SendCodec().String()
+	negotiator := *d
+	negotiator.Subprotocols = append([]string{subprotocol}, d.Subprotocols...)
+	if conn, resp, err = negotiator.DialContext(ctx, urlStr, requestHeader); err != nil {
+		return
+	}
+	if conn.Subprotocol() != subprotocol {
+		conn.Close()
+		err = errors.New("the codec was not accepted by the server: " + subprotocol)
+	}
+	return
+}
@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/plhwin/gosocket"
+	"github.com/plhwin/gosocket/conf"
+)
+
+// Authenticator authenticate the handshake request before upgrade, such as the header, query token or cookie,
+// the request is rejected with 401 Unauthorized if an error is returned,
+// and the identity returned is attached to the client
+type Authenticator func(r *http.Request) (*gosocket.Identity, error)
+
+type options struct {
+	authenticator     Authenticator
+	allowedOrigins    []string
+	subprotocols      []string
+	readBufferSize    int
+	writeBufferSize   int
+	enableCompression bool
+	handshakeTimeout  time.Duration
+	tlsConfig         *tls.Config
+}
+
+// Option configures the Serve, Dial and Dialer, the upgrader options default to conf.Acceptor.Websocket,
+// the options of the acceptor side are ignored by the initiator side
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		allowedOrigins:    conf.Acceptor.Websocket.AllowedOrigins,
+		subprotocols:      conf.Acceptor.Websocket.Subprotocols,
+		readBufferSize:    conf.Acceptor.Websocket.ReadBufferSize,
+		writeBufferSize:   conf.Acceptor.Websocket.WriteBufferSize,
+		enableCompression: conf.Acceptor.Websocket.EnableCompression,
+		handshakeTimeout:  time.Duration(conf.Acceptor.Websocket.HandshakeTimeout) * time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAuthenticator require the peer to be authenticated before upgrade
+func WithAuthenticator(f Authenticator) Option {
+	return func(o *options) {
+		o.authenticator = f
+	}
+}
+
+// WithAllowedOrigins only allow the origins to connect, such as "https://example.com", "example.com" or "*.example.com",
+// the request without Origin header is always allowed, "*" allows all origins,
+// empty means only the same origin as the Host header is allowed
+func WithAllowedOrigins(origins ...string) Option {
+	return func(o *options) {
+		o.allowedOrigins = origins
+	}
+}
+
+// WithSubprotocols set the server supported subprotocols in order of preference
+func WithSubprotocols(subprotocols ...string) Option {
+	return func(o *options) {
+		o.subprotocols = subprotocols
+	}
+}
+
+// WithBufferSize set the I/O buffer sizes in bytes, 0 means using the default size
+func WithBufferSize(read, write int) Option {
+	return func(o *options) {
+		o.readBufferSize = read
+		o.writeBufferSize = write
+	}
+}
+
+// WithCompression negotiate the permessage-deflate compression with the client
+func WithCompression(enable bool) Option {
+	return func(o *options) {
+		o.enableCompression = enable
+	}
+}
+
+// WithHandshakeTimeout set the timeout of the handshake, 0 means no timeout
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.handshakeTimeout = timeout
+	}
+}
+
+// WithTLSConfig set the TLS config of Dial and Dialer to connect the "wss" server, e.g. the RootCAs and the client Certificates of the mutual TLS,
+// the TLS of the acceptor side is configured by the http.Server, the verified client certificate is exposed by PeerSubject and PeerCertificate
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+func (o *options) upgrader() *websocket.Upgrader {
+	u := &websocket.Upgrader{
+		HandshakeTimeout:  o.handshakeTimeout,
+		ReadBufferSize:    o.readBufferSize,
+		WriteBufferSize:   o.writeBufferSize,
+		Subprotocols:      o.subprotocols,
+		EnableCompression: o.enableCompression,
+	}
+	// leave CheckOrigin nil to use the same origin check of gorilla if no origin is allowed explicitly
+	if len(o.allowedOrigins) > 0 {
+		u.CheckOrigin = o.checkOrigin
+	}
+	return u
+}
+
+func (o *options) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// not a browser
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	// the bare host and the wildcard match the host name regardless of the port, e.g. "https://a.example.com:8443"
+	host, hostname := strings.ToLower(u.Host), strings.ToLower(u.Hostname())
+	for _, allowed := range o.allowedOrigins {
+		allowed = strings.ToLower(allowed)
+		switch {
+		case allowed == "*", allowed == strings.ToLower(origin), allowed == host, allowed == hostname:
+			return true
+		case strings.HasPrefix(allowed, "*.") && strings.HasSuffix(hostname, allowed[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+func (o *options) dialer() *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	d.TLSClientConfig = o.tlsConfig
+	return &d
+}